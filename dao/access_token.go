@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 最后使用时间的更新间隔，频繁调用时不用每次都写库
+const touchInterval = time.Minute
+
+// AccessToken 个人访问令牌，给脚本和 CI 调用接口用，只保存哈希
+type AccessToken struct {
+	ID        int64  `gorm:"primaryKey,autoIncrement"`
+	UserID    int64  `gorm:"not null;index"`
+	Name      string `gorm:"type:varchar(64);not null"`
+	TokenHash string `gorm:"type:char(64);not null;uniqueIndex"`
+	// Scopes 逗号分隔的权限范围
+	Scopes string `gorm:"type:varchar(255);not null"`
+	// ExpiresAt 过期时间，毫秒时间戳
+	ExpiresAt  int64 `gorm:"not null"`
+	LastUsedAt int64 `gorm:"not null;default:0"`
+	RevokedAt  int64 `gorm:"not null;default:0"`
+	Ctime      int64
+}
+
+type GROMAccessTokenDAO struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenDAO(db *gorm.DB) AccessTokenDAO {
+	res := &GROMAccessTokenDAO{
+		db: db,
+	}
+	return res
+}
+
+type AccessTokenDAO interface {
+	Create(ctx context.Context, t AccessToken) (int64, error)
+	// ListByUser 用户未吊销的令牌，包括已过期的，按创建时间倒序
+	ListByUser(ctx context.Context, userId int64) ([]AccessToken, error)
+	// CountActive 用户未吊销且未过期的令牌数
+	CountActive(ctx context.Context, userId int64) (int64, error)
+	// FindByHash 不存在时返回 errs.ErrNotFound，调用方需要检查是否过期或吊销
+	FindByHash(ctx context.Context, hash string) (AccessToken, error)
+	// Revoke 只能吊销自己的令牌，不存在或已吊销时返回 errs.ErrNotFound
+	Revoke(ctx context.Context, userId int64, id int64) error
+	// RevokeAll 吊销用户的全部令牌，修改或重置密码时调用
+	RevokeAll(ctx context.Context, userId int64) error
+	// Touch 记录最后使用时间
+	Touch(ctx context.Context, id int64) error
+}
+
+func (dao *GROMAccessTokenDAO) Create(ctx context.Context, t AccessToken) (int64, error) {
+	t.Ctime = time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Create(&t).Error
+	return t.ID, wrapErr(err)
+}
+
+func (dao *GROMAccessTokenDAO) ListByUser(ctx context.Context, userId int64) ([]AccessToken, error) {
+	var tokens []AccessToken
+	err := dao.db.WithContext(ctx).Where("user_id = ? AND revoked_at = 0", userId).
+		Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (dao *GROMAccessTokenDAO) CountActive(ctx context.Context, userId int64) (int64, error) {
+	var n int64
+	err := dao.db.WithContext(ctx).Model(&AccessToken{}).
+		Where("user_id = ? AND revoked_at = 0 AND expires_at > ?", userId, time.Now().UnixMilli()).
+		Count(&n).Error
+	return n, err
+}
+
+func (dao *GROMAccessTokenDAO) FindByHash(ctx context.Context, hash string) (AccessToken, error) {
+	var t AccessToken
+	err := dao.db.WithContext(ctx).Where("token_hash = ?", hash).First(&t).Error
+	return t, wrapErr(err)
+}
+
+func (dao *GROMAccessTokenDAO) Revoke(ctx context.Context, userId int64, id int64) error {
+	res := dao.db.WithContext(ctx).Model(&AccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at = 0", id, userId).
+		Update("revoked_at", time.Now().UnixMilli())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return wrapErr(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (dao *GROMAccessTokenDAO) RevokeAll(ctx context.Context, userId int64) error {
+	return dao.db.WithContext(ctx).Model(&AccessToken{}).
+		Where("user_id = ? AND revoked_at = 0", userId).
+		Update("revoked_at", time.Now().UnixMilli()).Error
+}
+
+func (dao *GROMAccessTokenDAO) Touch(ctx context.Context, id int64) error {
+	now := time.Now()
+	return dao.db.WithContext(ctx).Model(&AccessToken{}).
+		Where("id = ? AND last_used_at < ?", id, now.Add(-touchInterval).UnixMilli()).
+		Update("last_used_at", now.UnixMilli()).Error
+}
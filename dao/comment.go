@@ -6,11 +6,18 @@ import (
 	"time"
 )
 
+const (
+	CommentStatusApproved uint8 = iota + 1
+	CommentStatusPending
+	CommentStatusRejected
+)
+
 type Comment struct {
 	ID      int64  `gorm:"primary_key"`
 	Content string `gorm:"not null"`
 	UserID  int64  `gorm:"not null"`
 	PostID  int64  `gorm:"not null"`
+	Status  uint8  `gorm:"not null;default:1;index"`
 	Ctime   int64
 	Utime   int64
 }
@@ -29,6 +36,15 @@ func NewCommentDAO(db *gorm.DB) CommentDAO {
 type CommentDAO interface {
 	Create(ctx context.Context, comment Comment) (int64, error)
 	LIST(ctx context.Context, postId int64, offset int, limit int) ([]Comment, error)
+	ListAfter(ctx context.Context, postId int64, afterId int64, limit int) ([]Comment, error)
+	FindById(ctx context.Context, id int64) (Comment, error)
+	FindByIds(ctx context.Context, ids []int64) ([]Comment, error)
+	CountByUser(ctx context.Context, userId int64, status uint8) (int64, error)
+	// ListPending 待审核评论，authorId 不为 0 时只查该作者文章下的评论，postId 不为 0 时只查该文章
+	ListPending(ctx context.Context, authorId int64, postId int64, offset int, limit int) ([]Comment, error)
+	UpdateStatus(ctx context.Context, ids []int64, status uint8) error
+	// FindByUser 用户的全部评论，包括未通过审核的
+	FindByUser(ctx context.Context, userId int64) ([]Comment, error)
 }
 
 func (dao *GROMCommentDAO) Create(ctx context.Context, comment Comment) (int64, error) {
@@ -36,11 +52,68 @@ func (dao *GROMCommentDAO) Create(ctx context.Context, comment Comment) (int64,
 	comment.Ctime = now
 	comment.Utime = now
 	err := dao.db.WithContext(ctx).Create(&comment).Error
-	return comment.ID, err
+	return comment.ID, wrapErr(err)
 }
 
 func (dao *GROMCommentDAO) LIST(ctx context.Context, postId int64, offset int, limit int) ([]Comment, error) {
 	var comments []Comment
-	result := dao.db.WithContext(ctx).Preload("User").Preload("Post").Where("post_id = ?", postId).Offset(offset).Limit(limit).Find(&comments)
+	result := dao.db.WithContext(ctx).Where("post_id = ? AND status = ?", postId, CommentStatusApproved).Offset(offset).Limit(limit).Find(&comments)
 	return comments, result.Error
 }
+
+func (dao *GROMCommentDAO) ListAfter(ctx context.Context, postId int64, afterId int64, limit int) ([]Comment, error) {
+	var comments []Comment
+	err := dao.db.WithContext(ctx).Where("post_id = ? AND id > ? AND status = ?", postId, afterId, CommentStatusApproved).Order("id asc").Limit(limit).Find(&comments).Error
+	return comments, err
+}
+
+func (dao *GROMCommentDAO) FindById(ctx context.Context, id int64) (Comment, error) {
+	var c Comment
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&c).Error
+	return c, wrapErr(err)
+}
+
+func (dao *GROMCommentDAO) FindByIds(ctx context.Context, ids []int64) ([]Comment, error) {
+	var comments []Comment
+	if len(ids) == 0 {
+		return comments, nil
+	}
+	err := dao.db.WithContext(ctx).Where("id IN ?", ids).Find(&comments).Error
+	return comments, err
+}
+
+func (dao *GROMCommentDAO) CountByUser(ctx context.Context, userId int64, status uint8) (int64, error) {
+	var cnt int64
+	err := dao.db.WithContext(ctx).Model(&Comment{}).Where("user_id = ? AND status = ?", userId, status).Count(&cnt).Error
+	return cnt, err
+}
+
+func (dao *GROMCommentDAO) ListPending(ctx context.Context, authorId int64, postId int64, offset int, limit int) ([]Comment, error) {
+	var comments []Comment
+	query := dao.db.WithContext(ctx).Where("status = ?", CommentStatusPending)
+	if authorId > 0 {
+		query = query.Where("post_id IN (?)", dao.db.Model(&Post{}).Select("id").Where("author = ?", authorId))
+	}
+	if postId > 0 {
+		query = query.Where("post_id = ?", postId)
+	}
+	err := query.Order("id asc").Offset(offset).Limit(limit).Find(&comments).Error
+	return comments, err
+}
+
+func (dao *GROMCommentDAO) UpdateStatus(ctx context.Context, ids []int64, status uint8) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return dao.db.WithContext(ctx).Model(&Comment{}).Where("id IN ?", ids).
+		Updates(map[string]any{
+			"status": status,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GROMCommentDAO) FindByUser(ctx context.Context, userId int64) ([]Comment, error) {
+	var comments []Comment
+	err := dao.db.WithContext(ctx).Where("user_id = ?", userId).Order("ctime asc").Find(&comments).Error
+	return comments, err
+}
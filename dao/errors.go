@@ -0,0 +1,26 @@
+package dao
+
+import (
+	"blog/errs"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// MySQL 唯一键冲突
+const mysqlDuplicateEntry = 1062
+
+// wrapErr 把数据库错误转换为领域错误，调用方据此区分"不存在"、"冲突"和真正的故障
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errs.ErrNotFound.With(err)
+	}
+	var me *mysql.MySQLError
+	if errors.Is(err, gorm.ErrDuplicatedKey) || (errors.As(err, &me) && me.Number == mysqlDuplicateEntry) {
+		return errs.ErrConflict.With(err)
+	}
+	return err
+}
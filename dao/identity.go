@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Identity 外部身份提供方的账号与本站用户的关联，同一个用户可以关联多个身份提供方
+type Identity struct {
+	ID       int64  `gorm:"primaryKey,autoIncrement"`
+	UserID   int64  `gorm:"not null;index"`
+	Provider string `gorm:"type:varchar(32);not null;uniqueIndex:idx_provider_subject"`
+	// Subject 身份提供方的用户ID（id_token 中的 sub），邮箱可能变化，不能用来关联
+	Subject string `gorm:"type:varchar(255);not null;uniqueIndex:idx_provider_subject"`
+	// Email 关联时身份提供方返回的邮箱，只用于排查
+	Email string `gorm:"type:varchar(255);not null;default:''"`
+	Ctime int64
+}
+
+type GROMIdentityDAO struct {
+	db *gorm.DB
+}
+
+func NewIdentityDAO(db *gorm.DB) IdentityDAO {
+	res := &GROMIdentityDAO{
+		db: db,
+	}
+	return res
+}
+
+type IdentityDAO interface {
+	// Find 不存在时返回 errs.ErrNotFound
+	Find(ctx context.Context, provider string, subject string) (Identity, error)
+	// Create 已经关联过时返回 errs.ErrConflict
+	Create(ctx context.Context, i Identity) error
+}
+
+func (dao *GROMIdentityDAO) Find(ctx context.Context, provider string, subject string) (Identity, error) {
+	var i Identity
+	err := dao.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&i).Error
+	return i, wrapErr(err)
+}
+
+func (dao *GROMIdentityDAO) Create(ctx context.Context, i Identity) error {
+	i.Ctime = time.Now().UnixMilli()
+	return wrapErr(dao.db.WithContext(ctx).Create(&i).Error)
+}
@@ -1,7 +1,38 @@
 package dao
 
-import "gorm.io/gorm"
+import (
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"slices"
+)
 
 func InitDB(db *gorm.DB) {
-	db.AutoMigrate(&User{}, &Post{}, &Comment{})
+	// 邮箱验证上线前注册的用户没有收到过验证邮件，新增这一列时把他们标记为已验证，不影响发文和评论
+	backfillVerified := db.Migrator().HasTable(&User{}) && !db.Migrator().HasColumn(&User{}, "EmailVerified")
+	fixMentionIndex(db)
+	db.AutoMigrate(&User{}, &Post{}, &Comment{}, &Mention{}, &Reaction{}, &PasswordReset{}, &Media{}, &PostTag{}, &RecoveryCode{}, &Identity{}, &AccessToken{}, &Session{})
+	if backfillVerified {
+		db.Unscoped().Model(&User{}).Where("email_verified = ?", false).Update("email_verified", true)
+	}
+}
+
+// fixMentionIndex 提及的唯一索引之前漏了 user_id，一条内容提及多个用户时插入失败。
+// AutoMigrate 不会修改已存在的同名索引，先删掉旧索引再由 AutoMigrate 重建
+func fixMentionIndex(db *gorm.DB) {
+	if !db.Migrator().HasIndex(&Mention{}, "idx_source_user") {
+		return
+	}
+	indexes, err := db.Migrator().GetIndexes(&Mention{})
+	if err != nil {
+		zap.L().Error("查询提及表索引失败", zap.Error(err))
+		return
+	}
+	for _, idx := range indexes {
+		if idx.Name() == "idx_source_user" && !slices.Contains(idx.Columns(), "user_id") {
+			if err := db.Migrator().DropIndex(&Mention{}, "idx_source_user"); err != nil {
+				zap.L().Error("删除提及表旧索引失败", zap.Error(err))
+			}
+			return
+		}
+	}
 }
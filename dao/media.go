@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Media 用户媒体库中的文件，文件本身按内容寻址保存，多个用户上传相同内容时共用
+type Media struct {
+	ID     int64  `gorm:"primaryKey,autoIncrement"`
+	UserID int64  `gorm:"not null;uniqueIndex:idx_user_name;index:idx_user_ctime"`
+	Name   string `gorm:"type:varchar(128);not null;uniqueIndex:idx_user_name"`
+	// 上传时的文件名，只用于展示
+	Filename   string           `gorm:"type:varchar(255);not null;default:''"`
+	Mime       string           `gorm:"type:varchar(64);not null"`
+	Size       int64            `gorm:"not null"`
+	Width      int              `gorm:"not null"`
+	Height     int              `gorm:"not null"`
+	Thumbnails []MediaThumbnail `gorm:"serializer:json;type:text"`
+	Ctime      int64            `gorm:"index:idx_user_ctime"`
+}
+
+type MediaThumbnail struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type GROMMediaDAO struct {
+	db *gorm.DB
+}
+
+func NewMediaDAO(db *gorm.DB) MediaDAO {
+	res := &GROMMediaDAO{
+		db: db,
+	}
+	return res
+}
+
+type MediaDAO interface {
+	// Create 同一个用户重复上传相同内容时返回已有的记录
+	Create(ctx context.Context, m Media) (Media, error)
+	ListByUser(ctx context.Context, userId int64, offset int, limit int) ([]Media, error)
+	// CountByName 引用该文件的记录数
+	CountByName(ctx context.Context, name string) (int64, error)
+}
+
+func (dao *GROMMediaDAO) Create(ctx context.Context, m Media) (Media, error) {
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing Media
+		err := tx.Where("user_id = ? AND name = ?", m.UserID, m.Name).First(&existing).Error
+		if err == nil {
+			m = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		m.Ctime = time.Now().UnixMilli()
+		return tx.Create(&m).Error
+	})
+	return m, wrapErr(err)
+}
+
+func (dao *GROMMediaDAO) ListByUser(ctx context.Context, userId int64, offset int, limit int) ([]Media, error) {
+	var media []Media
+	err := dao.db.WithContext(ctx).Where("user_id = ?", userId).
+		Offset(offset).Limit(limit).Order("ctime desc").Find(&media).Error
+	return media, err
+}
+
+func (dao *GROMMediaDAO) CountByName(ctx context.Context, name string) (int64, error) {
+	var cnt int64
+	err := dao.db.WithContext(ctx).Model(&Media{}).Where("name = ?", name).Count(&cnt).Error
+	return cnt, err
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	MentionSourcePost    = "post"
+	MentionSourceComment = "comment"
+)
+
+type Mention struct {
+	ID int64 `gorm:"primaryKey,autoIncrement"`
+	// 被提及的用户，放在唯一索引最后，按内容删除提及时仍能用上索引
+	UserID     int64  `gorm:"not null;index:idx_user_ctime;uniqueIndex:idx_source_user,priority:11"`
+	Username   string `gorm:"type:varchar(64);not null"`
+	AuthorID   int64  `gorm:"not null"`
+	SourceType string `gorm:"type:varchar(16);not null;uniqueIndex:idx_source_user"`
+	SourceID   int64  `gorm:"not null;uniqueIndex:idx_source_user"`
+	PostID     int64  `gorm:"not null"`
+	Ctime      int64  `gorm:"index:idx_user_ctime"`
+}
+
+type GROMMentionDAO struct {
+	db *gorm.DB
+}
+
+func NewMentionDAO(db *gorm.DB) MentionDAO {
+	res := &GROMMentionDAO{
+		db: db,
+	}
+	return res
+}
+
+type MentionDAO interface {
+	// Replace 用新的提及记录整体替换某条内容原有的记录
+	Replace(ctx context.Context, sourceType string, sourceId int64, mentions []Mention) error
+	FindBySources(ctx context.Context, sourceType string, sourceIds []int64) ([]Mention, error)
+	ListByUser(ctx context.Context, userId int64, offset int, limit int) ([]Mention, error)
+}
+
+func (dao *GROMMentionDAO) Replace(ctx context.Context, sourceType string, sourceId int64, mentions []Mention) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceId).Delete(&Mention{}).Error
+		if err != nil {
+			return err
+		}
+		if len(mentions) == 0 {
+			return nil
+		}
+		for i := range mentions {
+			mentions[i].SourceType = sourceType
+			mentions[i].SourceID = sourceId
+			mentions[i].Ctime = now
+		}
+		return tx.Create(&mentions).Error
+	})
+}
+
+func (dao *GROMMentionDAO) FindBySources(ctx context.Context, sourceType string, sourceIds []int64) ([]Mention, error) {
+	var mentions []Mention
+	if len(sourceIds) == 0 {
+		return mentions, nil
+	}
+	err := dao.db.WithContext(ctx).Where("source_type = ? AND source_id IN ?", sourceType, sourceIds).Find(&mentions).Error
+	return mentions, err
+}
+
+func (dao *GROMMentionDAO) ListByUser(ctx context.Context, userId int64, offset int, limit int) ([]Mention, error) {
+	var mentions []Mention
+	// 自己提及自己不算
+	err := dao.db.WithContext(ctx).Where("user_id = ? AND author_id <> ?", userId, userId).
+		Order("ctime desc").Offset(offset).Limit(limit).Find(&mentions).Error
+	return mentions, err
+}
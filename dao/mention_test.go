@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+func TestGROMMentionDAO_Replace(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `mentions` WHERE source_type = ? AND source_id = ?")).
+		WithArgs(MentionSourceComment, 5).WillReturnResult(sqlmock.NewResult(0, 0))
+	// 一条内容提及多个用户时一次插入多行
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `mentions` (`user_id`,`username`,`author_id`,`source_type`,`source_id`,`post_id`,`ctime`) VALUES (?,?,?,?,?,?,?),(?,?,?,?,?,?,?)")).
+		WithArgs(2, "bob", 1, MentionSourceComment, 5, 3, sqlmock.AnyArg(),
+			4, "carol", 1, MentionSourceComment, 5, 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 2))
+	mock.ExpectCommit()
+
+	err := NewMentionDAO(db).Replace(context.Background(), MentionSourceComment, 5, []Mention{
+		{UserID: 2, Username: "bob", AuthorID: 1, PostID: 3},
+		{UserID: 4, Username: "carol", AuthorID: 1, PostID: 3},
+	})
+	assert.NoError(t, err)
+}
+
+// 唯一索引要包含被提及的用户，否则同一条内容只能保存一个提及
+func TestMentionSourceIndex(t *testing.T) {
+	s, err := schema.Parse(&Mention{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+	idx := s.LookIndex("idx_source_user")
+	require.NotNil(t, idx)
+	assert.Equal(t, "UNIQUE", idx.Class)
+	var columns []string
+	for _, f := range idx.Fields {
+		columns = append(columns, f.DBName)
+	}
+	assert.Equal(t, []string{"source_type", "source_id", "user_id"}, columns)
+}
@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"blog/errs"
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PasswordReset 重置密码 token，只保存哈希
+type PasswordReset struct {
+	ID        int64  `gorm:"primaryKey,autoIncrement"`
+	UserID    int64  `gorm:"not null;index"`
+	TokenHash string `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt int64  `gorm:"not null"`
+	UsedAt    int64  `gorm:"not null;default:0"`
+	Ctime     int64
+}
+
+type GROMPasswordResetDAO struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetDAO(db *gorm.DB) PasswordResetDAO {
+	res := &GROMPasswordResetDAO{
+		db: db,
+	}
+	return res
+}
+
+type PasswordResetDAO interface {
+	Create(ctx context.Context, r PasswordReset) error
+	// Consume 把 token 标记为已使用，token 不存在、已使用或已过期时返回 errs.ResetTokenInvalid
+	Consume(ctx context.Context, tokenHash string) (PasswordReset, error)
+	// InvalidateUser 作废用户所有未使用的 token
+	InvalidateUser(ctx context.Context, userId int64) error
+}
+
+func (dao *GROMPasswordResetDAO) Create(ctx context.Context, r PasswordReset) error {
+	r.Ctime = time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Create(&r).Error
+}
+
+func (dao *GROMPasswordResetDAO) Consume(ctx context.Context, tokenHash string) (PasswordReset, error) {
+	var r PasswordReset
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 用条件更新保证并发时只有一个请求能用掉 token
+		res := tx.Model(&PasswordReset{}).
+			Where("token_hash = ? AND used_at = 0 AND expires_at > ?", tokenHash, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errs.ResetTokenInvalid
+		}
+		return tx.Where("token_hash = ?", tokenHash).First(&r).Error
+	})
+	return r, err
+}
+
+func (dao *GROMPasswordResetDAO) InvalidateUser(ctx context.Context, userId int64) error {
+	return dao.db.WithContext(ctx).Model(&PasswordReset{}).
+		Where("user_id = ? AND used_at = 0", userId).
+		Update("used_at", time.Now().UnixMilli()).Error
+}
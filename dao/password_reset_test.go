@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"blog/errs"
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recentMillis 匹配测试开始之后的毫秒时间戳
+type recentMillis int64
+
+func (m recentMillis) Match(v driver.Value) bool {
+	ms, ok := v.(int64)
+	return ok && ms >= int64(m)
+}
+
+func TestGROMPasswordResetDAO_Consume(t *testing.T) {
+	consume := regexp.QuoteMeta("UPDATE `password_resets` SET `used_at`=? WHERE token_hash = ? AND used_at = 0 AND expires_at > ?")
+	testCases := []struct {
+		name     string
+		affected int64
+		wantErr  error
+	}{
+		{name: "未使用且未过期", affected: 1},
+		// 已使用、已过期和不存在的 token 都不满足条件更新
+		{name: "已使用或已过期", affected: 0, wantErr: errs.ResetTokenInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			start := recentMillis(time.Now().UnixMilli())
+			mock.ExpectBegin()
+			mock.ExpectExec(consume).WithArgs(start, "hash", start).
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+			if tc.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `password_resets` WHERE token_hash = ?")).
+					WithArgs("hash", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "token_hash"}).AddRow(1, 7, "hash"))
+				mock.ExpectCommit()
+			}
+
+			r, err := NewPasswordResetDAO(db).Consume(context.Background(), "hash")
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(7), r.UserID)
+		})
+	}
+}
@@ -1,20 +1,31 @@
 package dao
 
 import (
+	"blog/errs"
 	"context"
 	"fmt"
 	"gorm.io/gorm"
 	"time"
 )
 
+// 评论审核模式，文章上为 ModerationInherit 时使用全局配置
+const (
+	ModerationInherit uint8 = iota
+	ModerationOpen
+	ModerationHoldFirstTime
+	ModerationHoldAll
+)
+
 type Post struct {
-	ID       int64  `gorm:"primarykey, autoincrement"`
-	Title    string `gorm:"type=VARCHAR(1024),not null"`
-	Content  string `gorm:"type=BLOB, not null"`
-	Author   int64  `gorm:"index=pid_ctime"`
-	Ctime    int64  `gorm:"index=pid_ctime"`
-	Utime    int64
-	Comments []Comment
+	ID      int64  `gorm:"primarykey, autoincrement"`
+	Title   string `gorm:"type=VARCHAR(1024),not null"`
+	Content string `gorm:"type=BLOB, not null"`
+	Author  int64  `gorm:"index=pid_ctime"`
+	Ctime   int64  `gorm:"index=pid_ctime"`
+	Utime   int64
+	// 评论审核模式
+	ModerationMode uint8
+	Comments       []Comment
 }
 
 type GROMPostDAO struct {
@@ -34,6 +45,25 @@ type PostDAO interface {
 	FindById(ctx context.Context, postId int64) (Post, error)
 	DeleteById(ctx context.Context, postId int64) error
 	List(ctx context.Context, userId int64, offset int, limit int) ([]Post, error)
+	UpdateModeration(ctx context.Context, postId int64, mode uint8) error
+	// ListByAuthor 作者的文章，按发布时间倒序
+	ListByAuthor(ctx context.Context, authorId int64, offset int, limit int) ([]Post, error)
+	CountByAuthor(ctx context.Context, authorId int64) (int64, error)
+	// FindByAuthor 作者的全部文章，按发布时间正序
+	FindByAuthor(ctx context.Context, authorId int64) ([]Post, error)
+	// ListRecent 最近发布的文章，authorId 不为 0 时只查该作者，tag 不为空时只查带该标签的
+	ListRecent(ctx context.Context, authorId int64, tag string, limit int) ([]Post, error)
+	// ListPublishedAfter 按ID顺序分批遍历文章，只查ID和更新时间
+	ListPublishedAfter(ctx context.Context, afterId int64, limit int) ([]Post, error)
+	// PublishedVersion 全部文章的摘要，文章新增、修改或删除后都会变化
+	PublishedVersion(ctx context.Context) (PublishedVersion, error)
+}
+
+type PublishedVersion struct {
+	Count    int64
+	MaxUtime int64
+	// 和数量、最大更新时间一起识别文章集合的变化
+	SumID int64
 }
 
 func (dao *GROMPostDAO) Create(ctx context.Context, post Post) (int64, error) {
@@ -41,31 +71,31 @@ func (dao *GROMPostDAO) Create(ctx context.Context, post Post) (int64, error) {
 	post.Ctime = now
 	post.Utime = now
 	err := dao.db.WithContext(ctx).Create(&post).Error
-	return post.ID, err
+	return post.ID, wrapErr(err)
 }
 
 func (dao *GROMPostDAO) UpdateById(ctx context.Context, post Post) error {
 	now := time.Now().UnixMilli()
 	post.Utime = now
-	res := dao.db.WithContext(ctx).Model(&post).Where("id = ?", post.ID).
-		Updates(map[string]any{
-			"title":   post.Title,
-			"content": post.Content,
-			"utime":   post.Utime,
-		})
+	updates := map[string]any{
+		"title":   post.Title,
+		"content": post.Content,
+		"utime":   post.Utime,
+	}
+	res := dao.db.WithContext(ctx).Model(&post).Where("id = ?", post.ID).Updates(updates)
 	if res.Error != nil {
 		return res.Error
 	}
 	if res.RowsAffected == 0 {
-		return fmt.Errorf("更新失败，可能创作者非法 id %d, author %d", post.ID, post.Author)
+		return errs.ErrForbidden.With(fmt.Errorf("更新失败，可能创作者非法 id %d, author %d", post.ID, post.Author))
 	}
-	return res.Error
+	return nil
 }
 
 func (dao *GROMPostDAO) FindById(ctx context.Context, postId int64) (Post, error) {
 	var p Post
 	err := dao.db.WithContext(ctx).Where("id=?", postId).First(&p).Error
-	return p, err
+	return p, wrapErr(err)
 }
 
 func (dao *GROMPostDAO) DeleteById(ctx context.Context, postId int64) error {
@@ -79,3 +109,56 @@ func (dao *GROMPostDAO) List(ctx context.Context, userId int64, offset int, limi
 	err := dao.db.WithContext(ctx).Offset(offset).Limit(limit).Order("utime desc").Find(&posts).Error
 	return posts, err
 }
+
+func (dao *GROMPostDAO) UpdateModeration(ctx context.Context, postId int64, mode uint8) error {
+	return dao.db.WithContext(ctx).Model(&Post{}).Where("id = ?", postId).
+		Update("moderation_mode", mode).Error
+}
+
+func (dao *GROMPostDAO) ListByAuthor(ctx context.Context, authorId int64, offset int, limit int) ([]Post, error) {
+	var posts []Post
+	err := dao.db.WithContext(ctx).Where("author = ?", authorId).
+		Offset(offset).Limit(limit).Order("ctime desc").Find(&posts).Error
+	return posts, err
+}
+
+func (dao *GROMPostDAO) CountByAuthor(ctx context.Context, authorId int64) (int64, error) {
+	var cnt int64
+	err := dao.db.WithContext(ctx).Model(&Post{}).Where("author = ?", authorId).Count(&cnt).Error
+	return cnt, err
+}
+
+func (dao *GROMPostDAO) FindByAuthor(ctx context.Context, authorId int64) ([]Post, error) {
+	var posts []Post
+	err := dao.db.WithContext(ctx).Where("author = ?", authorId).Order("ctime asc").Find(&posts).Error
+	return posts, err
+}
+
+func (dao *GROMPostDAO) ListRecent(ctx context.Context, authorId int64, tag string, limit int) ([]Post, error) {
+	var posts []Post
+	query := dao.db.WithContext(ctx)
+	if authorId != 0 {
+		query = query.Where("author = ?", authorId)
+	}
+	if tag != "" {
+		query = query.Where("id IN (?)", dao.db.Model(&PostTag{}).Select("post_id").Where("tag = ?", tag))
+	}
+	err := query.Order("ctime desc").Limit(limit).Find(&posts).Error
+	return posts, err
+}
+
+func (dao *GROMPostDAO) ListPublishedAfter(ctx context.Context, afterId int64, limit int) ([]Post, error) {
+	var posts []Post
+	err := dao.db.WithContext(ctx).Select("id", "utime").
+		Where("id > ?", afterId).
+		Order("id asc").Limit(limit).Find(&posts).Error
+	return posts, err
+}
+
+func (dao *GROMPostDAO) PublishedVersion(ctx context.Context) (PublishedVersion, error) {
+	var v PublishedVersion
+	err := dao.db.WithContext(ctx).Model(&Post{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(utime), 0) AS max_utime, COALESCE(SUM(id), 0) AS sum_id").
+		Scan(&v).Error
+	return v, err
+}
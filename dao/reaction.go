@@ -0,0 +1,106 @@
+package dao
+
+import (
+	"blog/errs"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Reaction struct {
+	ID        int64  `gorm:"primaryKey,autoIncrement"`
+	CommentID int64  `gorm:"not null;uniqueIndex:idx_comment_user_reaction"`
+	UserID    int64  `gorm:"not null;uniqueIndex:idx_comment_user_reaction"`
+	Reaction  string `gorm:"type:varchar(32);not null;uniqueIndex:idx_comment_user_reaction"`
+	Ctime     int64
+}
+
+type ReactionCount struct {
+	CommentID int64
+	Reaction  string
+	Count     int64
+}
+
+type GROMReactionDAO struct {
+	db *gorm.DB
+}
+
+func NewReactionDAO(db *gorm.DB) ReactionDAO {
+	res := &GROMReactionDAO{
+		db: db,
+	}
+	return res
+}
+
+type ReactionDAO interface {
+	// Toggle 已有则取消，没有则添加，返回操作后是否处于已添加状态
+	Toggle(ctx context.Context, commentId int64, userId int64, reaction string) (bool, error)
+	CountByComments(ctx context.Context, commentIds []int64) ([]ReactionCount, error)
+	FindByUser(ctx context.Context, commentIds []int64, userId int64) ([]Reaction, error)
+	ListUsers(ctx context.Context, commentId int64, reaction string, offset int, limit int) ([]Reaction, error)
+	// ListByUser 用户的全部表情回应
+	ListByUser(ctx context.Context, userId int64) ([]Reaction, error)
+}
+
+func (dao *GROMReactionDAO) Toggle(ctx context.Context, commentId int64, userId int64, reaction string) (bool, error) {
+	added := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var r Reaction
+		err := tx.Where("comment_id = ? AND user_id = ? AND reaction = ?", commentId, userId, reaction).First(&r).Error
+		if err == nil {
+			return tx.Delete(&r).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		added = true
+		return tx.Create(&Reaction{
+			CommentID: commentId,
+			UserID:    userId,
+			Reaction:  reaction,
+			Ctime:     time.Now().UnixMilli(),
+		}).Error
+	})
+	err = wrapErr(err)
+	if errors.Is(err, errs.ErrConflict) {
+		// 并发添加同一个表情时另一个请求先插入了，结果同样是已添加
+		return true, nil
+	}
+	return added, err
+}
+
+func (dao *GROMReactionDAO) CountByComments(ctx context.Context, commentIds []int64) ([]ReactionCount, error) {
+	var counts []ReactionCount
+	if len(commentIds) == 0 {
+		return counts, nil
+	}
+	err := dao.db.WithContext(ctx).Model(&Reaction{}).
+		Select("comment_id, reaction, COUNT(*) AS count").
+		Where("comment_id IN ?", commentIds).
+		Group("comment_id, reaction").
+		Scan(&counts).Error
+	return counts, err
+}
+
+func (dao *GROMReactionDAO) FindByUser(ctx context.Context, commentIds []int64, userId int64) ([]Reaction, error) {
+	var reactions []Reaction
+	if len(commentIds) == 0 {
+		return reactions, nil
+	}
+	err := dao.db.WithContext(ctx).Where("comment_id IN ? AND user_id = ?", commentIds, userId).Find(&reactions).Error
+	return reactions, err
+}
+
+func (dao *GROMReactionDAO) ListUsers(ctx context.Context, commentId int64, reaction string, offset int, limit int) ([]Reaction, error) {
+	var reactions []Reaction
+	err := dao.db.WithContext(ctx).Where("comment_id = ? AND reaction = ?", commentId, reaction).
+		Order("ctime asc").Offset(offset).Limit(limit).Find(&reactions).Error
+	return reactions, err
+}
+
+func (dao *GROMReactionDAO) ListByUser(ctx context.Context, userId int64) ([]Reaction, error) {
+	var reactions []Reaction
+	err := dao.db.WithContext(ctx).Where("user_id = ?", userId).Order("ctime asc").Find(&reactions).Error
+	return reactions, err
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGROMReactionDAO_Toggle(t *testing.T) {
+	findSQL := regexp.QuoteMeta("SELECT * FROM `reactions` WHERE comment_id = ? AND user_id = ? AND reaction = ?")
+	insertSQL := regexp.QuoteMeta("INSERT INTO `reactions`")
+	testCases := []struct {
+		name      string
+		mock      func(mock sqlmock.Sqlmock)
+		wantAdded bool
+		wantErr   error
+	}{
+		{
+			name: "添加",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findSQL).WithArgs(1, 2, "heart", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(insertSQL).WithArgs(1, 2, "heart", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectCommit()
+			},
+			wantAdded: true,
+		},
+		{
+			name: "取消",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findSQL).WithArgs(1, 2, "heart", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "comment_id", "user_id", "reaction"}).AddRow(5, 1, 2, "heart"))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `reactions` WHERE `reactions`.`id` = ?")).
+					WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "并发添加时唯一索引冲突视为已添加",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findSQL).WithArgs(1, 2, "heart", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(insertSQL).WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry"})
+				mock.ExpectRollback()
+			},
+			wantAdded: true,
+		},
+		{
+			name: "数据库错误",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findSQL).WithArgs(1, 2, "heart", 1).WillReturnError(assert.AnError)
+				mock.ExpectRollback()
+			},
+			wantErr: assert.AnError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tc.mock(mock)
+			added, err := NewReactionDAO(db).Toggle(context.Background(), 1, 2, "heart")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantAdded, added)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"blog/errs"
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// RecoveryCode 两步验证的恢复码，只能用一次，只保存哈希
+type RecoveryCode struct {
+	ID       int64  `gorm:"primaryKey,autoIncrement"`
+	UserID   int64  `gorm:"not null;index"`
+	CodeHash string `gorm:"type:char(64);not null"`
+	UsedAt   int64  `gorm:"not null;default:0"`
+	Ctime    int64
+}
+
+type GROMRecoveryCodeDAO struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeDAO(db *gorm.DB) RecoveryCodeDAO {
+	res := &GROMRecoveryCodeDAO{
+		db: db,
+	}
+	return res
+}
+
+type RecoveryCodeDAO interface {
+	// Replace 删除用户原有的恢复码并保存新的，hashes 为空时只删除
+	Replace(ctx context.Context, userId int64, hashes []string) error
+	// Consume 用掉一个恢复码，不存在或已使用时返回 errs.TOTPInvalid
+	Consume(ctx context.Context, userId int64, hash string) error
+}
+
+func (dao *GROMRecoveryCodeDAO) Replace(ctx context.Context, userId int64, hashes []string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		now := time.Now().UnixMilli()
+		codes := make([]RecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			codes = append(codes, RecoveryCode{UserID: userId, CodeHash: hash, Ctime: now})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (dao *GROMRecoveryCodeDAO) Consume(ctx context.Context, userId int64, hash string) error {
+	// 条件更新保证并发时只有一个请求能用掉恢复码
+	res := dao.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at = 0", userId, hash).
+		Update("used_at", time.Now().UnixMilli())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.TOTPInvalid
+	}
+	return nil
+}
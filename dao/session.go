@@ -0,0 +1,108 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session 一次登录，登录 token 中的 sid 对应 SID，吊销后该 token 立即失效
+type Session struct {
+	ID     int64  `gorm:"primaryKey,autoIncrement"`
+	UserID int64  `gorm:"not null;index"`
+	SID    string `gorm:"column:sid;type:varchar(64);not null;uniqueIndex"`
+	// UserAgent 和 IP 是登录时的，IP 在使用过程中会随 LastSeenAt 更新
+	UserAgent string `gorm:"type:varchar(255);not null;default:''"`
+	IP        string `gorm:"type:varchar(64);not null;default:''"`
+	// ExpiresAt 与 token 的过期时间一致，换发 token 时延长，毫秒时间戳
+	ExpiresAt  int64 `gorm:"not null"`
+	LastSeenAt int64 `gorm:"not null;default:0"`
+	RevokedAt  int64 `gorm:"not null;default:0"`
+	Ctime      int64
+}
+
+type GROMSessionDAO struct {
+	db *gorm.DB
+}
+
+func NewSessionDAO(db *gorm.DB) SessionDAO {
+	res := &GROMSessionDAO{
+		db: db,
+	}
+	return res
+}
+
+type SessionDAO interface {
+	Create(ctx context.Context, s Session) error
+	// FindBySID 不存在时返回 errs.ErrNotFound，调用方需要检查是否过期或吊销
+	FindBySID(ctx context.Context, sid string) (Session, error)
+	// ListActive 用户未吊销且未过期的会话，最近使用的在前
+	ListActive(ctx context.Context, userId int64) ([]Session, error)
+	// Extend 同一会话中换发 token 时延长过期时间
+	Extend(ctx context.Context, sid string, expiresAt int64) error
+	// Touch 记录最后使用时间和 IP
+	Touch(ctx context.Context, sid string, ip string) error
+	// Revoke 只能吊销自己的会话，不存在或已吊销时返回 errs.ErrNotFound
+	Revoke(ctx context.Context, userId int64, id int64) error
+	// RevokeBySID 退出登录时吊销当前会话
+	RevokeBySID(ctx context.Context, sid string) error
+	// RevokeOthers 吊销用户除 keepSID 以外的全部会话，keepSID 为空时全部吊销
+	RevokeOthers(ctx context.Context, userId int64, keepSID string) error
+}
+
+func (dao *GROMSessionDAO) Create(ctx context.Context, s Session) error {
+	s.Ctime = time.Now().UnixMilli()
+	return wrapErr(dao.db.WithContext(ctx).Create(&s).Error)
+}
+
+func (dao *GROMSessionDAO) FindBySID(ctx context.Context, sid string) (Session, error) {
+	var s Session
+	err := dao.db.WithContext(ctx).Where("sid = ?", sid).First(&s).Error
+	return s, wrapErr(err)
+}
+
+func (dao *GROMSessionDAO) ListActive(ctx context.Context, userId int64) ([]Session, error) {
+	var sessions []Session
+	err := dao.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at = 0 AND expires_at > ?", userId, time.Now().UnixMilli()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (dao *GROMSessionDAO) Extend(ctx context.Context, sid string, expiresAt int64) error {
+	return dao.db.WithContext(ctx).Model(&Session{}).
+		Where("sid = ? AND revoked_at = 0", sid).
+		Update("expires_at", expiresAt).Error
+}
+
+func (dao *GROMSessionDAO) Touch(ctx context.Context, sid string, ip string) error {
+	now := time.Now()
+	return dao.db.WithContext(ctx).Model(&Session{}).
+		Where("sid = ? AND last_seen_at < ?", sid, now.Add(-touchInterval).UnixMilli()).
+		Updates(map[string]any{"last_seen_at": now.UnixMilli(), "ip": ip}).Error
+}
+
+func (dao *GROMSessionDAO) Revoke(ctx context.Context, userId int64, id int64) error {
+	res := dao.db.WithContext(ctx).Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at = 0", id, userId).
+		Update("revoked_at", time.Now().UnixMilli())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return wrapErr(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (dao *GROMSessionDAO) RevokeBySID(ctx context.Context, sid string) error {
+	return dao.db.WithContext(ctx).Model(&Session{}).
+		Where("sid = ? AND revoked_at = 0", sid).
+		Update("revoked_at", time.Now().UnixMilli()).Error
+}
+
+func (dao *GROMSessionDAO) RevokeOthers(ctx context.Context, userId int64, keepSID string) error {
+	return dao.db.WithContext(ctx).Model(&Session{}).
+		Where("user_id = ? AND sid <> ? AND revoked_at = 0", userId, keepSID).
+		Update("revoked_at", time.Now().UnixMilli()).Error
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// PostTag 文章标签，标签统一保存为小写
+type PostTag struct {
+	ID     int64  `gorm:"primaryKey,autoIncrement"`
+	PostID int64  `gorm:"not null;uniqueIndex:idx_post_tag"`
+	Tag    string `gorm:"type:varchar(32);not null;uniqueIndex:idx_post_tag;index"`
+}
+
+type GROMTagDAO struct {
+	db *gorm.DB
+}
+
+func NewTagDAO(db *gorm.DB) TagDAO {
+	res := &GROMTagDAO{
+		db: db,
+	}
+	return res
+}
+
+type TagDAO interface {
+	// Replace 用新的标签整体替换文章原有的标签
+	Replace(ctx context.Context, postId int64, tags []string) error
+	FindByPosts(ctx context.Context, postIds []int64) ([]PostTag, error)
+}
+
+func (dao *GROMTagDAO) Replace(ctx context.Context, postId int64, tags []string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", postId).Delete(&PostTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		rows := make([]PostTag, 0, len(tags))
+		for _, tag := range tags {
+			rows = append(rows, PostTag{PostID: postId, Tag: tag})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (dao *GROMTagDAO) FindByPosts(ctx context.Context, postIds []int64) ([]PostTag, error) {
+	var tags []PostTag
+	if len(postIds) == 0 {
+		return tags, nil
+	}
+	err := dao.db.WithContext(ctx).Where("post_id IN ?", postIds).Order("id asc").Find(&tags).Error
+	return tags, err
+}
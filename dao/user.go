@@ -1,17 +1,56 @@
 package dao
 
 import (
+	"blog/errs"
 	"context"
 	"fmt"
 	"gorm.io/gorm"
+	"time"
 )
 
+const (
+	RoleMember uint8 = iota
+	RoleModerator
+	RoleAdmin
+)
+
+// GhostUsername 注销用户的评论转到这个占位用户名下，评论的外键仍然有效。
+// 用户名中有注册时不允许的字符，不会和真实用户冲突
+const GhostUsername = "[deleted]"
+
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
 	Email    string `gorm:"unique;not null"`
-	Comments []Comment
+	Role     uint8  `gorm:"not null;default:0"`
+	// 邮箱是否已验证，未验证不能发文章和评论
+	EmailVerified bool `gorm:"not null;default:false"`
+	// 修改密码时递增，签发时间更早的 token 全部失效
+	TokenVersion int64 `gorm:"not null;default:0"`
+	// 偏好的界面语言，为空时按 Accept-Language 协商
+	Locale string `gorm:"type:varchar(16);not null;default:''"`
+
+	// 公开资料
+	DisplayName string `gorm:"type:varchar(64);not null;default:''"`
+	Bio         string `gorm:"type:varchar(500);not null;default:''"`
+	Website     string `gorm:"type:varchar(255);not null;default:''"`
+	Avatar      string `gorm:"type:varchar(255);not null;default:''"`
+
+	// TOTP 两步验证，开启前 TOTPSecret 保存的是待确认的密钥
+	TOTPSecret  string `gorm:"column:totp_secret;type:varchar(64);not null;default:''"`
+	TOTPEnabled bool   `gorm:"column:totp_enabled;not null;default:false"`
+	// 最近一次用过的验证码周期序号，同一个验证码不能用两次
+	TOTPStep int64 `gorm:"column:totp_step;not null;default:0"`
+
+	// 申请注销后到期删除的时间，毫秒时间戳，为 0 表示没有申请
+	DeletionScheduledAt int64 `gorm:"not null;default:0;index"`
+	Comments            []Comment
+}
+
+// IsModerator 管理员同样拥有审核权限
+func (u User) IsModerator() bool {
+	return u.Role >= RoleModerator
 }
 
 type GROMUserDAO struct {
@@ -21,8 +60,36 @@ type GROMUserDAO struct {
 type UserDAO interface {
 	FindByUsername(ctx context.Context, username string) (User, error)
 	FindByEmail(ctx context.Context, email string) (User, error)
-	CreateUser(ctx context.Context, u User) error
+	CreateUser(ctx context.Context, u User) (int64, error)
 	FindById(ctx context.Context, id int64) (User, error)
+	FindByIds(ctx context.Context, ids []int64) ([]User, error)
+	MarkEmailVerified(ctx context.Context, id int64, email string) error
+	// UpdatePassword 更新密码并递增 TokenVersion
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateLocale(ctx context.Context, id int64, locale string) error
+	// UpdateProfile 更新公开资料，只更新不为 nil 的字段
+	UpdateProfile(ctx context.Context, id int64, p ProfileUpdate) error
+	// ScheduleDeletion at 为 0 时取消注销
+	ScheduleDeletion(ctx context.Context, id int64, at int64) error
+	// ListDeletionDue 注销时间已到、还没有删除的用户
+	ListDeletionDue(ctx context.Context, now int64, limit int) ([]User, error)
+	// SetTOTPSecret 保存待确认的密钥并关闭两步验证，secret 为空时即关闭两步验证
+	SetTOTPSecret(ctx context.Context, id int64, secret string) error
+	// EnableTOTP 确认密钥后开启两步验证，step 为确认时用掉的验证码周期
+	EnableTOTP(ctx context.Context, id int64, step int64) error
+	// UseTOTPStep 记录用掉的验证码周期，不大于上次的周期时返回 errs.TOTPInvalid
+	UseTOTPStep(ctx context.Context, id int64, step int64) error
+	// Erase 抹掉用户的个人信息并删除账号，评论保留并转到占位用户名下，
+	// 用户的文章连同其下其他人的评论、表情回应和提及一起删除
+	Erase(ctx context.Context, id int64) error
+}
+
+// ProfileUpdate 要更新的公开资料，为 nil 的字段保持不变，空字符串会清空该字段
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Website     *string
+	Avatar      *string
 }
 
 func NewUserDAO(db *gorm.DB) UserDAO {
@@ -35,23 +102,186 @@ func NewUserDAO(db *gorm.DB) UserDAO {
 func (dao *GROMUserDAO) FindByUsername(ctx context.Context, username string) (User, error) {
 	var u User
 	err := dao.db.WithContext(ctx).Where("username = ?", username).First(&u).Error
-	return u, err
+	return u, wrapErr(err)
 }
 
 func (dao *GROMUserDAO) FindByEmail(ctx context.Context, email string) (User, error) {
 	var u User
 	err := dao.db.WithContext(ctx).Where("email = ?", email).First(&u).Error
-	return u, err
+	return u, wrapErr(err)
 }
 
-func (dao *GROMUserDAO) CreateUser(ctx context.Context, u User) error {
+func (dao *GROMUserDAO) CreateUser(ctx context.Context, u User) (int64, error) {
 	err := dao.db.WithContext(ctx).Create(&u).Error
-	return err
+	return int64(u.ID), wrapErr(err)
 }
 
 func (dao *GROMUserDAO) FindById(ctx context.Context, id int64) (User, error) {
 	var u User
-	err := dao.db.Debug().WithContext(ctx).Where("id = ?", id).First(&u).Error
-	fmt.Println("error:", err)
-	return u, err
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&u).Error
+	return u, wrapErr(err)
+}
+
+func (dao *GROMUserDAO) FindByIds(ctx context.Context, ids []int64) ([]User, error) {
+	var users []User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := dao.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// MarkEmailVerified 只有邮箱没有变过时才标记，防止旧邮箱的验证链接验证新邮箱
+func (dao *GROMUserDAO) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).Where("id = ? AND email = ?", id, email).
+		Update("email_verified", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrNotFound.With(fmt.Errorf("验证邮箱失败，用户或邮箱不匹配 id %d", id))
+	}
+	return nil
+}
+
+func (dao *GROMUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"password":      password,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+}
+
+func (dao *GROMUserDAO) UpdateLocale(ctx context.Context, id int64, locale string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Update("locale", locale).Error
+}
+
+func (dao *GROMUserDAO) UpdateProfile(ctx context.Context, id int64, p ProfileUpdate) error {
+	updates := make(map[string]any, 4)
+	for column, value := range map[string]*string{
+		"display_name": p.DisplayName,
+		"bio":          p.Bio,
+		"website":      p.Website,
+		"avatar":       p.Avatar,
+	} {
+		if value != nil {
+			updates[column] = *value
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (dao *GROMUserDAO) ScheduleDeletion(ctx context.Context, id int64, at int64) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Update("deletion_scheduled_at", at).Error
+}
+
+func (dao *GROMUserDAO) ListDeletionDue(ctx context.Context, now int64, limit int) ([]User, error) {
+	var users []User
+	err := dao.db.WithContext(ctx).Where("deletion_scheduled_at > 0 AND deletion_scheduled_at <= ?", now).
+		Order("deletion_scheduled_at asc").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+func (dao *GROMUserDAO) SetTOTPSecret(ctx context.Context, id int64, secret string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"totp_secret":  secret,
+			"totp_enabled": false,
+			"totp_step":    0,
+		}).Error
+}
+
+func (dao *GROMUserDAO) EnableTOTP(ctx context.Context, id int64, step int64) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ? AND totp_secret <> ''", id).
+		Updates(map[string]any{
+			"totp_enabled": true,
+			"totp_step":    step,
+		}).Error
+}
+
+func (dao *GROMUserDAO) UseTOTPStep(ctx context.Context, id int64, step int64) error {
+	// 条件更新，并发提交同一个验证码时只有一个能成功
+	res := dao.db.WithContext(ctx).Model(&User{}).Where("id = ? AND totp_step < ?", id, step).
+		Update("totp_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.TOTPInvalid
+	}
+	return nil
+}
+
+func (dao *GROMUserDAO) Erase(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ghost, err := ghostUser(tx)
+		if err != nil {
+			return err
+		}
+		// 先删除挂在用户文章下的记录，再删文章，不留下指向不存在文章的评论、表情回应和提及
+		posts := tx.Model(&Post{}).Select("id").Where("author = ?", id)
+		comments := tx.Model(&Comment{}).Select("id").Where("post_id IN (?)", posts)
+		if err = tx.Where("comment_id IN (?)", comments).Delete(&Reaction{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&Mention{}, &PostTag{}, &Comment{}} {
+			if err = tx.Where("post_id IN (?)", posts).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err = tx.Where("author = ?", id).Delete(&Post{}).Error; err != nil {
+			return err
+		}
+
+		// 在其他文章下的评论匿名化，其他人的讨论不会断掉
+		if err = tx.Model(&Comment{}).Where("user_id = ?", id).Update("user_id", ghost.ID).Error; err != nil {
+			return err
+		}
+		if err = tx.Model(&Mention{}).Where("author_id = ?", id).Update("author_id", ghost.ID).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&Reaction{}, &Mention{}, &PasswordReset{}, &Media{}, &RecoveryCode{}, &Identity{}, &AccessToken{}, &Session{}} {
+			if err = tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// 用户名和邮箱有唯一索引，换成不会冲突的占位值
+		err = tx.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+			"username":              fmt.Sprintf("deleted-%d", id),
+			"email":                 fmt.Sprintf("deleted-%d@invalid", id),
+			"password":              "",
+			"email_verified":        false,
+			"locale":                "",
+			"display_name":          "",
+			"bio":                   "",
+			"website":               "",
+			"avatar":                "",
+			"deletion_scheduled_at": 0,
+			"totp_secret":           "",
+			"totp_enabled":          false,
+			"token_version":         gorm.Expr("token_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, id).Error
+	})
+}
+
+// ghostUser 查找或创建占位用户，它本身是已删除状态，不能登录，也没有资料页
+func ghostUser(tx *gorm.DB) (User, error) {
+	var ghost User
+	err := tx.Unscoped().Where("username = ?", GhostUsername).
+		Attrs(User{
+			Model:    gorm.Model{DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}},
+			Username: GhostUsername,
+			Email:    "ghost@invalid",
+		}).
+		FirstOrCreate(&ghost).Error
+	return ghost, err
 }
@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGROMUserDAO_Erase(t *testing.T) {
+	db, mock := newMockDB(t)
+	const userId, ghostId = 7, 99
+	userPosts := "(SELECT `id` FROM `posts` WHERE author = ?)"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE username = ?")).
+		WithArgs(GhostUsername, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(ghostId, GhostUsername))
+	// 用户文章下的记录先于文章删除
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `reactions` WHERE comment_id IN (SELECT `id` FROM `comments` WHERE post_id IN " + userPosts + ")")).
+		WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, table := range []string{"mentions", "post_tags", "comments"} {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `" + table + "` WHERE post_id IN " + userPosts)).
+			WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `posts` WHERE author = ?")).
+		WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 1))
+	// 其他文章下的评论转给占位用户，外键仍然有效
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `comments` SET `user_id`=? WHERE user_id = ?")).
+		WithArgs(ghostId, userId).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `mentions` SET `author_id`=? WHERE author_id = ?")).
+		WithArgs(ghostId, userId).WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range []string{"reactions", "mentions", "password_resets", "media", "recovery_codes", "identities", "access_tokens", "sessions"} {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `" + table + "` WHERE user_id = ?")).
+			WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `deleted_at`=? WHERE `users`.`id` = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := NewUserDAO(db).Erase(context.Background(), userId)
+	assert.NoError(t, err)
+}
+
+func TestGROMUserDAO_Erase_CreatesGhost(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE username = ?")).
+		WithArgs(GhostUsername, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// 占位用户创建出来就是已删除状态
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users`")).
+		WithArgs(append([]driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), notNull{}, GhostUsername, "", "ghost@invalid"},
+			anyArgs(12)...)...).
+		WillReturnResult(sqlmock.NewResult(99, 1))
+	mock.ExpectExec("DELETE FROM `reactions`").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	err := NewUserDAO(db).Erase(context.Background(), 7)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestGROMUserDAO_UpdateProfile(t *testing.T) {
+	bio, website := "新的简介", ""
+	testCases := []struct {
+		name   string
+		update ProfileUpdate
+		mock   func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "只更新传了的字段",
+			update: ProfileUpdate{Bio: &bio, Website: &website},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `bio`=?,`website`=?,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+					WithArgs(bio, website, sqlmock.AnyArg(), 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "没有要更新的字段",
+			mock: func(mock sqlmock.Sqlmock) {},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tc.mock(mock)
+			err := NewUserDAO(db).UpdateProfile(context.Background(), 7, tc.update)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// notNull 匹配非 NULL 的参数
+type notNull struct{}
+
+func (notNull) Match(v driver.Value) bool {
+	return v != nil
+}
+
+func anyArgs(n int) []driver.Value {
+	args := make([]driver.Value, n)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	return args
+}
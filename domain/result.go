@@ -3,5 +3,7 @@ package domain
 type Result struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
-	Data any    `json:"data"`
+	// Error 机器可读的错误码，成功时为空
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data"`
 }
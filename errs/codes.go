@@ -0,0 +1,59 @@
+package errs
+
+import "net/http"
+
+// 用户和登录
+var (
+	UserNotFound      = Define("user.not_found", http.StatusNotFound)
+	UsernameTaken     = Define("user.username_taken", http.StatusConflict)
+	EmailTaken        = Define("user.email_taken", http.StatusConflict)
+	InvalidCredential = Define("auth.invalid_credentials", http.StatusUnauthorized)
+	LoginThrottled    = Define("auth.login_throttled", http.StatusTooManyRequests)
+	WrongPassword     = Define("auth.wrong_password", http.StatusBadRequest)
+	PasswordIncorrect = Define("auth.password_incorrect", http.StatusBadRequest)
+	PasswordNotSet    = Define("auth.password_not_set", http.StatusConflict)
+	EmailUnverified   = Define("auth.email_unverified", http.StatusForbidden)
+	EmailVerified     = Define("auth.email_already_verified", http.StatusConflict)
+	VerifyLinkInvalid = Define("auth.verify_link_invalid", http.StatusBadRequest)
+	VerifyLinkExpired = Define("auth.verify_link_expired", http.StatusBadRequest)
+	ResetTokenInvalid = Define("auth.reset_token_invalid", http.StatusBadRequest)
+	AdminRequired     = Define("auth.admin_required", http.StatusForbidden)
+	TOTPInvalid       = Define("auth.totp_invalid", http.StatusBadRequest)
+	TOTPNotEnrolled   = Define("auth.totp_not_enrolled", http.StatusBadRequest)
+	TOTPEnabled       = Define("auth.totp_enabled", http.StatusConflict)
+	MFATokenInvalid   = Define("auth.mfa_token_invalid", http.StatusUnauthorized)
+	OIDCUnknown       = Define("auth.oidc_unknown_provider", http.StatusNotFound)
+	OIDCStateInvalid  = Define("auth.oidc_state_invalid", http.StatusBadRequest)
+	OIDCFailed        = Define("auth.oidc_failed", http.StatusUnauthorized)
+	OIDCEmailInvalid  = Define("auth.oidc_email_unverified", http.StatusForbidden)
+	OIDCEmailConflict = Define("auth.oidc_email_conflict", http.StatusConflict)
+	CSRFInvalid       = Define("auth.csrf_invalid", http.StatusForbidden)
+	SessionRequired   = Define("auth.session_required", http.StatusForbidden)
+	TokenScope        = Define("auth.token_scope", http.StatusForbidden)
+	TokenNotFound     = Define("token.not_found", http.StatusNotFound)
+	TokenLimit        = Define("token.limit", http.StatusConflict)
+	SessionNotFound   = Define("session.not_found", http.StatusNotFound)
+	LocaleUnsupported = Define("user.locale_unsupported", http.StatusBadRequest)
+)
+
+// 文章、评论和审核
+var (
+	PostNotFound       = Define("post.not_found", http.StatusNotFound)
+	PostForbidden      = Define("post.forbidden", http.StatusForbidden)
+	PostRejected       = Define("post.rejected", http.StatusUnprocessableEntity)
+	CommentNotFound    = Define("comment.not_found", http.StatusNotFound)
+	CommentRejected    = Define("comment.rejected", http.StatusUnprocessableEntity)
+	CommentStreamFull  = Define("comment.stream_full", http.StatusServiceUnavailable)
+	ReactionNotAllowed = Define("reaction.not_allowed", http.StatusBadRequest)
+	ModerationAction   = Define("moderation.invalid_action", http.StatusBadRequest)
+	ModerationBatch    = Define("moderation.invalid_batch", http.StatusBadRequest)
+	ModerationMode     = Define("moderation.invalid_mode", http.StatusBadRequest)
+	ModerationDenied   = Define("moderation.forbidden", http.StatusForbidden)
+)
+
+// 媒体文件
+var (
+	MediaTooLarge    = Define("media.too_large", http.StatusRequestEntityTooLarge)
+	MediaUnsupported = Define("media.unsupported_type", http.StatusUnsupportedMediaType)
+	MediaNotFound    = Define("media.not_found", http.StatusNotFound)
+)
@@ -0,0 +1,112 @@
+package errs
+
+import (
+	"blog/i18n"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Code 稳定的机器可读错误码，客户端应根据它而不是提示文案做判断
+type Code string
+
+type Error struct {
+	Code   Code
+	Status int
+	// Args 格式化提示文案的参数，文案模板在 i18n 的语言文件中，键为错误码
+	Args []any
+	// Data 随错误一起返回给客户端的详细信息，如字段校验错误
+	Data any
+	// Err 原始错误，只记录日志，不返回给客户端
+	Err error
+}
+
+var registry = make(map[Code]*Error)
+
+// Define 定义一个错误码，同一个错误码只能定义一次，提示文案写在 i18n 的语言文件中
+func Define(code Code, status int) *Error {
+	if _, ok := registry[code]; ok {
+		panic(fmt.Sprintf("错误码重复定义: %s", code))
+	}
+	e := &Error{Code: code, Status: status}
+	registry[code] = e
+	return e
+}
+
+// All 所有已定义的错误，按错误码排序
+func All() []*Error {
+	res := make([]*Error, 0, len(registry))
+	for _, e := range registry {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Code < res[j].Code
+	})
+	return res
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code) + ": " + e.Message()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 错误码相同即视为同一个错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Message 默认语言下格式化后的提示文案，用于日志
+func (e *Error) Message() string {
+	return i18n.T(i18n.Default, string(e.Code), e.Args...)
+}
+
+// With 附上原始错误
+func (e *Error) With(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithArgs 附上格式化提示文案的参数
+func (e *Error) WithArgs(args ...any) *Error {
+	c := *e
+	c.Args = args
+	return &c
+}
+
+// WithData 附上返回给客户端的详细信息
+func (e *Error) WithData(data any) *Error {
+	c := *e
+	c.Data = data
+	return &c
+}
+
+// From 把任意错误转换为 *Error，无法识别的视为内部错误
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.With(err)
+}
+
+// 通用错误，DAO 层的错误会被转换为这些错误
+var (
+	ErrInvalidArgument = Define("invalid_argument", http.StatusBadRequest)
+	ErrUnauthenticated = Define("unauthenticated", http.StatusUnauthorized)
+	ErrForbidden       = Define("forbidden", http.StatusForbidden)
+	ErrNotFound        = Define("not_found", http.StatusNotFound)
+	ErrConflict        = Define("conflict", http.StatusConflict)
+	ErrTooManyRequests = Define("too_many_requests", http.StatusTooManyRequests)
+	ErrInternal        = Define("internal", http.StatusInternalServerError)
+	ErrUnavailable     = Define("unavailable", http.StatusServiceUnavailable)
+)
@@ -0,0 +1,67 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrom(t *testing.T) {
+	cause := errors.New("connection refused")
+	testCases := []struct {
+		name       string
+		err        error
+		wantCode   Code
+		wantStatus int
+	}{
+		{
+			name:       "已定义的错误",
+			err:        ErrNotFound,
+			wantCode:   "not_found",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "被包装的错误",
+			err:        fmt.Errorf("查询用户: %w", ErrConflict.With(cause)),
+			wantCode:   "conflict",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "未知错误视为内部错误",
+			err:        cause,
+			wantCode:   "internal",
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := From(tc.err)
+			assert.Equal(t, tc.wantCode, e.Code)
+			assert.Equal(t, tc.wantStatus, e.Status)
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	cause := errors.New("record not found")
+	err := ErrNotFound.With(cause)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, ErrConflict))
+	// 复制出来的错误不影响原始定义
+	assert.Nil(t, ErrNotFound.Err)
+}
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "登录失败次数过多，请 30 秒后再试", LoginThrottled.WithArgs(30).Message())
+	assert.Equal(t, "用户不存在", UserNotFound.Message())
+}
+
+func TestDefineDuplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		Define("not_found", http.StatusNotFound)
+	})
+}
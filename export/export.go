@@ -0,0 +1,178 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Archive 导出给用户本人的全部数据
+type Archive struct {
+	Profile   Profile    `json:"profile"`
+	Posts     []Post     `json:"posts"`
+	Comments  []Comment  `json:"comments"`
+	Reactions []Reaction `json:"reactions"`
+	Media     []Media    `json:"media"`
+	// 导出时间
+	Generated time.Time `json:"generated"`
+}
+
+type Profile struct {
+	Id            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"emailVerified"`
+	DisplayName   string    `json:"displayName"`
+	Bio           string    `json:"bio"`
+	Website       string    `json:"website"`
+	Avatar        string    `json:"avatar"`
+	Locale        string    `json:"locale"`
+	Joined        time.Time `json:"joined"`
+}
+
+type Post struct {
+	Id      int64     `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Ctime   time.Time `json:"ctime"`
+	Utime   time.Time `json:"utime"`
+}
+
+type Comment struct {
+	Id      int64     `json:"id"`
+	PostId  int64     `json:"postId"`
+	Content string    `json:"content"`
+	Status  string    `json:"status"`
+	Ctime   time.Time `json:"ctime"`
+}
+
+type Reaction struct {
+	CommentId int64     `json:"commentId"`
+	Reaction  string    `json:"reaction"`
+	Ctime     time.Time `json:"ctime"`
+}
+
+type Media struct {
+	URL      string    `json:"url"`
+	Filename string    `json:"filename"`
+	Mime     string    `json:"mime"`
+	Size     int64     `json:"size"`
+	Ctime    time.Time `json:"ctime"`
+}
+
+// Write 把数据写成 ZIP：每类数据一个 JSON 文件，文章和评论另外生成便于阅读的 Markdown
+func Write(w io.Writer, a Archive) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", a.Profile},
+		{"posts.json", a.Posts},
+		{"comments.json", a.Comments},
+		{"reactions.json", a.Reactions},
+		{"media.json", a.Media},
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, a.Generated, f.data); err != nil {
+			return err
+		}
+	}
+	for _, p := range a.Posts {
+		if err := writeFile(zw, postFilename(p), a.Generated, postMarkdown(p)); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(zw, "comments.md", a.Generated, commentsMarkdown(a.Comments)); err != nil {
+		return err
+	}
+	if err := writeFile(zw, "README.md", a.Generated, readme(a)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, modified time.Time, data any) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func writeFile(zw *zip.Writer, name string, modified time.Time, content string) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+var unsafeChars = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// postFilename 文件名带上标题方便查找，去掉路径分隔符等不安全的字符
+func postFilename(p Post) string {
+	slug := strings.Trim(unsafeChars.ReplaceAllString(p.Title, "-"), "-")
+	if r := []rune(slug); len(r) > 50 {
+		slug = strings.TrimRight(string(r[:50]), "-")
+	}
+	if slug == "" {
+		return fmt.Sprintf("posts/%d.md", p.Id)
+	}
+	return fmt.Sprintf("posts/%d-%s.md", p.Id, slug)
+}
+
+func postMarkdown(p Post) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	fmt.Fprintf(&sb, "id: %d\n", p.Id)
+	fmt.Fprintf(&sb, "title: %s\n", quote(p.Title))
+	fmt.Fprintf(&sb, "created: %s\n", p.Ctime.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "updated: %s\n", p.Utime.Format(time.RFC3339))
+	sb.WriteString("---\n\n")
+	fmt.Fprintf(&sb, "# %s\n\n", p.Title)
+	sb.WriteString(p.Content)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func commentsMarkdown(comments []Comment) string {
+	var sb strings.Builder
+	sb.WriteString("# 评论\n")
+	for _, c := range comments {
+		fmt.Fprintf(&sb, "\n## 文章 %d · %s\n\n", c.PostId, c.Ctime.Format(time.RFC3339))
+		if c.Status != "" {
+			fmt.Fprintf(&sb, "状态：%s\n\n", c.Status)
+		}
+		for _, line := range strings.Split(c.Content, "\n") {
+			fmt.Fprintf(&sb, "> %s\n", line)
+		}
+	}
+	return sb.String()
+}
+
+func readme(a Archive) string {
+	return fmt.Sprintf(`# %s 的数据导出
+
+导出时间：%s
+
+- profile.json：个人资料
+- posts.json、posts/*.md：%d 篇文章
+- comments.json、comments.md：%d 条评论
+- reactions.json：%d 个表情回应
+- media.json：%d 个上传的文件
+`, a.Profile.Username, a.Generated.Format(time.RFC3339), len(a.Posts), len(a.Comments), len(a.Reactions), len(a.Media))
+}
+
+// quote 用 JSON 字符串的转义规则，YAML 也能正确解析
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
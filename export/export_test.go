@@ -0,0 +1,67 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := make(map[string]string, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	a := Archive{
+		Profile: Profile{Id: 1, Username: "xiang", Email: "x@example.com", Joined: now},
+		Posts: []Post{
+			{Id: 3, Title: "Hello, 世界/../", Content: "正文", Ctime: now, Utime: now},
+			{Id: 4, Title: "///", Content: "无标题", Ctime: now, Utime: now},
+		},
+		Comments: []Comment{
+			{Id: 9, PostId: 3, Content: "第一行\n第二行", Status: "approved", Ctime: now},
+		},
+		Reactions: []Reaction{{CommentId: 9, Reaction: "like", Ctime: now}},
+		Generated: now,
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, a))
+	files := readZip(t, buf.Bytes())
+
+	for _, name := range []string{"profile.json", "posts.json", "comments.json", "reactions.json", "media.json", "comments.md", "README.md"} {
+		assert.Contains(t, files, name)
+	}
+
+	var profile Profile
+	require.NoError(t, json.Unmarshal([]byte(files["profile.json"]), &profile))
+	assert.Equal(t, a.Profile, profile)
+
+	var posts []Post
+	require.NoError(t, json.Unmarshal([]byte(files["posts.json"]), &posts))
+	assert.Equal(t, a.Posts, posts)
+
+	// 标题中的路径分隔符不能出现在文件名里
+	post := files["posts/3-Hello-世界.md"]
+	assert.Contains(t, post, `title: "Hello, 世界/../"`)
+	assert.Contains(t, post, "正文")
+	assert.Contains(t, files, "posts/4.md")
+
+	assert.Contains(t, files["comments.md"], "> 第一行\n> 第二行\n")
+}
@@ -0,0 +1,113 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFeed() Feed {
+	t := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	return Feed{
+		Title:       "博客",
+		Description: "最新文章",
+		Link:        "https://blog.example.com",
+		Self:        "https://blog.example.com/feed.xml",
+		Updated:     t,
+		Items: []Item{
+			{
+				ID:         "https://blog.example.com/posts/1",
+				Title:      "<Go> & 你",
+				Link:       "https://blog.example.com/posts/1",
+				Author:     "xiang",
+				Content:    "正文 <script>alert(1)</script>",
+				Categories: []string{"go", "web"},
+				Published:  t,
+				Updated:    t.Add(time.Hour),
+			},
+		},
+	}
+}
+
+func TestRSS(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, RSS(&buf, testFeed()))
+
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title      string   `xml:"title"`
+				GUID       string   `xml:"guid"`
+				Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Categories []string `xml:"category"`
+				Desc       string   `xml:"description"`
+				PubDate    string   `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "博客", doc.Channel.Title)
+	require.Len(t, doc.Channel.Items, 1)
+	item := doc.Channel.Items[0]
+	assert.Equal(t, "<Go> & 你", item.Title)
+	assert.Equal(t, "xiang", item.Creator)
+	assert.Equal(t, []string{"go", "web"}, item.Categories)
+	assert.Equal(t, "正文 <script>alert(1)</script>", item.Desc)
+	assert.Equal(t, "Wed, 01 May 2024 08:00:00 +0000", item.PubDate)
+	// 原文中的标签必须被转义
+	assert.NotContains(t, buf.String(), "<script>")
+}
+
+func TestAtom(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Atom(&buf, testFeed()))
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Updated string `xml:"updated"`
+			Author  string `xml:"author>name"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "2024-05-01T08:00:00Z", doc.Updated)
+	require.Len(t, doc.Entries, 1)
+	assert.Equal(t, "https://blog.example.com/posts/1", doc.Entries[0].ID)
+	assert.Equal(t, "2024-05-01T09:00:00Z", doc.Entries[0].Updated)
+	assert.Equal(t, "xiang", doc.Entries[0].Author)
+	assert.Contains(t, doc.Entries[0].Content, "正文")
+}
+
+func TestJSON(t *testing.T) {
+	f := testFeed()
+	// 摘要模式下只有 summary
+	f.Items[0].Summary = Summarize(f.Items[0].Content, 2)
+	f.Items[0].Content = ""
+	var buf bytes.Buffer
+	require.NoError(t, JSON(&buf, f))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", doc["version"])
+	items := doc["items"].([]any)
+	require.Len(t, items, 1)
+	item := items[0].(map[string]any)
+	assert.Equal(t, "正文…", item["summary"])
+	assert.Equal(t, "正文…", item["content_text"])
+	assert.Equal(t, []any{"go", "web"}, item["tags"])
+}
+
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, "短文", Summarize("短文", 10))
+	assert.Equal(t, "一二三…", Summarize("一二三四五", 3))
+	assert.Equal(t, "a b", Summarize("  a\n\n b ", 10))
+}
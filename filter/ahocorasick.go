@@ -0,0 +1,110 @@
+package filter
+
+// Automaton Aho-Corasick 多模式匹配自动机，构建后只读，可并发使用
+type Automaton struct {
+	nodes    []acNode
+	patterns []string
+}
+
+type acNode struct {
+	next map[rune]int
+	fail int
+	// 以该节点结尾的模式下标，包含沿失败指针能到达的
+	out []int
+}
+
+// Match 命中的模式及其在文本中的 rune 位置
+type Match struct {
+	Pattern string
+	Start   int
+	End     int
+}
+
+func NewAutomaton(patterns []string) *Automaton {
+	a := &Automaton{
+		nodes: []acNode{{next: make(map[rune]int)}},
+	}
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		a.insert(p)
+	}
+	a.build()
+	return a
+}
+
+func (a *Automaton) insert(pattern string) {
+	cur := 0
+	for _, r := range pattern {
+		nxt, ok := a.nodes[cur].next[r]
+		if !ok {
+			a.nodes = append(a.nodes, acNode{next: make(map[rune]int)})
+			nxt = len(a.nodes) - 1
+			a.nodes[cur].next[r] = nxt
+		}
+		cur = nxt
+	}
+	a.nodes[cur].out = append(a.nodes[cur].out, len(a.patterns))
+	a.patterns = append(a.patterns, pattern)
+}
+
+// build 按 BFS 计算失败指针
+func (a *Automaton) build() {
+	queue := make([]int, 0, len(a.nodes))
+	for _, child := range a.nodes[0].next {
+		a.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range a.nodes[cur].next {
+			f := a.nodes[cur].fail
+			for f > 0 {
+				if _, ok := a.nodes[f].next[r]; ok {
+					break
+				}
+				f = a.nodes[f].fail
+			}
+			if nxt, ok := a.nodes[f].next[r]; ok && nxt != child {
+				a.nodes[child].fail = nxt
+			} else {
+				a.nodes[child].fail = 0
+			}
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[a.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// Len 模式数量
+func (a *Automaton) Len() int {
+	return len(a.patterns)
+}
+
+// FindAll 返回文本中所有命中的模式，limit 大于 0 时最多返回 limit 个
+func (a *Automaton) FindAll(text []rune, limit int) []Match {
+	var res []Match
+	cur := 0
+	for i, r := range text {
+		for cur > 0 {
+			if _, ok := a.nodes[cur].next[r]; ok {
+				break
+			}
+			cur = a.nodes[cur].fail
+		}
+		if nxt, ok := a.nodes[cur].next[r]; ok {
+			cur = nxt
+		}
+		for _, idx := range a.nodes[cur].out {
+			p := a.patterns[idx]
+			n := len([]rune(p))
+			res = append(res, Match{Pattern: p, Start: i - n + 1, End: i + 1})
+			if limit > 0 && len(res) >= limit {
+				return res
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutomaton(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		text     string
+		want     []Match
+	}{
+		{
+			name:     "经典用例",
+			patterns: []string{"he", "she", "his", "hers"},
+			text:     "ushers",
+			want: []Match{
+				{Pattern: "she", Start: 1, End: 4},
+				{Pattern: "he", Start: 2, End: 4},
+				{Pattern: "hers", Start: 2, End: 6},
+			},
+		},
+		{
+			name:     "中文",
+			patterns: []string{"赌博", "博彩"},
+			text:     "线上赌博彩票",
+			want: []Match{
+				{Pattern: "赌博", Start: 2, End: 4},
+				{Pattern: "博彩", Start: 3, End: 5},
+			},
+		},
+		{
+			name:     "没有命中",
+			patterns: []string{"abc"},
+			text:     "ababab",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAutomaton(tc.patterns)
+			assert.Equal(t, tc.want, a.FindAll([]rune(tc.text), 0))
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	words := NewSensitiveWordFilter([]string{"代开发票"}, Reject)
+	chain := NewChain(LinkFilter{HoldAt: 2, RejectAt: 5}, words)
+	testCases := []struct {
+		name    string
+		content Content
+		want    Verdict
+	}{
+		{name: "正常内容", content: Content{Body: "写得不错 https://example.com"}, want: Allow},
+		{name: "链接较多", content: Content{Body: "https://a.com www.b.com"}, want: Hold},
+		{name: "敏感词绕过", content: Content{Body: "代 开-发票"}, want: Reject},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := chain.Check(context.Background(), tc.content)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, d.Verdict)
+		})
+	}
+
+	words.Reload(nil)
+	d, err := chain.Check(context.Background(), Content{Body: "代开发票"})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Verdict)
+}
@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DuplicateFilter 识别短时间内重复发布的内容：同一用户重复发布直接拒绝，
+// 多个用户发布相同内容（常见于刷屏机器人）转人工审核
+type DuplicateFilter struct {
+	window time.Duration
+	// 发布相同内容的不同用户数达到该值时转人工审核
+	users int
+
+	mu   sync.Mutex
+	seen map[[sha256.Size]byte]map[int64]time.Time
+	// 上次清理过期记录的时间
+	swept time.Time
+}
+
+func NewDuplicateFilter(window time.Duration, users int) *DuplicateFilter {
+	return &DuplicateFilter{
+		window: window,
+		users:  users,
+		seen:   make(map[[sha256.Size]byte]map[int64]time.Time),
+	}
+}
+
+func (f *DuplicateFilter) Name() string {
+	return "duplicate"
+}
+
+func (f *DuplicateFilter) Check(ctx context.Context, c Content) (Decision, error) {
+	if c.Update {
+		return Decision{Verdict: Allow}, nil
+	}
+	text := normalize(c.Text())
+	// 太短的内容（如"顶"、"+1"）重复很正常
+	if len(text) < 8 {
+		return Decision{Verdict: Allow}, nil
+	}
+	key := sha256.Sum256([]byte(c.Kind + ":" + string(text)))
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sweep(now)
+	users, ok := f.seen[key]
+	if !ok {
+		users = make(map[int64]time.Time)
+		f.seen[key] = users
+	}
+	last, dup := users[c.UserID]
+	users[c.UserID] = now
+	if dup && now.Sub(last) < f.window {
+		return Decision{Verdict: Reject, Reason: reasonDuplicate}, nil
+	}
+	if f.users > 0 && len(users) >= f.users {
+		return Decision{Verdict: Hold, Reason: reasonSharedContent}, nil
+	}
+	return Decision{Verdict: Allow}, nil
+}
+
+func (f *DuplicateFilter) sweep(now time.Time) {
+	if now.Sub(f.swept) < f.window {
+		return
+	}
+	f.swept = now
+	for key, users := range f.seen {
+		for uid, t := range users {
+			if now.Sub(t) >= f.window {
+				delete(users, uid)
+			}
+		}
+		if len(users) == 0 {
+			delete(f.seen, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateFilter(t *testing.T) {
+	const text = "Buy cheap watches online now"
+	type step struct {
+		content Content
+		want    Verdict
+	}
+	testCases := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "同一用户重复发布",
+			steps: []step{
+				{content: Content{Kind: KindComment, UserID: 1, Body: text}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 1, Body: text}, want: Reject},
+			},
+		},
+		{
+			name: "只有标点和大小写不同也算重复",
+			steps: []step{
+				{content: Content{Kind: KindComment, UserID: 1, Body: text}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 1, Body: "buy CHEAP watches, online now!"}, want: Reject},
+			},
+		},
+		{
+			name: "多个用户发布相同内容达到阈值转人工审核",
+			steps: []step{
+				{content: Content{Kind: KindComment, UserID: 1, Body: text}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 2, Body: text}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 3, Body: text}, want: Hold},
+			},
+		},
+		{
+			name: "太短的内容不检查",
+			steps: []step{
+				{content: Content{Kind: KindComment, UserID: 1, Body: "+1"}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 1, Body: "+1"}, want: Allow},
+			},
+		},
+		{
+			name: "文章和评论分开计算",
+			steps: []step{
+				{content: Content{Kind: KindPost, UserID: 1, Body: text}, want: Allow},
+				{content: Content{Kind: KindComment, UserID: 1, Body: text}, want: Allow},
+			},
+		},
+		{
+			name: "修改已有内容不检查",
+			steps: []step{
+				{content: Content{Kind: KindPost, UserID: 1, PostID: 1, Body: text}, want: Allow},
+				{content: Content{Kind: KindPost, UserID: 1, PostID: 1, Update: true, Body: text}, want: Allow},
+				{content: Content{Kind: KindPost, UserID: 1, PostID: 1, Update: true, Body: text}, want: Allow},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewDuplicateFilter(time.Minute, 3)
+			for i, s := range tc.steps {
+				d, err := f.Check(context.Background(), s.content)
+				require.NoError(t, err)
+				assert.Equal(t, s.want, d.Verdict, "第 %d 次", i+1)
+			}
+		})
+	}
+}
+
+func TestDuplicateFilter_Window(t *testing.T) {
+	f := NewDuplicateFilter(50*time.Millisecond, 0)
+	c := Content{Kind: KindComment, UserID: 1, Body: "Buy cheap watches online now"}
+	d, err := f.Check(context.Background(), c)
+	require.NoError(t, err)
+	assert.Equal(t, Allow, d.Verdict)
+
+	// 超过时间窗口后可以再次发布
+	time.Sleep(60 * time.Millisecond)
+	d, err = f.Check(context.Background(), c)
+	require.NoError(t, err)
+	assert.Equal(t, Allow, d.Verdict)
+}
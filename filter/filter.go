@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"blog/i18n"
+	"context"
+	"go.uber.org/zap"
+)
+
+type Verdict uint8
+
+const (
+	Allow Verdict = iota
+	// Hold 先保存但需要人工审核
+	Hold
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allow:
+		return "allow"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+)
+
+// Content 待检查的内容
+type Content struct {
+	Kind   string
+	UserID int64
+	PostID int64
+	// Update 修改已有的内容，原样保存不算重复发布
+	Update bool
+	Title  string
+	Body   string
+}
+
+// Text 标题和正文一起检查
+func (c Content) Text() string {
+	if c.Title == "" {
+		return c.Body
+	}
+	return c.Title + "\n" + c.Body
+}
+
+// 判断原因的文案键，翻译在 i18n/locales 中
+var (
+	reasonSensitive     = i18n.Key("filter.sensitive")
+	reasonTooManyLinks  = i18n.Key("filter.too_many_links")
+	reasonManyLinks     = i18n.Key("filter.many_links")
+	reasonDuplicate     = i18n.Key("filter.duplicate")
+	reasonSharedContent = i18n.Key("filter.shared_content")
+)
+
+type Decision struct {
+	Verdict Verdict
+	// Reason 判断原因的文案键，Args 为文案参数
+	Reason string
+	Args   []any
+	// 做出判断的过滤器
+	Filter string
+}
+
+// Message 判断原因，拒绝时作为错误提示的参数，按请求的语言翻译
+func (d Decision) Message() i18n.Message {
+	return i18n.Message{Key: d.Reason, Args: d.Args}
+}
+
+// Filter 内容过滤器，新的分类器实现这个接口后加入 Chain 即可
+type Filter interface {
+	Name() string
+	Check(ctx context.Context, c Content) (Decision, error)
+}
+
+// Chain 依次执行过滤器，遇到 Reject 立即返回，否则返回最严格的结果
+type Chain struct {
+	filters []Filter
+}
+
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+func (c *Chain) Use(f Filter) *Chain {
+	c.filters = append(c.filters, f)
+	return c
+}
+
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+// Check 单个过滤器出错时跳过它，不影响正常发布
+func (c *Chain) Check(ctx context.Context, content Content) (Decision, error) {
+	res := Decision{Verdict: Allow}
+	for _, f := range c.filters {
+		d, err := f.Check(ctx, content)
+		if err != nil {
+			zap.L().Error("内容过滤器执行失败", zap.Error(err), zap.String("filter", f.Name()))
+			continue
+		}
+		if d.Filter == "" {
+			d.Filter = f.Name()
+		}
+		if d.Verdict == Reject {
+			return d, nil
+		}
+		if d.Verdict > res.Verdict {
+			res = d
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"context"
+	"regexp"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)[^\s]+`)
+
+// LinkFilter 按链接数量判断，垃圾内容通常带有大量外链
+type LinkFilter struct {
+	// 链接数达到 HoldAt 时转人工审核，达到 RejectAt 时直接拒绝，为 0 表示不启用
+	HoldAt   int
+	RejectAt int
+}
+
+func (f LinkFilter) Name() string {
+	return "link_count"
+}
+
+func (f LinkFilter) Check(ctx context.Context, c Content) (Decision, error) {
+	cnt := len(linkPattern.FindAllStringIndex(c.Text(), -1))
+	if f.RejectAt > 0 && cnt >= f.RejectAt {
+		return Decision{Verdict: Reject, Reason: reasonTooManyLinks, Args: []any{cnt}}, nil
+	}
+	if f.HoldAt > 0 && cnt >= f.HoldAt {
+		return Decision{Verdict: Hold, Reason: reasonManyLinks, Args: []any{cnt}}, nil
+	}
+	return Decision{Verdict: Allow}, nil
+}
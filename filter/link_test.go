@@ -0,0 +1,35 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkFilter(t *testing.T) {
+	links := func(n int) string {
+		return strings.Repeat("看看 https://spam.example.com/x ", n)
+	}
+	testCases := []struct {
+		name   string
+		filter LinkFilter
+		body   string
+		want   Verdict
+	}{
+		{name: "低于阈值", filter: LinkFilter{HoldAt: 3, RejectAt: 10}, body: links(2), want: Allow},
+		{name: "达到转人工审核阈值", filter: LinkFilter{HoldAt: 3, RejectAt: 10}, body: links(3), want: Hold},
+		{name: "达到拒绝阈值", filter: LinkFilter{HoldAt: 3, RejectAt: 10}, body: links(10), want: Reject},
+		{name: "www 开头也算链接", filter: LinkFilter{HoldAt: 2}, body: "www.a.com 和 WWW.b.com", want: Hold},
+		{name: "阈值为 0 不启用", filter: LinkFilter{}, body: links(20), want: Allow},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := tc.filter.Check(context.Background(), Content{Kind: KindComment, Body: tc.body})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, d.Verdict)
+		})
+	}
+}
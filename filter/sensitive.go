@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// SensitiveWordFilter 敏感词过滤，词表可以在运行时重新加载
+type SensitiveWordFilter struct {
+	automaton atomic.Pointer[Automaton]
+	// 命中后的处理方式
+	verdict Verdict
+}
+
+func NewSensitiveWordFilter(words []string, verdict Verdict) *SensitiveWordFilter {
+	f := &SensitiveWordFilter{verdict: verdict}
+	f.Reload(words)
+	return f
+}
+
+func (f *SensitiveWordFilter) Name() string {
+	return "sensitive_word"
+}
+
+// Reload 原子地替换词表，正在进行的检查仍使用旧词表
+func (f *SensitiveWordFilter) Reload(words []string) {
+	normalized := make([]string, 0, len(words))
+	for _, w := range words {
+		w = string(normalize(w))
+		if w != "" {
+			normalized = append(normalized, w)
+		}
+	}
+	f.automaton.Store(NewAutomaton(normalized))
+}
+
+// LoadFile 从文件加载词表，每行一个词，# 开头的行为注释
+func (f *SensitiveWordFilter) LoadFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	f.Reload(words)
+	return len(words), nil
+}
+
+func (f *SensitiveWordFilter) Check(ctx context.Context, c Content) (Decision, error) {
+	a := f.automaton.Load()
+	if a == nil || a.Len() == 0 {
+		return Decision{Verdict: Allow}, nil
+	}
+	if len(a.FindAll(normalize(c.Text()), 1)) > 0 {
+		return Decision{Verdict: f.verdict, Reason: reasonSensitive}, nil
+	}
+	return Decision{Verdict: Allow}, nil
+}
+
+// normalize 统一小写并去掉空白和标点，避免用 "敏 感-词" 这类写法绕过
+func normalize(s string) []rune {
+	res := make([]rune, 0, len(s))
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			res = append(res, unicode.ToLower(r))
+		}
+	}
+	return res
+}
@@ -0,0 +1,154 @@
+package guard
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type Policy struct {
+	// 前 FreeAttempts 次失败不需要等待
+	FreeAttempts int
+	// 之后每次失败的等待时间从 BaseDelay 开始翻倍，最多 MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// 连续失败 LockAfter 次后锁定 LockDuration，为 0 表示不锁定
+	LockAfter    int
+	LockDuration time.Duration
+	// 最后一次失败超过 Forget 后清零
+	Forget time.Duration
+}
+
+// LoginGuard 分别按账号和 IP 记录登录失败次数，失败越多需要等待越久，超过阈值临时锁定
+type LoginGuard struct {
+	store   Store
+	account Policy
+	ip      Policy
+}
+
+func NewLoginGuard(store Store, account Policy, ip Policy) *LoginGuard {
+	return &LoginGuard{store: store, account: account, ip: ip}
+}
+
+// Check 检查是否需要等待，不需要时先把这次尝试记为一次失败，成功后再由 Succeed 或 Release 撤销。
+// 检查和计数在同一次原子更新中完成，并发的尝试各自占用一次次数，不会在记录失败之前一起通过检查。
+// 不存在的用户名同样记录，避免通过是否锁定判断账号是否存在。返回还需要等待的时间，为 0 表示可以尝试登录
+func (g *LoginGuard) Check(ctx context.Context, username string, ip string) (time.Duration, error) {
+	now := time.Now()
+	keys := g.keys(username, ip)
+	for i, k := range keys {
+		p := k.policy
+		var wait time.Duration
+		err := g.store.Update(ctx, k.key, p.Forget+p.LockDuration, func(r *Record) {
+			if wait = p.wait(*r, now); wait == 0 {
+				p.reserve(r, now)
+			}
+		})
+		if err == nil && wait == 0 {
+			continue
+		}
+		// 后面的检查没有通过，这次尝试不会发生，撤销前面已经记下的次数
+		if rerr := g.release(ctx, keys[:i]); err == nil {
+			err = rerr
+		}
+		return wait, err
+	}
+	return 0, nil
+}
+
+// Succeed 登录成功后清除账号的失败记录。IP 的记录保留，防止攻击者用自己的账号重置计数，只撤销这次尝试
+func (g *LoginGuard) Succeed(ctx context.Context, username string, ip string) error {
+	if err := g.store.Delete(ctx, accountKey(username)); err != nil {
+		return err
+	}
+	return g.release(ctx, g.keys(username, ip)[1:])
+}
+
+// Release 撤销 Check 记下的这次尝试，用于验证通过但还没有完成登录的情况，例如密码正确但还需要两步验证
+func (g *LoginGuard) Release(ctx context.Context, username string, ip string) error {
+	return g.release(ctx, g.keys(username, ip))
+}
+
+func (g *LoginGuard) release(ctx context.Context, keys []policyKey) error {
+	for _, k := range keys {
+		p := k.policy
+		err := g.store.Update(ctx, k.key, p.Forget+p.LockDuration, func(r *Record) {
+			if r.Failures > 0 {
+				r.Failures--
+			}
+			// 锁定是这次尝试触发的
+			if p.LockAfter > 0 && r.Failures < p.LockAfter {
+				r.LockedUntil = time.Time{}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlock 管理员解锁账号
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.store.Delete(ctx, accountKey(username))
+}
+
+// UnlockIP 管理员解锁 IP
+func (g *LoginGuard) UnlockIP(ctx context.Context, ip string) error {
+	return g.store.Delete(ctx, ipKey(ip))
+}
+
+type policyKey struct {
+	key    string
+	policy Policy
+}
+
+func (g *LoginGuard) keys(username string, ip string) []policyKey {
+	return []policyKey{
+		{key: accountKey(username), policy: g.account},
+		{key: ipKey(ip), policy: g.ip},
+	}
+}
+
+func accountKey(username string) string {
+	return "account:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// reserve 记录一次失败，距离上次失败超过 Forget 时重新计数
+func (p Policy) reserve(r *Record, now time.Time) {
+	if !r.Last.IsZero() && now.Sub(r.Last) > p.Forget {
+		*r = Record{}
+	}
+	r.Failures++
+	r.Last = now
+	if p.LockAfter > 0 && r.Failures >= p.LockAfter {
+		r.LockedUntil = now.Add(p.LockDuration)
+	}
+}
+
+func (p Policy) wait(r Record, now time.Time) time.Duration {
+	if r.Failures == 0 || now.Sub(r.Last) > p.Forget {
+		return 0
+	}
+	if now.Before(r.LockedUntil) {
+		return r.LockedUntil.Sub(now)
+	}
+	if r.Failures < p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < r.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if next := r.Last.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
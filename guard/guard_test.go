@@ -0,0 +1,112 @@
+package guard
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_wait(t *testing.T) {
+	p := Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     8 * time.Second,
+		LockAfter:    10,
+		LockDuration: 15 * time.Minute,
+		Forget:       time.Hour,
+	}
+	now := time.Now()
+	testCases := []struct {
+		name   string
+		record Record
+		want   time.Duration
+	}{
+		{name: "没有失败", want: 0},
+		{name: "免费次数内", record: Record{Failures: 2, Last: now}, want: 0},
+		{name: "开始退避", record: Record{Failures: 3, Last: now}, want: time.Second},
+		{name: "指数退避", record: Record{Failures: 5, Last: now}, want: 4 * time.Second},
+		{name: "退避封顶", record: Record{Failures: 9, Last: now}, want: 8 * time.Second},
+		{name: "退避已过", record: Record{Failures: 5, Last: now.Add(-5 * time.Second)}, want: 0},
+		{name: "锁定中", record: Record{Failures: 10, Last: now, LockedUntil: now.Add(time.Minute)}, want: time.Minute},
+		{name: "已遗忘", record: Record{Failures: 9, Last: now.Add(-2 * time.Hour)}, want: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.wait(tc.record, now))
+		})
+	}
+}
+
+// 并发的尝试在记录失败之前不能一起通过检查
+func TestLoginGuard_CheckConcurrent(t *testing.T) {
+	p := Policy{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour}
+	g := NewLoginGuard(NewMemoryStore(), p, Policy{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour})
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := g.Check(context.Background(), "alice", "1.2.3.4")
+			assert.NoError(t, err)
+			if wait == 0 {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(p.FreeAttempts), passed.Load())
+}
+
+func TestLoginGuard_Release(t *testing.T) {
+	ctx := context.Background()
+	p := Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour}
+	testCases := []struct {
+		name string
+		// 每次尝试之后的处理
+		after    func(g *LoginGuard, username string, ip string) error
+		wantWait bool
+	}{
+		{name: "失败会累计", after: func(g *LoginGuard, username string, ip string) error { return nil }, wantWait: true},
+		{name: "成功后清除", after: func(g *LoginGuard, username string, ip string) error { return g.Succeed(ctx, username, ip) }},
+		{name: "撤销不计入失败", after: func(g *LoginGuard, username string, ip string) error { return g.Release(ctx, username, ip) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewLoginGuard(NewMemoryStore(), p, p)
+			for i := 0; i < 2; i++ {
+				wait, err := g.Check(ctx, "alice", "1.2.3.4")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+				assert.NoError(t, tc.after(g, "alice", "1.2.3.4"))
+			}
+			wait, err := g.Check(ctx, "alice", "1.2.3.4")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantWait, wait > 0)
+		})
+	}
+}
+
+// IP 需要等待时撤销已经记在账号上的次数，否则别人可以通过被限制的 IP 锁定账号
+func TestLoginGuard_CheckRollback(t *testing.T) {
+	ctx := context.Background()
+	account := Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour}
+	ip := Policy{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour}
+	store := NewMemoryStore()
+	g := NewLoginGuard(store, account, ip)
+
+	wait, err := g.Check(ctx, "alice", "1.2.3.4")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = g.Check(ctx, "alice", "1.2.3.4")
+	assert.NoError(t, err)
+	assert.Positive(t, wait)
+
+	r, err := store.Get(ctx, accountKey("alice"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.Failures)
+}
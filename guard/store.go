@@ -0,0 +1,79 @@
+package guard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Record struct {
+	Failures    int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+// Store 登录失败记录存储，Update 必须是原子的
+type Store interface {
+	Get(ctx context.Context, key string) (Record, error)
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(r *Record)) error
+	Delete(ctx context.Context, key string) error
+}
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	swept   time.Time
+}
+
+type memoryRecord struct {
+	Record
+	expire time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.records[key]
+	if !ok || time.Now().After(r.expire) {
+		return Record{}, nil
+	}
+	return r.Record, nil
+}
+
+func (m *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(r *Record)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	r, ok := m.records[key]
+	if !ok || now.After(r.expire) {
+		r = memoryRecord{}
+	}
+	fn(&r.Record)
+	r.expire = now.Add(ttl)
+	m.records[key] = r
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for key, r := range m.records {
+		if now.After(r.expire) {
+			delete(m.records, key)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default 没有匹配的语言时使用的语言，也是缺少翻译时的兜底
+const Default = "zh"
+
+// ContextKey 登录用户偏好的语言在 gin.Context 中的键，由 JWT 中间件写入
+const ContextKey = "lang"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs 语言 -> 文案键 -> 文案模板
+var catalogs = load()
+
+func load() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	res := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("解析语言文件 %s 失败: %v", entry.Name(), err))
+		}
+		res[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+	return res
+}
+
+// Localizer 随响应返回的数据如果包含需要翻译的文案，实现该接口
+type Localizer interface {
+	Localize(locale string) any
+}
+
+// Locales 支持的所有语言
+func Locales() []string {
+	res := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		res = append(res, locale)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Supported 是否支持该语言
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Lookup 查找文案模板，不做兜底
+func Lookup(locale, key string) (string, bool) {
+	msg, ok := catalogs[locale][key]
+	return msg, ok
+}
+
+// CatalogKeys 某种语言已翻译的所有文案键
+func CatalogKeys(locale string) []string {
+	res := make([]string, 0, len(catalogs[locale]))
+	for key := range catalogs[locale] {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// T 翻译文案，缺少翻译时退回默认语言，仍然没有则返回键本身。
+// 实现了 Localizer 的参数先按同一语言翻译
+func T(locale, key string, args ...any) string {
+	msg, ok := Lookup(locale, key)
+	if !ok {
+		msg, ok = Lookup(Default, key)
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	localized := make([]any, len(args))
+	for i, arg := range args {
+		if l, ok := arg.(Localizer); ok {
+			arg = l.Localize(locale)
+		}
+		localized[i] = arg
+	}
+	return fmt.Sprintf(msg, localized...)
+}
+
+// Message 渲染时才翻译的文案，可以作为其他文案的参数
+type Message struct {
+	Key  string
+	Args []any
+}
+
+func (m Message) Localize(locale string) any {
+	return T(locale, m.Key, m.Args...)
+}
+
+// String 默认语言的文案，用于日志
+func (m Message) String() string {
+	return T(Default, m.Key, m.Args...)
+}
+
+var (
+	keysMu sync.Mutex
+	keys   = make(map[string]struct{})
+)
+
+// Key 声明一个需要翻译的文案键，测试会检查每种语言都有它的翻译
+func Key(key string) string {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if _, ok := keys[key]; ok {
+		panic(fmt.Sprintf("文案键重复定义: %s", key))
+	}
+	keys[key] = struct{}{}
+	return key
+}
+
+// Keys 所有声明过的文案键
+func Keys() []string {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	res := make([]string, 0, len(keys))
+	for key := range keys {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Resolve 优先使用用户偏好的语言，其次按 Accept-Language 协商
+func Resolve(preferred, acceptLanguage string) string {
+	if Supported(preferred) {
+		return preferred
+	}
+	return Negotiate(acceptLanguage)
+}
+
+// Negotiate 按 Accept-Language 的权重选出支持的语言，只比较主语言标签，
+// 例如 zh-CN、zh-TW 都匹配 zh
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && name == "q" {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q <= bestQ || !Supported(primary) {
+			continue
+		}
+		best, bestQ = primary, q
+	}
+	return best
+}
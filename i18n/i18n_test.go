@@ -0,0 +1,95 @@
+package i18n_test
+
+import (
+	"regexp"
+	"testing"
+
+	"blog/errs"
+	"blog/i18n"
+	// 引入声明了文案键的包
+	_ "blog/filter"
+	_ "blog/service"
+	_ "blog/validate"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var verbPattern = regexp.MustCompile(`%[a-z]`)
+
+// 所有错误码和文案键，每种语言都必须有翻译
+func allKeys() []string {
+	keys := i18n.Keys()
+	for _, e := range errs.All() {
+		keys = append(keys, string(e.Code))
+	}
+	return keys
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	keys := allKeys()
+	assert.NotEmpty(t, i18n.Keys())
+	for _, locale := range i18n.Locales() {
+		for _, key := range keys {
+			msg, ok := i18n.Lookup(locale, key)
+			if !assert.True(t, ok, "%s 缺少翻译: %s", locale, key) {
+				continue
+			}
+			// 格式化参数要和默认语言一致，否则翻译后会出现 %!d(MISSING)
+			want, _ := i18n.Lookup(i18n.Default, key)
+			assert.Equal(t, verbPattern.FindAllString(want, -1), verbPattern.FindAllString(msg, -1),
+				"%s 的格式化参数和默认语言不一致: %s", locale, key)
+		}
+	}
+}
+
+// 不再使用的翻译应该一起删掉
+func TestCatalogsNoStale(t *testing.T) {
+	known := make(map[string]bool)
+	for _, key := range allKeys() {
+		known[key] = true
+	}
+	for _, locale := range i18n.Locales() {
+		for _, key := range i18n.CatalogKeys(locale) {
+			assert.True(t, known[key], "%s 中的翻译没有被使用: %s", locale, key)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "没有请求头", header: "", want: "zh"},
+		{name: "精确匹配", header: "en", want: "en"},
+		{name: "地区子标签", header: "en-US,en;q=0.9", want: "en"},
+		{name: "按权重选择", header: "fr;q=1.0, en;q=0.8, zh;q=0.5", want: "en"},
+		{name: "权重更高的中文", header: "en;q=0.3, zh-CN", want: "zh"},
+		{name: "都不支持", header: "fr, de;q=0.5", want: "zh"},
+		{name: "q=0 表示不接受", header: "en;q=0", want: "zh"},
+		{name: "大小写不敏感", header: "EN-gb", want: "en"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, i18n.Negotiate(tc.header))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert.Equal(t, "en", i18n.Resolve("en", "zh-CN"))
+	assert.Equal(t, "zh", i18n.Resolve("", "zh-CN,en;q=0.5"))
+	// 不支持的偏好退回协商
+	assert.Equal(t, "en", i18n.Resolve("fr", "en"))
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Too many failed logins, please try again in 30 seconds", i18n.T("en", "auth.login_throttled", 30))
+	assert.Equal(t, "登录失败次数过多，请 30 秒后再试", i18n.T("fr", "auth.login_throttled", 30))
+	assert.Equal(t, "no.such.key", i18n.T("en", "no.such.key"))
+	// 嵌套的文案按同一语言翻译
+	reason := i18n.Message{Key: "filter.too_many_links", Args: []any{5}}
+	assert.Equal(t, "Comment was rejected: too many links (5)", i18n.T("en", "comment.rejected", reason))
+	assert.Equal(t, "链接过多（5 个）", reason.String())
+}
@@ -0,0 +1,247 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrNoSigningKey = errors.New("没有可用于签名的私钥")
+	ErrUnknownKey   = errors.New("未知的 kid")
+)
+
+// Key 一个签名或验证密钥，private 为空时只能用于验证，如轮换后已删除私钥的旧密钥
+type Key struct {
+	ID      string
+	Alg     string
+	private any
+	public  any
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet 用一把私钥签名，用全部密钥验证，轮换期间新旧 token 同时有效
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	ids     []string
+}
+
+// New signingID 为空时使用 ID 排序最大的私钥，所以 kid 建议用日期命名，如 2026-10
+func New(keys []*Key, signingID string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("kid %q 重复", k.ID)
+		}
+		ks.keys[k.ID] = k
+		ks.ids = append(ks.ids, k.ID)
+	}
+	sort.Strings(ks.ids)
+	if signingID != "" {
+		k, ok := ks.keys[signingID]
+		if !ok || k.private == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, signingID)
+		}
+		ks.signing = k
+		return ks, nil
+	}
+	for i := len(ks.ids) - 1; i >= 0; i-- {
+		if k := ks.keys[ks.ids[i]]; k.private != nil {
+			ks.signing = k
+			return ks, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// LoadDir 读取目录下的 PEM 文件，文件名去掉扩展名后作为 kid。
+// 支持 PKCS#8 私钥、PKCS#1 RSA 私钥和 PKIX 公钥，算法按密钥类型确定：RSA 为 RS256，Ed25519 为 EdDSA
+func LoadDir(dir string, signingID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		k, err := ParsePEM(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, k)
+	}
+	return New(keys, signingID)
+}
+
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是 PEM 格式")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("不支持的 PEM 类型 %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(id, key)
+}
+
+// Generate 生成临时的 Ed25519 密钥，用于未配置密钥目录的开发环境和测试
+func Generate(id string) (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(id, priv)
+}
+
+func newKey(id string, key any) (*Key, error) {
+	k := &Key{ID: id}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.Alg, k.private, k.public = AlgRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Alg, k.public = AlgRS256, key
+	case ed25519.PrivateKey:
+		k.Alg, k.private, k.public = AlgEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Alg, k.public = AlgEdDSA, key
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型 %T", key)
+	}
+	if pub, ok := k.public.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA 密钥至少需要 2048 位，当前为 %d", pub.N.BitLen())
+	}
+	return k, nil
+}
+
+// Sign 用当前签名密钥签发 token，header 中带上 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method(), claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.private)
+}
+
+// Parse 按 kid 查找验证密钥，token 的 alg 必须与该密钥的算法一致，拒绝 none 和 HS256 等其他算法
+func (ks *KeySet) Parse(tokenStr string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != k.Alg {
+			return nil, fmt.Errorf("kid %q 只接受 %s，token 使用了 %s", kid, k.Alg, token.Method.Alg())
+		}
+		return k.public, nil
+	}, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}), jwt.WithExpirationRequired())
+	return err
+}
+
+// JWK RFC 7517 中的公钥格式
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 全部验证密钥的公钥部分，供其他服务验证本站签发的 token
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.ids))}
+	for _, id := range ks.ids {
+		k := ks.keys[id]
+		jwk := JWK{Use: "sig", Alg: k.Alg, Kid: k.ID}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// PublicKey 解析其他服务发布的 JWK，支持 RSA 和 Ed25519
+func (k JWK) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("kid %q 的 RSA 指数无效", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线 %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("kid %q 的 Ed25519 公钥长度错误", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型 %s", k.Kty)
+	}
+}
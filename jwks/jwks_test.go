@@ -0,0 +1,201 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"id": 1, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func writePEM(t *testing.T, dir string, name string, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+func TestLoadDirRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "2026-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2026-10.pem", "PRIVATE KEY", der)
+
+	// 旧密钥签发的 token
+	old, err := LoadDir(dir, "2026-01")
+	require.NoError(t, err)
+	oldToken, err := old.Sign(claims())
+	require.NoError(t, err)
+
+	// 默认用 kid 最大的私钥签名
+	ks, err := LoadDir(dir, "")
+	require.NoError(t, err)
+	newToken, err := ks.Sign(claims())
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", token.Header["kid"])
+	assert.Equal(t, AlgEdDSA, token.Header["alg"])
+
+	// 轮换期间新旧 token 都有效
+	assert.NoError(t, ks.Parse(newToken, jwt.MapClaims{}))
+	assert.NoError(t, ks.Parse(oldToken, jwt.MapClaims{}))
+
+	// 旧私钥换成公钥后仍能验证，但不能再用来签名
+	require.NoError(t, os.Remove(filepath.Join(dir, "2026-01.pem")))
+	pub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2026-01.pem", "PUBLIC KEY", pub)
+	ks, err = LoadDir(dir, "")
+	require.NoError(t, err)
+	assert.NoError(t, ks.Parse(oldToken, jwt.MapClaims{}))
+	_, err = LoadDir(dir, "2026-01")
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	// 旧密钥移除后旧 token 失效
+	require.NoError(t, os.Remove(filepath.Join(dir, "2026-01.pem")))
+	ks, err = LoadDir(dir, "")
+	require.NoError(t, err)
+	assert.ErrorIs(t, ks.Parse(oldToken, jwt.MapClaims{}), ErrUnknownKey)
+}
+
+func TestLoadDirInvalid(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadDir(dir, "")
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	writePEM(t, dir, "small.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(small))
+	_, err = LoadDir(dir, "")
+	assert.Error(t, err)
+}
+
+func TestParseStrictAlg(t *testing.T) {
+	key, err := Generate("k1")
+	require.NoError(t, err)
+	ks, err := New([]*Key{key}, "")
+	require.NoError(t, err)
+	pub := key.public.(ed25519.PublicKey)
+
+	testCases := []struct {
+		name  string
+		token func(t *testing.T) string
+	}{
+		{
+			// 用公钥当 HMAC 密钥伪造 token
+			name: "HS256",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+				token.Header["kid"] = "k1"
+				s, err := token.SignedString([]byte(pub))
+				require.NoError(t, err)
+				return s
+			},
+		},
+		{
+			name: "none",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, claims())
+				token.Header["kid"] = "k1"
+				s, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				require.NoError(t, err)
+				return s
+			},
+		},
+		{
+			name: "RS256 使用 EdDSA 的 kid",
+			token: func(t *testing.T) string {
+				rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+				require.NoError(t, err)
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+				token.Header["kid"] = "k1"
+				s, err := token.SignedString(rsaKey)
+				require.NoError(t, err)
+				return s
+			},
+		},
+		{
+			name: "没有 kid",
+			token: func(t *testing.T) string {
+				_, priv, err := ed25519.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				s, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims()).SignedString(priv)
+				require.NoError(t, err)
+				return s
+			},
+		},
+		{
+			name: "没有过期时间",
+			token: func(t *testing.T) string {
+				s, err := ks.Sign(jwt.MapClaims{"id": 1})
+				require.NoError(t, err)
+				return s
+			},
+		},
+		{
+			name: "已过期",
+			token: func(t *testing.T) string {
+				s, err := ks.Sign(jwt.MapClaims{"id": 1, "exp": time.Now().Add(-time.Minute).Unix()})
+				require.NoError(t, err)
+				return s
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, ks.Parse(tc.token(t), jwt.MapClaims{}))
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rk, err := newKey("a", &rsaKey.PublicKey)
+	require.NoError(t, err)
+	ek, err := Generate("b")
+	require.NoError(t, err)
+	ks, err := New([]*Key{ek, rk}, "")
+	require.NoError(t, err)
+
+	set := ks.JWKS()
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, JWK{
+		Kty: "RSA", Use: "sig", Alg: AlgRS256, Kid: "a",
+		N: base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E: "AQAB",
+	}, set.Keys[0])
+	assert.Equal(t, JWK{
+		Kty: "OKP", Use: "sig", Alg: AlgEdDSA, Kid: "b",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(ek.public.(ed25519.PublicKey)),
+	}, set.Keys[1])
+
+	// 发布出去的公钥能被还原
+	pub, err := set.Keys[0].PublicKey()
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(pub))
+	pub, err = set.Keys[1].PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, ek.public, pub)
+
+	_, err = JWK{Kty: "EC", Kid: "c"}.PublicKey()
+	assert.Error(t, err)
+}
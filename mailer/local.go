@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer 把邮件写成 .eml 文件，本地开发和测试时代替 SMTP
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%d-%s.eml", time.Now().Format("20060102-150405"), m.seq.Add(1),
+		strings.NewReplacer("@", "_at_", "/", "_").Replace(strings.Join(msg.To, "_")))
+	return os.WriteFile(filepath.Join(m.dir, name), build(m.from, msg), 0o644)
+}
+
+// LogMailer 只把邮件内容打到日志里
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	zap.L().Info("发送邮件", zap.Strings("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+	return nil
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type SMTPMailer struct {
+	// host:port
+	addr     string
+	username string
+	password string
+	from     *mail.Address
+}
+
+// NewSMTPMailer from 可以带显示名，如 blog <no-reply@example.com>，信封发件人只用其中的邮箱地址
+func NewSMTPMailer(addr string, username string, password string, from string) (*SMTPMailer, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("发件人地址无效 %q: %w", from, err)
+	}
+	return &SMTPMailer{addr: addr, username: username, password: password, from: sender}, nil
+}
+
+// Send 与 smtp.SendMail 的流程相同，但连接和整个会话都受 ctx 控制，服务器不响应时不会一直卡住
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	host, _, err := net.SplitHostPort(m.addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// ctx 取消时让阻塞中的读写立即返回
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.username, m.password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(m.from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(build(m.from.String(), msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
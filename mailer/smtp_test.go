@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTPMailer_SendHonorsContext(t *testing.T) {
+	// 只接受连接、从不回复问候的服务器
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m, err := NewSMTPMailer(l.Addr().String(), "", "", "no-reply@localhost")
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = m.Send(ctx, Message{To: []string{"alice@example.com"}, Subject: "主题", Body: "正文"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// fakeSMTPServer 只实现发信需要的命令，记录收到的信封发件人和邮件内容
+func fakeSMTPServer(t *testing.T) (string, chan [2]string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	received := make(chan [2]string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		var from string
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO", "HELO", "RCPT":
+				_ = tp.PrintfLine("250 OK")
+			case "MAIL":
+				from = arg
+				_ = tp.PrintfLine("250 OK")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- [2]string{from, string(data)}
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	testCases := []struct {
+		name       string
+		from       string
+		wantMail   string
+		wantHeader string
+	}{
+		{
+			name:       "只有邮箱地址",
+			from:       "no-reply@localhost",
+			wantMail:   "FROM:<no-reply@localhost>",
+			wantHeader: "From: <no-reply@localhost>",
+		},
+		{
+			// 信封发件人不能带显示名，否则服务器会拒绝
+			name:       "带显示名",
+			from:       "blog <no-reply@localhost>",
+			wantMail:   "FROM:<no-reply@localhost>",
+			wantHeader: `From: "blog" <no-reply@localhost>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, received := fakeSMTPServer(t)
+			m, err := NewSMTPMailer(addr, "", "", tc.from)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = m.Send(ctx, Message{To: []string{"alice@example.com"}, Subject: "主题", Body: "正文"})
+			require.NoError(t, err)
+
+			got := <-received
+			assert.Equal(t, tc.wantMail, got[0])
+			header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(got[1]))).ReadLine()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHeader, header)
+		})
+	}
+}
+
+func TestNewSMTPMailer_InvalidFrom(t *testing.T) {
+	_, err := NewSMTPMailer("localhost:25", "", "", "blog <no-reply")
+	assert.Error(t, err)
+}
@@ -2,17 +2,49 @@ package main
 
 import (
 	"blog/dao"
+	"blog/filter"
+	"blog/guard"
+	"blog/jwks"
+	"blog/mailer"
+	"blog/media"
 	"blog/middleware"
+	"blog/oidc"
+	"blog/pubsub"
+	"blog/ratelimit"
 	"blog/service"
+	"blog/sign"
+	"blog/validate"
+	"context"
+	"crypto/rand"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
+const (
+	sensitiveWordsPath = "config/sensitive_words.txt"
+	// 订阅源标题和验证器 App 中显示的站点名称
+	siteName = "xiangcunxi 的博客"
+	// 邮件链接中使用的站点地址
+	siteURL = "http://localhost:8080"
+	// 重置密码邮件中链接到的前端页面
+	passwordResetURL = siteURL + "/password/reset"
+	// 订阅源和 sitemap 中文章页面的地址
+	postURL = siteURL + "/posts/detail/%d"
+	// 上传的图片和缩略图保存的目录
+	mediaDir = "data/media"
+	// 申请注销后保留账号的天数，期间可以撤销
+	accountDeletionGrace = 14 * 24 * time.Hour
+)
+
 func main() {
 	initLogger()
 	db, err := gorm.Open(mysql.Open("root:xiang123@tcp(192.168.29.128:3306)/blog?charset=utf8mb4&parseTime=True&loc=Local"))
@@ -24,12 +56,26 @@ func main() {
 	userDao := dao.NewUserDAO(db)
 	postDao := dao.NewPostDAO(db)
 	commentDao := dao.NewCommentDAO(db)
+	mentionDao := dao.NewMentionDAO(db)
+	reactionDao := dao.NewReactionDAO(db)
+	passwordResetDao := dao.NewPasswordResetDAO(db)
+	mediaDao := dao.NewMediaDAO(db)
+	tagDao := dao.NewTagDAO(db)
+	recoveryCodeDao := dao.NewRecoveryCodeDAO(db)
+	identityDao := dao.NewIdentityDAO(db)
+	accessTokenDao := dao.NewAccessTokenDAO(db)
+	sessionDao := dao.NewSessionDAO(db)
+
+	if err = validate.Register(); err != nil {
+		panic(err)
+	}
+	contentFilter := initContentFilter()
 
 	server := gin.Default()
 	server.Use(cors.New(cors.Config{
-		AllowHeaders: []string{"Content-Type", "Authorization"},
+		AllowHeaders: []string{"Content-Type", "Authorization", middleware.EnvelopeHeader, middleware.AuthModeHeader, middleware.CSRFHeader},
 		//不加这个前端拿不到
-		ExposeHeaders:    []string{"jwt-token"},
+		ExposeHeaders:    []string{"jwt-token", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			if strings.HasPrefix(origin, "http://localhost") {
@@ -39,23 +85,277 @@ func main() {
 		},
 		MaxAge: 12 * time.Hour,
 	}))
+	// 统一渲染错误，返回真实状态码，老客户端可通过 X-Envelope: legacy 始终返回 200
+	server.Use(middleware.NewErrorBuilder().Build())
+
+	keys := initKeySet()
+	// 可选登录：所有路由都可以匿名访问，需要登录的路由在各 handler 中通过 requireLogin 声明，
+	// 允许访问令牌调用的路由通过 requireScope 声明
+	server.Use(middleware.NewLoginJWTMiddleware(keys).
+		Optional().
+		Cookie(middleware.DefaultTokenCookie).
+		AccessToken(service.AccessTokenPrefix, service.AccessTokenAuthenticator(accessTokenDao, userDao)).
+		Check(service.CheckTokenVersion(userDao)).
+		Check(service.CheckSession(sessionDao)).Build())
+
+	// 限流策略按路由分组声明
+	limitStore := ratelimit.NewMemoryStore()
+
+	loginGuard := guard.NewLoginGuard(guard.NewMemoryStore(),
+		guard.Policy{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			LockAfter:    10,
+			LockDuration: 15 * time.Minute,
+			Forget:       time.Hour,
+		},
+		// 同一 IP 后面可能有很多用户（如公司出口），阈值放宽
+		guard.Policy{
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			LockAfter:    100,
+			LockDuration: time.Hour,
+			Forget:       time.Hour,
+		})
+
+	mail := initMailer()
+	signer := sign.New(signSecret())
+	tokens := service.NewTokenIssuer(keys, sessionDao, middleware.DefaultTokenCookie, 24*time.Hour)
+	twoFactor := service.NewTwoFactor(recoveryCodeDao, signer, siteName, 5*time.Minute)
+	u := service.NewUserHandler(userDao, loginGuard,
+		service.NewEmailVerifier(mail, signer, siteURL, 24*time.Hour),
+		service.NewPasswordResetter(passwordResetDao, mail, passwordResetURL, 30*time.Minute),
+		tokens, accessTokenDao, twoFactor)
+	u.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("user", ratelimit.NewSlidingWindow(limitStore, 10, time.Minute)).
+			KeyBy(middleware.KeyByIP, middleware.KeyByRoute).Build())
+
+	oh := service.NewOIDCHandler(userDao, identityDao, tokens, twoFactor, signer, service.OIDCConfig{
+		Providers:  initOIDCProviders(),
+		AfterLogin: siteURL + "/",
+		Secure:     middleware.DefaultTokenCookie.Secure,
+	})
+	oh.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("oidc", ratelimit.NewSlidingWindow(limitStore, 10, time.Minute)).
+			KeyBy(middleware.KeyByIP, middleware.KeyByRoute).Build())
+
+	p := service.NewPostHandler(postDao, userDao, mentionDao, tagDao, contentFilter)
+	p.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("posts", ratelimit.NewTokenBucket(limitStore, 2, 30)).
+			KeyBy(middleware.KeyByUser).Build())
+
+	hub := pubsub.NewHub(1000, 16)
+	c := service.NewCommentHandler(commentDao, userDao, postDao, mentionDao, reactionDao, hub, contentFilter, service.CommentConfig{
+		ReactionKeys: reactionKeys(),
+		Moderation:   commentModeration(),
+	})
+	c.RegisterRoutes(server,
+		// 只限制写接口，列表和 SSE 订阅不占用发评论的额度
+		middleware.NewRateLimitBuilder("comments", ratelimit.NewTokenBucket(limitStore, 0.5, 10)).
+			KeyBy(middleware.KeyByUser, middleware.KeyByRoute).
+			Only(http.MethodPost, "/comments/edit").
+			Only(http.MethodPost, "/comments/react").
+			Only(http.MethodPost, "/comments/moderation/review").Build())
+
+	pr := service.NewProfileHandler(userDao, postDao, commentDao, mentionDao, tagDao)
+	pr.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("profiles", ratelimit.NewTokenBucket(limitStore, 2, 30)).
+			KeyBy(middleware.KeyByUser).Build())
 
-	server.Use(middleware.NewLoginJWTMiddleware().
-		IgnorePath("/user/login").
-		IgnorePath("/user/signup").Build())
+	mediaStorage, err := media.NewLocalStorage(mediaDir)
+	if err != nil {
+		zap.L().Error("创建媒体目录失败", zap.Error(err), zap.String("dir", mediaDir))
+		panic(err)
+	}
+	mediaProcessor := media.NewProcessor(mediaStorage, media.DefaultConfig)
+	md := service.NewMediaHandler(mediaDao, userDao, mediaProcessor)
+	md.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("media", ratelimit.NewTokenBucket(limitStore, 5, 60)).
+			KeyBy(middleware.KeyByUser, middleware.KeyByRoute).Build())
+
+	ac := service.NewAccountHandler(userDao, postDao, commentDao, reactionDao, mediaDao, mediaProcessor, accountDeletionGrace)
+	ac.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("account", ratelimit.NewSlidingWindow(limitStore, 10, time.Hour)).
+			KeyBy(middleware.KeyByUser, middleware.KeyByRoute).Build())
+	go ac.RunPurger(context.Background(), time.Hour)
+
+	fd := service.NewFeedHandler(postDao, userDao, mentionDao, tagDao, service.FeedConfig{
+		Title:         siteName,
+		Description:   "最新文章",
+		SiteURL:       siteURL,
+		PostURL:       postURL,
+		Items:         20,
+		SummaryLength: 200,
+	})
+	fd.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("feeds", ratelimit.NewTokenBucket(limitStore, 1, 20)).Build())
+
+	sm := service.NewSitemapHandler(postDao, service.SitemapConfig{
+		SiteURL:  siteURL,
+		PostURL:  postURL,
+		Disallow: []string{"/admin/", "/user/", "/media/upload", "/comments/stream/"},
+		// 公开资料页允许抓取
+		Allow: []string{"/user/profile/"},
+	})
+	sm.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("sitemaps", ratelimit.NewTokenBucket(limitStore, 1, 20)).Build())
+
+	m := service.NewMentionHandler(mentionDao, userDao)
+	m.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("mentions", ratelimit.NewTokenBucket(limitStore, 2, 30)).
+			KeyBy(middleware.KeyByUser).Build())
 
-	u := service.NewUserHandler(userDao)
-	u.RegisterRoutes(server)
+	a := service.NewAdminHandler(userDao, loginGuard)
+	a.RegisterRoutes(server)
 
-	p := service.NewPostHandler(postDao, userDao)
-	p.RegisterRoutes(server)
+	at := service.NewAccessTokenHandler(accessTokenDao)
+	at.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("tokens", ratelimit.NewSlidingWindow(limitStore, 10, time.Minute)).
+			KeyBy(middleware.KeyByUser, middleware.KeyByRoute).Build())
 
-	c := service.NewCommentHandler(commentDao, userDao, postDao)
-	c.RegisterRoutes(server)
+	ss := service.NewSessionHandler(sessionDao)
+	ss.RegisterRoutes(server,
+		middleware.NewRateLimitBuilder("sessions", ratelimit.NewSlidingWindow(limitStore, 30, time.Minute)).
+			KeyBy(middleware.KeyByUser, middleware.KeyByRoute).Build())
+
+	service.NewJWKSHandler(keys).RegisterRoutes(server)
 
 	server.Run(":8080")
 }
 
+// initContentFilter 敏感词表可在修改后通过 kill -HUP 重新加载
+func initContentFilter() *filter.Chain {
+	words := filter.NewSensitiveWordFilter(nil, filter.Reject)
+	loadWords := func() {
+		n, err := words.LoadFile(sensitiveWordsPath)
+		if err != nil {
+			zap.L().Warn("加载敏感词表失败", zap.Error(err), zap.String("path", sensitiveWordsPath))
+			return
+		}
+		zap.L().Info("加载敏感词表", zap.Int("count", n))
+	}
+	loadWords()
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		for range ch {
+			loadWords()
+		}
+	}()
+	return filter.NewChain(
+		words,
+		filter.LinkFilter{HoldAt: 3, RejectAt: 10},
+		filter.NewDuplicateFilter(10*time.Minute, 3),
+	)
+}
+
+// initMailer 配置了 SMTP 时发真实邮件，否则写到本地目录
+func initMailer() mailer.Mailer {
+	from := os.Getenv("BLOG_MAIL_FROM")
+	if from == "" {
+		from = "blog <no-reply@localhost>"
+	}
+	if addr := os.Getenv("BLOG_SMTP_ADDR"); addr != "" {
+		m, err := mailer.NewSMTPMailer(addr, os.Getenv("BLOG_SMTP_USERNAME"), os.Getenv("BLOG_SMTP_PASSWORD"), from)
+		if err != nil {
+			panic(err)
+		}
+		return m
+	}
+	m, err := mailer.NewFileMailer("tmp/mail", from)
+	if err != nil {
+		zap.L().Warn("创建本地邮件目录失败，邮件只输出到日志", zap.Error(err))
+		return mailer.LogMailer{}
+	}
+	return m
+}
+
+// commentModeration 全局评论审核模式，BLOG_COMMENT_MODERATION 可选 first_time（首次评论需审核）和 all（全部需审核），
+// 未配置时不审核，和之前的行为一致
+func commentModeration() uint8 {
+	switch mode := os.Getenv("BLOG_COMMENT_MODERATION"); mode {
+	case "", "open":
+		return dao.ModerationOpen
+	case "first_time":
+		return dao.ModerationHoldFirstTime
+	case "all":
+		return dao.ModerationHoldAll
+	default:
+		zap.L().Warn("未知的评论审核模式，不审核评论", zap.String("mode", mode))
+		return dao.ModerationOpen
+	}
+}
+
+// reactionKeys 可用的表情回应，BLOG_REACTIONS 用逗号分隔，如 thumbsup,heart，未配置时使用默认的表情
+func reactionKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("BLOG_REACTIONS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// signSecret 未配置时随机生成，重启后之前发出的链接会失效
+func signSecret() []byte {
+	if secret := os.Getenv("BLOG_SIGN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	zap.L().Warn("未配置 BLOG_SIGN_SECRET，使用随机密钥")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// initOIDCProviders 配置了 BLOG_OIDC_ISSUER 时启用第三方登录，BLOG_OIDC_NAME 是登录地址中的名称
+func initOIDCProviders() map[string]*oidc.Client {
+	issuer := os.Getenv("BLOG_OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	name := os.Getenv("BLOG_OIDC_NAME")
+	if name == "" {
+		name = "oidc"
+	}
+	return map[string]*oidc.Client{
+		name: oidc.NewClient(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("BLOG_OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("BLOG_OIDC_CLIENT_SECRET"),
+			RedirectURL:  siteURL + "/user/oidc/" + name + "/callback",
+		}, nil),
+	}
+}
+
+// initKeySet 从 BLOG_JWT_KEY_DIR 加载 token 签名密钥，BLOG_JWT_KID 指定签名用的密钥，
+// 不指定时用 kid 最大的私钥。轮换时先放入新私钥，等旧 token 过期后再删掉旧私钥（可以只保留公钥）。
+// 未配置目录时随机生成，重启后之前签发的 token 会失效
+func initKeySet() *jwks.KeySet {
+	if dir := os.Getenv("BLOG_JWT_KEY_DIR"); dir != "" {
+		keys, err := jwks.LoadDir(dir, os.Getenv("BLOG_JWT_KID"))
+		if err != nil {
+			zap.L().Error("加载 token 签名密钥失败", zap.Error(err), zap.String("dir", dir))
+			panic(err)
+		}
+		return keys
+	}
+	zap.L().Warn("未配置 BLOG_JWT_KEY_DIR，使用随机密钥")
+	key, err := jwks.Generate("dev")
+	if err != nil {
+		panic(err)
+	}
+	keys, err := jwks.New([]*jwks.Key{key}, "")
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
 func initLogger() {
 	logger, err := zap.NewDevelopment()
 	if err != nil {
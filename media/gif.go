@@ -0,0 +1,65 @@
+package media
+
+import "errors"
+
+var errBadGIF = errors.New("gif: 数据块格式错误")
+
+// gifFrames 不解码像素，只遍历 GIF 的数据块，统计帧数和所有帧的像素总数。
+// gif.DecodeAll 会一次解码全部帧，解码前用它限制动图的总大小
+func gifFrames(data []byte) (frames int, pixels int, err error) {
+	if len(data) < 13 {
+		return 0, 0, errBadGIF
+	}
+	// 文件头 6 字节，逻辑屏幕描述符 7 字节，之后是可选的全局颜色表
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+	// skip 跳过一串数据子块，以长度为 0 的子块结尾
+	skip := func() bool {
+		for pos < len(data) {
+			n := int(data[pos])
+			pos++
+			if n == 0 {
+				return true
+			}
+			pos += n
+		}
+		return false
+	}
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// 扩展块：标识、扩展类型，然后是数据子块
+			pos += 2
+			if !skip() {
+				return 0, 0, errBadGIF
+			}
+		case 0x2C:
+			// 图像描述符：标识、左上角坐标、宽、高各 2 字节和 1 字节标志，之后是可选的局部颜色表
+			if pos+10 > len(data) {
+				return 0, 0, errBadGIF
+			}
+			width := int(data[pos+5]) | int(data[pos+6])<<8
+			height := int(data[pos+7]) | int(data[pos+8])<<8
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// LZW 最小码长
+			pos++
+			if !skip() {
+				return 0, 0, errBadGIF
+			}
+			frames++
+			pixels += width * height
+		case 0x3B:
+			return frames, pixels, nil
+		default:
+			return 0, 0, errBadGIF
+		}
+	}
+	// 缺少结尾标记，交给解码器判断
+	return frames, pixels, nil
+}
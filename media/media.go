@@ -0,0 +1,259 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gabriel-vasile/mimetype"
+	xdraw "golang.org/x/image/draw"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ErrTooLarge        = errors.New("文件太大")
+	ErrUnsupportedType = errors.New("不支持的文件类型")
+)
+
+// allowed 允许上传的类型和保存时使用的扩展名，只按内容判断，不信任客户端给的类型和文件名
+var allowed = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+var extMime = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+	".gif": "image/gif",
+}
+
+type Config struct {
+	// 单个文件的字节数上限
+	MaxBytes int64
+	// 宽乘高的上限，防止很小的文件解码出巨大的图片，GIF 按所有帧的像素之和计算
+	MaxPixels int
+	// GIF 的帧数上限，为 0 时不限制
+	MaxFrames int
+	// 缩略图的宽度，原图不比它宽时不生成
+	ThumbnailWidths []int
+}
+
+var DefaultConfig = Config{
+	MaxBytes:        10 << 20,
+	MaxPixels:       40_000_000,
+	MaxFrames:       500,
+	ThumbnailWidths: []int{160, 480, 1024},
+}
+
+type Thumbnail struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// File 处理后保存下来的文件，Name 是对外的文件名，由内容哈希和扩展名组成
+type File struct {
+	Hash       string
+	Name       string
+	Mime       string
+	Size       int64
+	Width      int
+	Height     int
+	Thumbnails []Thumbnail
+}
+
+// Processor 校验上传的图片，去掉 EXIF 等元数据后按内容哈希保存，并生成缩略图
+type Processor struct {
+	storage Storage
+	cfg     Config
+}
+
+func NewProcessor(storage Storage, cfg Config) *Processor {
+	return &Processor{storage: storage, cfg: cfg}
+}
+
+// MaxBytes 单个文件的大小上限，供调用方限制请求体
+func (p *Processor) MaxBytes() int64 {
+	return p.cfg.MaxBytes
+}
+
+func (p *Processor) Process(ctx context.Context, r io.Reader) (File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, p.cfg.MaxBytes+1))
+	if err != nil {
+		return File{}, err
+	}
+	if int64(len(data)) > p.cfg.MaxBytes {
+		return File{}, ErrTooLarge
+	}
+	mime := mimetype.Detect(data).String()
+	ext, ok := allowed[mime]
+	if !ok {
+		return File{}, fmt.Errorf("%w: %s", ErrUnsupportedType, mime)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > p.cfg.MaxPixels {
+		return File{}, ErrTooLarge
+	}
+	if mime == "image/gif" {
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return File{}, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if (p.cfg.MaxFrames > 0 && frames > p.cfg.MaxFrames) || pixels > p.cfg.MaxPixels {
+			return File{}, ErrTooLarge
+		}
+	}
+
+	clean, img, err := sanitize(mime, data)
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	sum := sha256.Sum256(clean)
+	hash := hex.EncodeToString(sum[:])
+	file := File{
+		Hash:   hash,
+		Name:   hash + ext,
+		Mime:   mime,
+		Size:   int64(len(clean)),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	if err = p.put(ctx, file.Name, clean); err != nil {
+		return File{}, err
+	}
+
+	// GIF 的缩略图只取第一帧，用 PNG 保存
+	thumbExt := ext
+	if mime == "image/gif" {
+		thumbExt = ".png"
+	}
+	for _, width := range p.cfg.ThumbnailWidths {
+		if width >= file.Width {
+			continue
+		}
+		thumb := resize(img, width)
+		var buf bytes.Buffer
+		if err = encode(&buf, thumbExt, thumb); err != nil {
+			return File{}, err
+		}
+		name := hash + "_" + strconv.Itoa(width) + thumbExt
+		if err = p.put(ctx, name, buf.Bytes()); err != nil {
+			return File{}, err
+		}
+		file.Thumbnails = append(file.Thumbnails, Thumbnail{
+			Name:   name,
+			Width:  width,
+			Height: thumb.Bounds().Dy(),
+		})
+	}
+	return file, nil
+}
+
+// put 内容相同的文件只保存一次
+func (p *Processor) put(ctx context.Context, name string, data []byte) error {
+	key := storageKey(name)
+	exists, err := p.storage.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	return p.storage.Put(ctx, key, bytes.NewReader(data))
+}
+
+var namePattern = regexp.MustCompile(`^([0-9a-f]{64})(_[0-9]+)?(\.[a-z]+)$`)
+
+// Open 按对外的文件名读取原图或缩略图，返回文件的类型
+func (p *Processor) Open(ctx context.Context, name string) (io.ReadCloser, string, error) {
+	m := namePattern.FindStringSubmatch(name)
+	if m == nil {
+		return nil, "", ErrNotFound
+	}
+	mime, ok := extMime[m[3]]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	rc, err := p.storage.Open(ctx, storageKey(name))
+	return rc, mime, err
+}
+
+// Delete 按对外的文件名删除原图或缩略图，文件不存在时不报错
+func (p *Processor) Delete(ctx context.Context, name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrNotFound
+	}
+	return p.storage.Delete(ctx, storageKey(name))
+}
+
+// storageKey 按哈希前缀分两级目录，避免单个目录下文件过多
+func storageKey(name string) string {
+	return name[0:2] + "/" + name[2:4] + "/" + name
+}
+
+// sanitize 解码后重新编码，丢弃 EXIF、注释等所有元数据
+func sanitize(mime string, data []byte) ([]byte, image.Image, error) {
+	var buf bytes.Buffer
+	switch mime {
+	case "image/gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = gif.EncodeAll(&buf, g); err != nil {
+			return nil, nil, err
+		}
+		// 第一帧可能只覆盖画布的一部分，画到完整的画布上，尺寸和缩略图都以画布为准
+		first := g.Image[0]
+		canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		xdraw.Draw(canvas, first.Bounds(), first, first.Bounds().Min, xdraw.Src)
+		return buf.Bytes(), canvas, nil
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		img = orient(img, jpegOrientation(data))
+		if err = encode(&buf, ".jpg", img); err != nil {
+			return nil, nil, err
+		}
+		return buf.Bytes(), img, nil
+	default:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = encode(&buf, ".png", img); err != nil {
+			return nil, nil, err
+		}
+		return buf.Bytes(), img, nil
+	}
+}
+
+func encode(w io.Writer, ext string, img image.Image) error {
+	if ext == ".jpg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	}
+	return png.Encode(w, img)
+}
+
+// resize 等比缩放到指定宽度
+func resize(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, xdraw.Src, nil)
+	return dst
+}
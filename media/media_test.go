@@ -0,0 +1,280 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	// 左上角标红，用来判断方向
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// withExif 在 JPEG 的 SOI 之后插入只包含方向标记的 EXIF
+func withExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	seg = append(seg, payload...)
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), seg...), data[2:]...)
+}
+
+// animatedGIF 画布为 w*h 的动图，每一帧都是 frame 区域
+func animatedGIF(t *testing.T, w, h int, frames int, frame image.Rectangle) []byte {
+	g := &gif.GIF{Config: image.Config{Width: w, Height: h, ColorModel: color.Palette{color.Black, color.White}}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(frame, color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, g))
+	return buf.Bytes()
+}
+
+func newTestProcessor(t *testing.T, cfg Config) (*Processor, *LocalStorage) {
+	storage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	return NewProcessor(storage, cfg), storage
+}
+
+func TestProcess(t *testing.T) {
+	var gifBuf bytes.Buffer
+	require.NoError(t, gif.Encode(&gifBuf, testImage(300, 100), nil))
+
+	testCases := []struct {
+		name       string
+		data       []byte
+		cfg        Config
+		wantErr    error
+		wantMime   string
+		wantThumbs []int
+	}{
+		{
+			name:       "PNG 生成缩略图",
+			data:       encodePNG(t, testImage(600, 300)),
+			cfg:        DefaultConfig,
+			wantMime:   "image/png",
+			wantThumbs: []int{160, 480},
+		},
+		{
+			name:       "GIF",
+			data:       gifBuf.Bytes(),
+			cfg:        DefaultConfig,
+			wantMime:   "image/gif",
+			wantThumbs: []int{160},
+		},
+		{
+			name:    "不在白名单中",
+			data:    []byte("<html><script>alert(1)</script></html>"),
+			cfg:     DefaultConfig,
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name:    "扩展名是图片但内容不是",
+			data:    append([]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}, "garbage"...),
+			cfg:     DefaultConfig,
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name:    "超过大小限制",
+			data:    encodePNG(t, testImage(600, 300)),
+			cfg:     Config{MaxBytes: 100, MaxPixels: DefaultConfig.MaxPixels},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "超过像素限制",
+			data:    encodePNG(t, testImage(600, 300)),
+			cfg:     Config{MaxBytes: DefaultConfig.MaxBytes, MaxPixels: 1000},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "GIF 超过帧数限制",
+			data:    animatedGIF(t, 10, 10, 5, image.Rect(0, 0, 10, 10)),
+			cfg:     Config{MaxBytes: DefaultConfig.MaxBytes, MaxPixels: DefaultConfig.MaxPixels, MaxFrames: 4},
+			wantErr: ErrTooLarge,
+		},
+		{
+			// 单帧没有超过限制，所有帧加起来超过
+			name:    "GIF 所有帧的像素之和超过限制",
+			data:    animatedGIF(t, 100, 100, 4, image.Rect(0, 0, 100, 100)),
+			cfg:     Config{MaxBytes: DefaultConfig.MaxBytes, MaxPixels: 30_000},
+			wantErr: ErrTooLarge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, _ := newTestProcessor(t, tc.cfg)
+			file, err := p.Process(context.Background(), bytes.NewReader(tc.data))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMime, file.Mime)
+			var widths []int
+			for _, thumb := range file.Thumbnails {
+				widths = append(widths, thumb.Width)
+				rc, mime, err := p.Open(context.Background(), thumb.Name)
+				require.NoError(t, err)
+				img, _, err := image.Decode(rc)
+				rc.Close()
+				require.NoError(t, err)
+				assert.Equal(t, thumb.Width, img.Bounds().Dx())
+				assert.Equal(t, thumb.Height, img.Bounds().Dy())
+				assert.Contains(t, []string{"image/png", "image/jpeg"}, mime)
+			}
+			assert.Equal(t, tc.wantThumbs, widths)
+		})
+	}
+}
+
+func TestProcessGIFCanvas(t *testing.T) {
+	// 第一帧只覆盖画布的一部分
+	data := animatedGIF(t, 300, 100, 2, image.Rect(10, 10, 60, 60))
+	p, _ := newTestProcessor(t, DefaultConfig)
+	file, err := p.Process(context.Background(), bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, file.Width)
+	assert.Equal(t, 100, file.Height)
+	require.Len(t, file.Thumbnails, 1)
+	assert.Equal(t, 160, file.Thumbnails[0].Width)
+	assert.Equal(t, 53, file.Thumbnails[0].Height)
+}
+
+func TestGIFFrames(t *testing.T) {
+	frames, pixels, err := gifFrames(animatedGIF(t, 300, 100, 3, image.Rect(10, 10, 60, 60)))
+	require.NoError(t, err)
+	assert.Equal(t, 3, frames)
+	assert.Equal(t, 3*50*50, pixels)
+
+	_, _, err = gifFrames([]byte("GIF89a"))
+	assert.Error(t, err)
+}
+
+func TestProcessStripsExif(t *testing.T) {
+	p, _ := newTestProcessor(t, DefaultConfig)
+	data := withExif(t, testImage(40, 20), 6)
+	require.Equal(t, 6, jpegOrientation(data))
+
+	file, err := p.Process(context.Background(), bytes.NewReader(data))
+	require.NoError(t, err)
+	// 按方向转正后宽高互换
+	assert.Equal(t, 20, file.Width)
+	assert.Equal(t, 40, file.Height)
+
+	rc, mime, err := p.Open(context.Background(), file.Name)
+	require.NoError(t, err)
+	defer rc.Close()
+	stored, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", mime)
+	assert.NotContains(t, string(stored), "Exif")
+	assert.Equal(t, 1, jpegOrientation(stored))
+}
+
+func TestProcessContentAddressed(t *testing.T) {
+	p, _ := newTestProcessor(t, DefaultConfig)
+	data := encodePNG(t, testImage(100, 100))
+	first, err := p.Process(context.Background(), bytes.NewReader(data))
+	require.NoError(t, err)
+	second, err := p.Process(context.Background(), bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, first.Name, second.Name)
+	assert.Len(t, first.Hash, 64)
+}
+
+func TestOrient(t *testing.T) {
+	src := testImage(3, 2)
+	red := color.NRGBA{R: 255, A: 255}
+	testCases := []struct {
+		orientation int
+		w, h        int
+		// 原图左上角转正后所在的位置
+		x, y int
+	}{
+		{orientation: 1, w: 3, h: 2, x: 0, y: 0},
+		{orientation: 2, w: 3, h: 2, x: 2, y: 0},
+		{orientation: 3, w: 3, h: 2, x: 2, y: 1},
+		{orientation: 4, w: 3, h: 2, x: 0, y: 1},
+		{orientation: 5, w: 2, h: 3, x: 0, y: 0},
+		{orientation: 6, w: 2, h: 3, x: 1, y: 0},
+		{orientation: 7, w: 2, h: 3, x: 1, y: 2},
+		{orientation: 8, w: 2, h: 3, x: 0, y: 2},
+	}
+	for _, tc := range testCases {
+		dst := orient(src, tc.orientation)
+		assert.Equal(t, tc.w, dst.Bounds().Dx(), "orientation %d", tc.orientation)
+		assert.Equal(t, tc.h, dst.Bounds().Dy(), "orientation %d", tc.orientation)
+		assert.Equal(t, red, color.NRGBAModel.Convert(dst.At(tc.x, tc.y)), "orientation %d", tc.orientation)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	p, _ := newTestProcessor(t, DefaultConfig)
+	for _, name := range []string{"", "../etc/passwd", "abc.png", "ab/cd/x.png"} {
+		_, _, err := p.Open(context.Background(), name)
+		assert.ErrorIs(t, err, ErrNotFound, name)
+	}
+	missing := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.png"
+	_, _, err := p.Open(context.Background(), missing)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "ab/cd/file.txt", bytes.NewReader([]byte("hello"))))
+	ok, err := s.Exists(ctx, "ab/cd/file.txt")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	rc, err := s.Open(ctx, "ab/cd/file.txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, s.Delete(ctx, "ab/cd/file.txt"))
+	_, err = s.Open(ctx, "ab/cd/file.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+	// 删除不存在的文件不报错
+	assert.NoError(t, s.Delete(ctx, "ab/cd/file.txt"))
+
+	assert.Error(t, s.Put(ctx, "../escape", bytes.NewReader(nil)))
+}
@@ -0,0 +1,19 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("文件不存在")
+
+// Storage 按内容寻址的文件存储，key 由内容哈希生成，同一个 key 的内容不会改变
+type Storage interface {
+	// Put 写入文件，key 已存在时直接覆盖
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open 文件不存在时返回 ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,61 @@
+package mention
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxPerContent 单篇内容最多解析的提及数，避免一条评论触发大量用户查询
+const MaxPerContent = 20
+
+// @ 前面必须是开头或非用户名字符，避免把邮箱地址当成提及
+var pattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_.@-])@([\p{L}\p{N}_-]{1,32})`)
+
+// LinkPrefix 渲染提及时用户主页的链接前缀
+var LinkPrefix = "/user/profile/"
+
+// Parse 按出现顺序返回去重后的用户名
+func Parse(content string) []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, m := range pattern.FindAllStringSubmatch(content, -1) {
+		name := m[2]
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+		if len(names) >= MaxPerContent {
+			break
+		}
+	}
+	return names
+}
+
+// Render 把已解析到的用户名替换为 markdown 链接，未知用户名保持原样
+func Render(content string, known map[string]struct{}) string {
+	if len(known) == 0 {
+		return content
+	}
+	var sb strings.Builder
+	last := 0
+	for _, idx := range pattern.FindAllStringSubmatchIndex(content, -1) {
+		// idx[4]:idx[5] 为用户名，@ 在它前面一位
+		name := content[idx[4]:idx[5]]
+		if _, ok := known[name]; !ok {
+			continue
+		}
+		at := idx[4] - 1
+		sb.WriteString(content[last:at])
+		sb.WriteString("[@")
+		sb.WriteString(name)
+		sb.WriteString("](")
+		sb.WriteString(LinkPrefix)
+		sb.WriteString(url.PathEscape(name))
+		sb.WriteString(")")
+		last = idx[5]
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
@@ -0,0 +1,40 @@
+package mention
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "多个提及并去重",
+			content: "@alice 你好，@bob 和 @alice 一起看看",
+			want:    []string{"alice", "bob"},
+		},
+		{
+			name:    "邮箱不是提及",
+			content: "发到 alice@example.com",
+		},
+		{
+			name:    "中文用户名",
+			content: "谢谢 @小明!",
+			want:    []string{"小明"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Parse(tc.content))
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	got := Render("@alice 和 @nobody 你好", map[string]struct{}{"alice": {}})
+	assert.Equal(t, "[@alice](/user/profile/alice) 和 @nobody 你好", got)
+}
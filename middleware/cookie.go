@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	// AuthModeHeader 登录时带上 X-Auth-Mode: cookie 改用 cookie 模式，否则 token 放在 Authorization 响应头
+	AuthModeHeader = "X-Auth-Mode"
+	// CSRFHeader cookie 模式下修改数据的请求需要把 CSRF cookie 的值放在这个请求头里
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFClaim token 中记录的 CSRF token，请求头必须与它一致
+	CSRFClaim = "csrf"
+
+	authCookieKey = "auth_cookie"
+)
+
+// TokenCookie 浏览器使用的 cookie 模式：token 放在 HttpOnly cookie 中，前端脚本读不到；
+// 另外下发一个脚本可读的 CSRF cookie，修改数据的请求需要把它的值放到 X-CSRF-Token 请求头（double submit）。
+// 其他站点的页面能让浏览器带上 cookie，但读不到 CSRF cookie 的值
+type TokenCookie struct {
+	Name     string
+	CSRFName string
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+var DefaultTokenCookie = TokenCookie{
+	Name:     "access_token",
+	CSRFName: "csrf_token",
+	Path:     "/",
+	Secure:   true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// UseCookie 登录时声明了 cookie 模式，或当前请求本身就是用 cookie 认证的
+func UseCookie(ctx *gin.Context) bool {
+	return ctx.GetHeader(AuthModeHeader) == "cookie" || ctx.GetBool(authCookieKey)
+}
+
+// NewCSRFToken 生成随机的 CSRF token，需要同时写入 token 的 CSRFClaim 和 CSRF cookie
+func NewCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Set 写入 token 和 CSRF cookie，两者的有效期与 token 一致
+func (c TokenCookie) Set(ctx *gin.Context, token string, csrf string, ttl time.Duration) {
+	c.set(ctx, c.Name, token, int(ttl.Seconds()), true)
+	c.set(ctx, c.CSRFName, csrf, int(ttl.Seconds()), false)
+}
+
+// Clear 退出登录时删除 cookie
+func (c TokenCookie) Clear(ctx *gin.Context) {
+	c.set(ctx, c.Name, "", -1, true)
+	c.set(ctx, c.CSRFName, "", -1, false)
+}
+
+func (c TokenCookie) set(ctx *gin.Context, name string, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	})
+}
+
+// checkCSRF GET、HEAD、OPTIONS 不修改数据，不需要校验
+func checkCSRF(ctx *gin.Context, expected string) bool {
+	switch ctx.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	got := ctx.GetHeader(CSRFHeader)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"blog/domain"
+	"blog/errs"
+	"blog/i18n"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// EnvelopeHeader 客户端可以通过该请求头选择响应格式：
+// legacy 始终返回 200，错误只体现在 Result.Code 中；status 返回真实的 HTTP 状态码。
+// 不带该请求头时使用 ErrorBuilder 的默认格式
+const EnvelopeHeader = "X-Envelope"
+
+type ErrorBuilder struct {
+	legacy bool
+}
+
+// NewErrorBuilder 默认返回真实的 HTTP 状态码，只认 Result.Code 的老客户端
+// 通过 X-Envelope: legacy 或 Legacy(true) 使用旧的响应格式
+func NewErrorBuilder() *ErrorBuilder {
+	return &ErrorBuilder{}
+}
+
+// Legacy 设置不带 X-Envelope 请求头时是否使用旧的响应格式
+func (b *ErrorBuilder) Legacy(legacy bool) *ErrorBuilder {
+	b.legacy = legacy
+	return b
+}
+
+// Build 统一渲染 handler 通过 ctx.Error 记录的错误，需要放在其他中间件之前
+func (b *ErrorBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		last := ctx.Errors.Last()
+		if last == nil || ctx.Writer.Written() {
+			return
+		}
+		e := errs.From(last.Err)
+		if e.Status >= http.StatusInternalServerError {
+			zap.L().Error("请求处理失败", zap.Error(e), zap.String("path", ctx.FullPath()))
+		}
+
+		legacy := b.legacy
+		switch ctx.GetHeader(EnvelopeHeader) {
+		case "legacy":
+			legacy = true
+		case "status":
+			legacy = false
+		}
+		status := e.Status
+		if legacy {
+			status = http.StatusOK
+		}
+		lang := i18n.Resolve(ctx.GetString(i18n.ContextKey), ctx.GetHeader("Accept-Language"))
+		data := e.Data
+		if l, ok := data.(i18n.Localizer); ok {
+			data = l.Localize(lang)
+		}
+		ctx.Header("Content-Language", lang)
+		ctx.JSON(status, domain.Result{
+			Code:  e.Status,
+			Msg:   i18n.T(lang, string(e.Code), e.Args...),
+			Error: string(e.Code),
+			Data:  data,
+		})
+	}
+}
+
+// abort 记录错误并终止请求，由错误中间件负责渲染
+func abort(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
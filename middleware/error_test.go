@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"blog/domain"
+	"blog/errs"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorBuilder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []struct {
+		name     string
+		builder  *ErrorBuilder
+		envelope string
+		lang     string
+		wantCode int
+		wantMsg  string
+	}{
+		{
+			name:     "默认真实状态码",
+			builder:  NewErrorBuilder(),
+			wantCode: http.StatusNotFound,
+			wantMsg:  "资源不存在",
+		},
+		{
+			name:     "老客户端选择始终 200",
+			builder:  NewErrorBuilder(),
+			envelope: "legacy",
+			wantCode: http.StatusOK,
+			wantMsg:  "资源不存在",
+		},
+		{
+			name:     "兼容模式默认始终 200",
+			builder:  NewErrorBuilder().Legacy(true),
+			wantCode: http.StatusOK,
+			wantMsg:  "资源不存在",
+		},
+		{
+			name:     "兼容模式下新客户端选择真实状态码",
+			builder:  NewErrorBuilder().Legacy(true),
+			envelope: "status",
+			wantCode: http.StatusNotFound,
+			wantMsg:  "资源不存在",
+		},
+		{
+			name:     "按 Accept-Language 翻译",
+			builder:  NewErrorBuilder(),
+			lang:     "en",
+			wantCode: http.StatusNotFound,
+			wantMsg:  "Resource not found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(tc.builder.Build())
+			server.GET("/posts/detail/:id", func(ctx *gin.Context) {
+				abort(ctx, errs.ErrNotFound)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/posts/detail/1", nil)
+			if tc.envelope != "" {
+				req.Header.Set(EnvelopeHeader, tc.envelope)
+			}
+			if tc.lang != "" {
+				req.Header.Set("Accept-Language", tc.lang)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+
+			var res domain.Result
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			assert.Equal(t, http.StatusNotFound, res.Code)
+			assert.Equal(t, "not_found", res.Error)
+			assert.Equal(t, tc.wantMsg, res.Msg)
+		})
+	}
+}
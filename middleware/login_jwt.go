@@ -1,63 +1,208 @@
 package middleware
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"blog/errs"
+	"blog/i18n"
+	"blog/jwks"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"net/http"
+	"github.com/golang-jwt/jwt/v5"
 	"strings"
 )
 
 type LoginJWTMiddleware struct {
-	paths []string
+	keys     *jwks.KeySet
+	rules    []routeRule
+	checks   []func(ctx *gin.Context, claims jwt.MapClaims) bool
+	optional bool
+	fullPath bool
+	cookie   *TokenCookie
+	// 以 prefix 开头的 token 交给 authenticator 校验，不按 JWT 解析
+	prefix        string
+	authenticator func(ctx *gin.Context, token string) (Principal, error)
 }
 
-func NewLoginJWTMiddleware() *LoginJWTMiddleware {
-	return &LoginJWTMiddleware{}
+const (
+	// ScopesKey 使用 API token 时 context 中保存 token 的权限范围，登录 token 没有这个值，拥有全部权限
+	ScopesKey = "scopes"
+	// SessionKey 登录 token 所属会话的 ID，同时也是 token 中的 claim 名
+	SessionKey = "sid"
+)
+
+// Principal 通过 JWT 以外的 token 认证的用户
+type Principal struct {
+	UserID   int64
+	Username string
+	Lang     string
+	Scopes   []string
+}
+
+// routeRule method 为空时匹配所有请求方法
+type routeRule struct {
+	method  string
+	pattern pathPattern
+}
+
+// NewLoginJWTMiddleware keys 中的任一密钥签发的 token 都能通过校验
+func NewLoginJWTMiddleware(keys *jwks.KeySet) *LoginJWTMiddleware {
+	return &LoginJWTMiddleware{keys: keys}
+}
+
+// IgnorePath 不需要登录的路径，支持通配符和前缀，如 /posts/detail/:id、/sitemaps/*.xml、/public/**，
+// 规则写法见 pathPattern，规则无效时 panic
+func (l *LoginJWTMiddleware) IgnorePath(pattern string) *LoginJWTMiddleware {
+	return l.IgnoreRoute("", pattern)
+}
+
+// IgnoreRoute 只对指定的请求方法生效，如 GET /posts/detail/:id 免登录而同路径的 DELETE 仍需登录
+func (l *LoginJWTMiddleware) IgnoreRoute(method string, pattern string) *LoginJWTMiddleware {
+	p, err := compilePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	l.rules = append(l.rules, routeRule{method: strings.ToUpper(method), pattern: p})
+	return l
+}
+
+// MatchFullPath 用 gin 匹配到的路由模板而不是请求路径来匹配规则，
+// 规则与注册的路由保持一致，未匹配到路由的请求不会被忽略
+func (l *LoginJWTMiddleware) MatchFullPath() *LoginJWTMiddleware {
+	l.fullPath = true
+	return l
 }
 
-func (l *LoginJWTMiddleware) IgnorePath(path string) *LoginJWTMiddleware {
-	l.paths = append(l.paths, path)
+// Check 增加额外的 token 校验，例如 token 是否已被吊销，返回 false 时拒绝请求
+func (l *LoginJWTMiddleware) Check(fn func(ctx *gin.Context, claims jwt.MapClaims) bool) *LoginJWTMiddleware {
+	l.checks = append(l.checks, fn)
+	return l
+}
+
+// Optional 可选登录：带了有效 token 就记录当前用户，没带或无效时按匿名用户放行，
+// 是否必须登录由各路由自己声明
+func (l *LoginJWTMiddleware) Optional() *LoginJWTMiddleware {
+	l.optional = true
+	return l
+}
+
+// Cookie 同时接受 cookie 中的 token，Authorization 请求头优先。
+// 用 cookie 认证的请求修改数据时需要通过 CSRF 校验，即使是可选登录也会直接拒绝
+func (l *LoginJWTMiddleware) Cookie(c TokenCookie) *LoginJWTMiddleware {
+	l.cookie = &c
+	return l
+}
+
+// AccessToken 同时接受个人访问令牌等不透明 token，只从 Authorization 请求头读取，不受 CSRF 影响
+func (l *LoginJWTMiddleware) AccessToken(prefix string, fn func(ctx *gin.Context, token string) (Principal, error)) *LoginJWTMiddleware {
+	l.prefix = prefix
+	l.authenticator = fn
 	return l
 }
 
 func (l *LoginJWTMiddleware) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		for _, path := range l.paths {
-			if ctx.Request.URL.Path == path {
-				return
-			}
-		}
-		tokenHeader := ctx.GetHeader("Authorization")
-		if tokenHeader == "" {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
+		if l.ignored(ctx) {
 			return
 		}
-		segs := strings.SplitN(tokenHeader, " ", 2)
-		if len(segs) != 2 {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
+		err := l.authenticate(ctx)
+		if err != nil && (!l.optional || errors.Is(err, errs.CSRFInvalid)) {
+			abort(ctx, err)
 		}
-		tokenStr := segs[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return []byte("Qk1Qb2p6b3h1b1l6b2p6b3h1b1l6b2p6b3h1b1l6b2p6b3h1b1l6b2o="), nil
-		})
-		if err != nil {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
+	}
+}
+
+func (l *LoginJWTMiddleware) ignored(ctx *gin.Context) bool {
+	if len(l.rules) == 0 {
+		return false
+	}
+	p := ctx.Request.URL.Path
+	if l.fullPath {
+		p = ctx.FullPath()
+		if p == "" {
+			return false
 		}
-		if token == nil || !token.Valid {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
+	}
+	for _, rule := range l.rules {
+		if rule.method != "" && rule.method != ctx.Request.Method {
+			continue
 		}
+		if rule.pattern.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate 校验 token 并把用户信息存到 context 中，token 缺失或无效时返回 errs.ErrUnauthenticated
+func (l *LoginJWTMiddleware) authenticate(ctx *gin.Context) error {
+	tokenStr, fromCookie := l.token(ctx)
+	if tokenStr == "" {
+		return errs.ErrUnauthenticated
+	}
+	if l.authenticator != nil && !fromCookie && strings.HasPrefix(tokenStr, l.prefix) {
+		return l.authenticateAccessToken(ctx, tokenStr)
+	}
+	claims := jwt.MapClaims{}
+	if err := l.keys.Parse(tokenStr, claims); err != nil {
+		return errs.ErrUnauthenticated
+	}
+	if fromCookie {
+		csrf, _ := claims[CSRFClaim].(string)
+		if !checkCSRF(ctx, csrf) {
+			return errs.CSRFInvalid
+		}
+	}
+	// 先完成所有校验再写入 context，避免被吊销的 token 在可选登录模式下残留用户信息
+	for _, check := range l.checks {
+		if !check(ctx, claims) {
+			return errs.ErrUnauthenticated
+		}
+	}
+	ctx.Set(authCookieKey, fromCookie)
 
-		//从token中提取用户信息，并存储到context中
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if userId, exist := claims["id"]; exist {
-				ctx.Set("user_id", userId)
-			}
-			if username, exist := claims["username"]; exist {
-				ctx.Set("username", username)
-			}
+	//从token中提取用户信息，并存储到context中
+	if userId, exist := claims["id"]; exist {
+		ctx.Set("user_id", userId)
+	}
+	if username, exist := claims["username"]; exist {
+		ctx.Set("username", username)
+	}
+	if lang, exist := claims["lang"].(string); exist {
+		ctx.Set(i18n.ContextKey, lang)
+	}
+	if sid, exist := claims[SessionKey].(string); exist {
+		ctx.Set(SessionKey, sid)
+	}
+	return nil
+}
+
+func (l *LoginJWTMiddleware) authenticateAccessToken(ctx *gin.Context, tokenStr string) error {
+	p, err := l.authenticator(ctx, tokenStr)
+	if err != nil {
+		return errs.ErrUnauthenticated.With(err)
+	}
+	// 与 JWT 解析出来的类型保持一致
+	ctx.Set("user_id", float64(p.UserID))
+	ctx.Set("username", p.Username)
+	if p.Lang != "" {
+		ctx.Set(i18n.ContextKey, p.Lang)
+	}
+	ctx.Set(ScopesKey, p.Scopes)
+	return nil
+}
+
+// token 优先使用 Authorization 请求头，没有时再读 cookie
+func (l *LoginJWTMiddleware) token(ctx *gin.Context) (string, bool) {
+	if tokenHeader := ctx.GetHeader("Authorization"); tokenHeader != "" {
+		segs := strings.SplitN(tokenHeader, " ", 2)
+		if len(segs) != 2 {
+			return "", false
+		}
+		return segs[1], false
+	}
+	if l.cookie != nil {
+		if tokenStr, err := ctx.Cookie(l.cookie.Name); err == nil {
+			return tokenStr, true
 		}
 	}
+	return "", false
 }
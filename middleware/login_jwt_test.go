@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"blog/jwks"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T) *jwks.KeySet {
+	key, err := jwks.Generate("test")
+	require.NoError(t, err)
+	keys, err := jwks.New([]*jwks.Key{key}, "")
+	require.NoError(t, err)
+	return keys
+}
+
+func TestLoginJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := testKeys(t)
+	valid, err := keys.Sign(jwt.MapClaims{"id": 7, "username": "alice", "lang": "en", "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	forged, err := testKeys(t).Sign(jwt.MapClaims{"id": 7, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		optional bool
+		header   string
+		wantCode int
+		wantUser any
+	}{
+		{name: "有效 token", header: "Bearer " + valid, wantCode: http.StatusOK, wantUser: float64(7)},
+		{name: "没有 token", wantCode: http.StatusUnauthorized},
+		{name: "其他密钥签发", header: "Bearer " + forged, wantCode: http.StatusUnauthorized},
+		{name: "格式错误", header: valid, wantCode: http.StatusUnauthorized},
+		{name: "可选登录带有效 token", optional: true, header: "Bearer " + valid, wantCode: http.StatusOK, wantUser: float64(7)},
+		{name: "可选登录没有 token", optional: true, wantCode: http.StatusOK},
+		{name: "可选登录 token 无效", optional: true, header: "Bearer " + forged, wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw := NewLoginJWTMiddleware(keys)
+			if tc.optional {
+				mw.Optional()
+			}
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build(), mw.Build())
+			var user any
+			server.GET("/", func(ctx *gin.Context) {
+				user, _ = ctx.Get("user_id")
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantUser, user)
+		})
+	}
+}
+
+func TestLoginJWTCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := testKeys(t)
+	exp := time.Now().Add(time.Hour).Unix()
+	withCSRF, err := keys.Sign(jwt.MapClaims{"id": 7, CSRFClaim: "csrf-1", "exp": exp})
+	require.NoError(t, err)
+	withoutCSRF, err := keys.Sign(jwt.MapClaims{"id": 7, "exp": exp})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		method   string
+		cookie   string
+		header   string
+		csrf     string
+		wantCode int
+		wantUser any
+	}{
+		{name: "GET 不校验 CSRF", method: http.MethodGet, cookie: withCSRF, wantCode: http.StatusOK, wantUser: float64(7)},
+		{name: "POST 带正确的 CSRF", method: http.MethodPost, cookie: withCSRF, csrf: "csrf-1", wantCode: http.StatusOK, wantUser: float64(7)},
+		{name: "POST 没有 CSRF", method: http.MethodPost, cookie: withCSRF, wantCode: http.StatusForbidden},
+		{name: "POST CSRF 错误", method: http.MethodPost, cookie: withCSRF, csrf: "csrf-2", wantCode: http.StatusForbidden},
+		{name: "token 中没有 CSRF", method: http.MethodPost, cookie: withoutCSRF, csrf: "", wantCode: http.StatusForbidden},
+		// API 客户端使用请求头，浏览器不会自动带上，不需要 CSRF
+		{name: "请求头优先", method: http.MethodPost, cookie: withCSRF, header: "Bearer " + withoutCSRF, wantCode: http.StatusOK, wantUser: float64(7)},
+		{name: "cookie 无效按匿名处理", method: http.MethodPost, cookie: "invalid", wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build(),
+				NewLoginJWTMiddleware(keys).Optional().Cookie(DefaultTokenCookie).Build())
+			var user any
+			handler := func(ctx *gin.Context) {
+				user, _ = ctx.Get("user_id")
+				ctx.Status(http.StatusOK)
+			}
+			server.GET("/", handler)
+			server.POST("/", handler)
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			req.AddCookie(&http.Cookie{Name: DefaultTokenCookie.Name, Value: tc.cookie})
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			if tc.csrf != "" {
+				req.Header.Set(CSRFHeader, tc.csrf)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantUser, user)
+		})
+	}
+}
+
+func TestLoginJWTAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := testKeys(t)
+	valid, err := keys.Sign(jwt.MapClaims{"id": 7, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	authenticator := func(ctx *gin.Context, token string) (Principal, error) {
+		if token != "pat_good" {
+			return Principal{}, errors.New("unknown token")
+		}
+		return Principal{UserID: 9, Username: "ci", Scopes: []string{"read"}}, nil
+	}
+
+	testCases := []struct {
+		name       string
+		header     string
+		cookie     string
+		wantCode   int
+		wantUser   any
+		wantScopes any
+	}{
+		{name: "有效的访问令牌", header: "Bearer pat_good", wantCode: http.StatusOK, wantUser: float64(9), wantScopes: []string{"read"}},
+		{name: "无效的访问令牌", header: "Bearer pat_bad", wantCode: http.StatusUnauthorized},
+		{name: "JWT 不受影响", header: "Bearer " + valid, wantCode: http.StatusOK, wantUser: float64(7)},
+		// 访问令牌只能放在请求头中，cookie 中的按 JWT 解析
+		{name: "cookie 中的访问令牌", cookie: "pat_good", wantCode: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build(),
+				NewLoginJWTMiddleware(keys).Cookie(DefaultTokenCookie).AccessToken("pat_", authenticator).Build())
+			var user, scopes any
+			server.GET("/", func(ctx *gin.Context) {
+				user, _ = ctx.Get("user_id")
+				scopes, _ = ctx.Get(ScopesKey)
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultTokenCookie.Name, Value: tc.cookie})
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantUser, user)
+			assert.Equal(t, tc.wantScopes, scopes)
+		})
+	}
+}
+
+func TestLoginJWTSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := testKeys(t)
+	exp := time.Now().Add(time.Hour).Unix()
+	active, err := keys.Sign(jwt.MapClaims{"id": 7, SessionKey: "s-active", "exp": exp})
+	require.NoError(t, err)
+	revoked, err := keys.Sign(jwt.MapClaims{"id": 7, SessionKey: "s-revoked", "exp": exp})
+	require.NoError(t, err)
+	checkSession := func(ctx *gin.Context, claims jwt.MapClaims) bool {
+		return claims[SessionKey] != "s-revoked"
+	}
+
+	testCases := []struct {
+		name     string
+		optional bool
+		token    string
+		wantCode int
+		wantSID  any
+		wantUser any
+	}{
+		{name: "有效会话", token: active, wantCode: http.StatusOK, wantSID: "s-active", wantUser: float64(7)},
+		{name: "会话已吊销", token: revoked, wantCode: http.StatusUnauthorized},
+		// 可选登录时按匿名放行，不残留用户信息
+		{name: "可选登录会话已吊销", optional: true, token: revoked, wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw := NewLoginJWTMiddleware(keys).Check(checkSession)
+			if tc.optional {
+				mw.Optional()
+			}
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build(), mw.Build())
+			var sid, user any
+			server.GET("/", func(ctx *gin.Context) {
+				sid, _ = ctx.Get(SessionKey)
+				user, _ = ctx.Get("user_id")
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantSID, sid)
+			assert.Equal(t, tc.wantUser, user)
+		})
+	}
+}
+
+func TestTokenCookie(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	DefaultTokenCookie.Set(ctx, "token", "csrf", time.Hour)
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "token", cookies[0].Value)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	assert.Equal(t, 3600, cookies[0].MaxAge)
+	// 前端需要读取 CSRF cookie
+	assert.Equal(t, "csrf", cookies[1].Value)
+	assert.False(t, cookies[1].HttpOnly)
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pathPattern 路径匹配规则，按 / 分段比较：
+//   - 普通段精确匹配，也可以使用 path.Match 的通配符，如 *.xml
+//   - * 或 :name 匹配任意一段，因此可以直接写 gin 的路由模板，如 /posts/detail/:id
+//   - 末尾的 ** 匹配零或多段，用作前缀匹配，如 /admin/**
+//
+// 匹配前会清理路径并去掉末尾的 /，/posts/list/ 与 /posts/list 视为同一路径
+type pathPattern struct {
+	segs   []string
+	prefix bool
+}
+
+func compilePattern(pattern string) (pathPattern, error) {
+	segs := splitPath(pattern)
+	var p pathPattern
+	for i, seg := range segs {
+		if seg == "**" {
+			if i != len(segs)-1 {
+				return p, fmt.Errorf("路径规则 %q 中的 ** 只能出现在末尾", pattern)
+			}
+			p.prefix = true
+			break
+		}
+		if strings.HasPrefix(seg, ":") {
+			seg = "*"
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return p, fmt.Errorf("路径规则 %q 无效: %w", pattern, err)
+		}
+		p.segs = append(p.segs, seg)
+	}
+	return p, nil
+}
+
+func (p pathPattern) match(urlPath string) bool {
+	segs := splitPath(urlPath)
+	if len(segs) < len(p.segs) || (!p.prefix && len(segs) != len(p.segs)) {
+		return false
+	}
+	for i, pat := range p.segs {
+		if ok, _ := path.Match(pat, segs[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
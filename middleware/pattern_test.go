@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPattern(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{name: "精确匹配", pattern: "/user/login", path: "/user/login", want: true},
+		{name: "末尾斜杠", pattern: "/user/login", path: "/user/login/", want: true},
+		{name: "规则带斜杠", pattern: "/user/login/", path: "/user/login", want: true},
+		{name: "多余的斜杠", pattern: "/user/login", path: "//user//login", want: true},
+		{name: "不同路径", pattern: "/user/login", path: "/user/signup"},
+		{name: "路由参数", pattern: "/posts/detail/:id", path: "/posts/detail/12", want: true},
+		{name: "路由参数只匹配一段", pattern: "/posts/detail/:id", path: "/posts/detail/12/comments"},
+		{name: "路由参数不能为空", pattern: "/posts/detail/:id", path: "/posts/detail"},
+		{name: "星号", pattern: "/posts/*/comments", path: "/posts/3/comments", want: true},
+		{name: "段内通配符", pattern: "/sitemaps/*.xml", path: "/sitemaps/1.xml", want: true},
+		{name: "段内通配符不匹配", pattern: "/sitemaps/*.xml", path: "/sitemaps/1.txt"},
+		{name: "前缀", pattern: "/media/files/**", path: "/media/files/ab/cd.png", want: true},
+		{name: "前缀本身", pattern: "/media/files/**", path: "/media/files", want: true},
+		{name: "前缀不匹配相似路径", pattern: "/media/files/**", path: "/media/filesx"},
+		{name: "根路径", pattern: "/", path: "/", want: true},
+		{name: "全部", pattern: "/**", path: "/a/b", want: true},
+		{name: "路由模板", pattern: "/posts/detail/:id", path: "/posts/detail/:id", want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := compilePattern(tc.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, p.match(tc.path))
+		})
+	}
+}
+
+func TestCompilePatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"/a/**/b", "/a/[b"} {
+		_, err := compilePattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+	assert.Panics(t, func() { NewLoginJWTMiddleware(testKeys(t)).IgnorePath("/a/[") })
+}
+
+func TestLoginJWTIgnore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []struct {
+		name   string
+		mw     *LoginJWTMiddleware
+		method string
+		path   string
+		want   int
+	}{
+		{
+			name:   "忽略带参数的路由",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).IgnorePath("/posts/detail/:id"),
+			method: http.MethodGet,
+			path:   "/posts/detail/1",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "按方法忽略",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).IgnoreRoute(http.MethodGet, "/posts/detail/*"),
+			method: http.MethodGet,
+			path:   "/posts/detail/1",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "其他方法仍需登录",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).IgnoreRoute(http.MethodGet, "/posts/detail/*"),
+			method: http.MethodDelete,
+			path:   "/posts/detail/1",
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "按路由模板匹配",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).MatchFullPath().IgnorePath("/posts/detail/:id"),
+			method: http.MethodGet,
+			path:   "/posts/detail/1",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "路由模板与请求路径不同",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).MatchFullPath().IgnorePath("/posts/detail/1"),
+			method: http.MethodGet,
+			path:   "/posts/detail/1",
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "前缀",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).IgnorePath("/posts/**"),
+			method: http.MethodDelete,
+			path:   "/posts/detail/1",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "未匹配的路径需要登录",
+			mw:     NewLoginJWTMiddleware(testKeys(t)).IgnorePath("/user/login"),
+			method: http.MethodGet,
+			path:   "/posts/detail/1",
+			want:   http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build())
+			server.Use(tc.mw.Build())
+			ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+			server.GET("/posts/detail/:id", ok)
+			server.DELETE("/posts/detail/:id", ok)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.want, recorder.Code)
+		})
+	}
+}
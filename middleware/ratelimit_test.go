@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"blog/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type resp struct {
+		code      int
+		remaining string
+	}
+	testCases := []struct {
+		name   string
+		mw     *RateLimitBuilder
+		method string
+		path   string
+		// 依次发送请求后每次的结果，remaining 为空表示没有限流响应头
+		want []resp
+	}{
+		{
+			name:   "超过额度返回 429",
+			mw:     NewRateLimitBuilder("test", ratelimit.NewSlidingWindow(ratelimit.NewMemoryStore(), 2, time.Minute)),
+			method: http.MethodPost,
+			path:   "/comments/edit",
+			want: []resp{
+				{code: http.StatusOK, remaining: "1"},
+				{code: http.StatusOK, remaining: "0"},
+				{code: http.StatusTooManyRequests, remaining: "0"},
+			},
+		},
+		{
+			name: "匹配 Only 的路由限流",
+			mw: NewRateLimitBuilder("test", ratelimit.NewSlidingWindow(ratelimit.NewMemoryStore(), 1, time.Minute)).
+				Only(http.MethodPost, "/comments/edit"),
+			method: http.MethodPost,
+			path:   "/comments/edit",
+			want: []resp{
+				{code: http.StatusOK, remaining: "0"},
+				{code: http.StatusTooManyRequests, remaining: "0"},
+			},
+		},
+		{
+			name: "不匹配 Only 的路由不限流",
+			mw: NewRateLimitBuilder("test", ratelimit.NewSlidingWindow(ratelimit.NewMemoryStore(), 1, time.Minute)).
+				Only(http.MethodPost, "/comments/edit"),
+			method: http.MethodGet,
+			path:   "/comments/stream/1",
+			want: []resp{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(NewErrorBuilder().Build())
+			cg := server.Group("/comments", tc.mw.Build())
+			ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+			cg.POST("/edit", ok)
+			cg.GET("/stream/:postId", ok)
+
+			for i, want := range tc.want {
+				recorder := httptest.NewRecorder()
+				server.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+				assert.Equal(t, want.code, recorder.Code, "第 %d 次请求", i+1)
+				assert.Equal(t, want.remaining, recorder.Header().Get("RateLimit-Remaining"), "第 %d 次请求", i+1)
+				if want.remaining == "" {
+					assert.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+					continue
+				}
+				assert.NotEmpty(t, recorder.Header().Get("RateLimit-Limit"))
+				reset, err := strconv.Atoi(recorder.Header().Get("RateLimit-Reset"))
+				require.NoError(t, err)
+				assert.Positive(t, reset)
+				if want.code != http.StatusTooManyRequests {
+					assert.Empty(t, recorder.Header().Get("Retry-After"))
+					continue
+				}
+				retry, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+				require.NoError(t, err)
+				assert.Positive(t, retry)
+				assert.LessOrEqual(t, retry, 60)
+			}
+		})
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	testCases := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{name: "向上取整", d: 1500 * time.Millisecond, want: "2"},
+		{name: "整秒", d: 3 * time.Second, want: "3"},
+		{name: "负数按 0", d: -time.Second, want: "0"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ceilSeconds(tc.d))
+		})
+	}
+}
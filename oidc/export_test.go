@@ -0,0 +1,7 @@
+package oidc
+
+import "time"
+
+func SetRefreshInterval(c *Client, d time.Duration) {
+	c.refreshInterval = d
+}
@@ -0,0 +1,309 @@
+package oidc
+
+import (
+	"blog/jwks"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNonce   = errors.New("id_token 的 nonce 不匹配")
+	ErrNoToken = errors.New("token 响应中没有 id_token")
+)
+
+// 刷新 JWKS 的最小间隔，避免伪造的 kid 让我们不停地请求身份提供方
+const jwksRefreshInterval = time.Minute
+
+// Config 在身份提供方注册的客户端
+type Config struct {
+	// Issuer 身份提供方的地址，用于发现 /.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL 本站的回调地址，需要与注册时填写的一致
+	RedirectURL string
+	// Scopes 为空时使用 openid email profile
+	Scopes []string
+}
+
+// Claims id_token 中登录需要的用户信息
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// AuthRequest 一次登录的随机参数，跳转前生成，回调时原样带回来校验
+type AuthRequest struct {
+	State string
+	Nonce string
+	// Verifier PKCE 的 code_verifier，跳转时只发送它的哈希
+	Verifier string
+}
+
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, p := range []*string{&req.State, &req.Nonce, &req.Verifier} {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return AuthRequest{}, err
+		}
+		*p = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return req, nil
+}
+
+// Challenge PKCE S256 的 code_challenge
+func (r AuthRequest) Challenge() string {
+	sum := sha256.Sum256([]byte(r.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client OIDC 授权码模式的依赖方，首次使用时才请求发现文档，启动时身份提供方不可用也不影响其他功能
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]any
+	keysFetched time.Time
+	// 刷新 JWKS 的最小间隔
+	refreshInterval time.Duration
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Client{cfg: cfg, http: httpClient, refreshInterval: jwksRefreshInterval}
+}
+
+// AuthCodeURL 跳转到身份提供方登录的地址
+func (c *Client) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.cfg.ClientID)
+	q.Set("redirect_uri", c.cfg.RedirectURL)
+	q.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", req.Challenge())
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange 用回调中的授权码换取 id_token 并校验签名、issuer、audience、过期时间和 nonce。
+// 调用方需要先校验回调中的 state 与 req.State 一致
+func (c *Client) Exchange(ctx context.Context, code string, req AuthRequest) (Claims, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectURL)
+	form.Set("code_verifier", req.Verifier)
+	if c.cfg.ClientSecret == "" {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		httpReq.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := c.doJSON(httpReq, &tokenResp)
+	if err != nil {
+		return Claims{}, err
+	}
+	if status != http.StatusOK {
+		return Claims{}, fmt.Errorf("换取 token 失败: %d %s %s", status, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return Claims{}, ErrNoToken
+	}
+	return c.verify(ctx, meta, tokenResp.IDToken, req.Nonce)
+}
+
+type idToken struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+func (c *Client) verify(ctx context.Context, meta *metadata, raw string, nonce string) (Claims, error) {
+	var tok idToken
+	_, err := jwt.ParseWithClaims(raw, &tok, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, meta, kid)
+	},
+		// 只接受非对称算法，不能用 client secret 当 HMAC 密钥
+		jwt.WithValidMethods([]string{jwks.AlgRS256, jwks.AlgEdDSA}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(tok.Nonce), []byte(nonce)) != 1 {
+		return Claims{}, ErrNonce
+	}
+	if len(tok.Audience) > 1 && tok.AuthorizedParty != c.cfg.ClientID {
+		return Claims{}, fmt.Errorf("id_token 的 azp %q 不是本站", tok.AuthorizedParty)
+	}
+	if tok.Subject == "" {
+		return Claims{}, errors.New("id_token 中没有 sub")
+	}
+	return Claims{
+		Subject:           tok.Subject,
+		Email:             tok.Email,
+		EmailVerified:     bool(tok.EmailVerified),
+		Name:              tok.Name,
+		PreferredUsername: tok.PreferredUsername,
+	}, nil
+}
+
+// key 按 kid 查找验证公钥，找不到时刷新一次 JWKS，身份提供方轮换密钥后不需要重启
+func (c *Client) key(ctx context.Context, meta *metadata, kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetched) < c.refreshInterval {
+		return nil, jwks.ErrUnknownKey
+	}
+	c.keysFetched = time.Now()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwks.JWKSet
+	status, err := c.doJSON(httpReq, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("获取 JWKS 失败: %d", status)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// 跳过不支持的密钥类型，只要有用到的那把就行
+		if pub, err := k.PublicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	c.keys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, jwks.ErrUnknownKey
+}
+
+func (c *Client) discover(ctx context.Context) (*metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta != nil {
+		return c.meta, nil
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	status, err := c.doJSON(httpReq, &meta)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %d", status)
+	}
+	// 规范要求发现文档中的 issuer 与配置的完全一致，防止被其他身份提供方冒充
+	if meta.Issuer != c.cfg.Issuer {
+		return nil, fmt.Errorf("发现文档中的 issuer %q 与配置的 %q 不一致", meta.Issuer, c.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("发现文档缺少必要的地址")
+	}
+	c.meta = &meta
+	return c.meta, nil
+}
+
+func (c *Client) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err = json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// flexBool 有的身份提供方把 email_verified 写成字符串 "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
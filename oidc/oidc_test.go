@@ -0,0 +1,168 @@
+package oidc_test
+
+import (
+	"blog/jwks"
+	"blog/oidc"
+	"blog/oidc/oidctest"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://blog.test/user/oidc/test/callback"
+
+// login 模拟浏览器：跳转到身份提供方，拿到回调中的授权码
+func login(t *testing.T, client *oidc.Client, req oidc.AuthRequest) (code string, state string) {
+	authURL, err := client.AuthCodeURL(context.Background(), req)
+	require.NoError(t, err)
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, redirectURL, callback.Scheme+"://"+callback.Host+callback.Path)
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func newClient(idp *oidctest.Server, secret string) *oidc.Client {
+	return oidc.NewClient(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  redirectURL,
+	}, idp.Client())
+}
+
+func TestExchange(t *testing.T) {
+	idp := oidctest.NewServer("blog", "secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	client := newClient(idp, "secret")
+
+	req, err := oidc.NewAuthRequest()
+	require.NoError(t, err)
+	code, state := login(t, client, req)
+	assert.Equal(t, req.State, state)
+
+	claims, err := client.Exchange(context.Background(), code, req)
+	require.NoError(t, err)
+	assert.Equal(t, oidc.Claims{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, claims)
+
+	// 授权码只能用一次
+	_, err = client.Exchange(context.Background(), code, req)
+	assert.Error(t, err)
+}
+
+func TestExchangeRejects(t *testing.T) {
+	testCases := []struct {
+		name   string
+		secret string
+		claims func(claims jwt.MapClaims)
+		// tamper 修改回调时带回来的参数
+		tamper func(req *oidc.AuthRequest)
+	}{
+		{
+			name:   "PKCE verifier 不匹配",
+			secret: "secret",
+			tamper: func(req *oidc.AuthRequest) { req.Verifier += "x" },
+		},
+		{
+			name:   "nonce 不匹配",
+			secret: "secret",
+			tamper: func(req *oidc.AuthRequest) { req.Nonce += "x" },
+		},
+		{
+			name:   "client secret 错误",
+			secret: "wrong",
+		},
+		{
+			name:   "audience 不是本站",
+			secret: "secret",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = "other" },
+		},
+		{
+			name:   "多个 audience 且 azp 不是本站",
+			secret: "secret",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = []string{"blog", "other"}; claims["azp"] = "other" },
+		},
+		{
+			name:   "issuer 不一致",
+			secret: "secret",
+			claims: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		},
+		{
+			name:   "已过期",
+			secret: "secret",
+			claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := oidctest.NewServer("blog", "secret")
+			defer idp.Close()
+			idp.SetUser(oidctest.User{Subject: "u-1", Email: "alice@example.com", EmailVerified: true})
+			idp.Claims = tc.claims
+			client := newClient(idp, tc.secret)
+
+			req, err := oidc.NewAuthRequest()
+			require.NoError(t, err)
+			code, _ := login(t, client, req)
+			if tc.tamper != nil {
+				tc.tamper(&req)
+			}
+			_, err = client.Exchange(context.Background(), code, req)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// 身份提供方换了签名密钥，本地缓存的 JWKS 中没有新的 kid，超过最小间隔后自动刷新
+func TestExchangeKeyRotation(t *testing.T) {
+	idp := oidctest.NewServer("blog", "")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "u-1"})
+	client := newClient(idp, "")
+
+	exchange := func() error {
+		req, err := oidc.NewAuthRequest()
+		require.NoError(t, err)
+		code, _ := login(t, client, req)
+		_, err = client.Exchange(context.Background(), code, req)
+		return err
+	}
+	require.NoError(t, exchange())
+
+	key, err := jwks.Generate("idp-2")
+	require.NoError(t, err)
+	idp.Keys, err = jwks.New([]*jwks.Key{key}, "")
+	require.NoError(t, err)
+	// 刷新有最小间隔，刚刷新过时不会再请求
+	assert.ErrorIs(t, exchange(), jwks.ErrUnknownKey)
+
+	oidc.SetRefreshInterval(client, 0)
+	assert.NoError(t, exchange())
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer("blog", "")
+	defer idp.Close()
+	client := oidc.NewClient(oidc.Config{
+		Issuer:      idp.URL + "/other",
+		ClientID:    "blog",
+		RedirectURL: redirectURL,
+	}, idp.Client())
+	req, err := oidc.NewAuthRequest()
+	require.NoError(t, err)
+	_, err = client.AuthCodeURL(context.Background(), req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrTooManySubscribers = errors.New("订阅者数量已达上限")
+
+type Event struct {
+	ID    int64
+	Topic int64
+	Name  string
+	Data  any
+}
+
+// Hub 进程内的发布订阅中心，按 topic（如文章ID）分发事件
+type Hub struct {
+	mu         sync.RWMutex
+	topics     map[int64]map[*Subscription]struct{}
+	total      int
+	maxSubs    int
+	bufferSize int
+}
+
+func NewHub(maxSubs int, bufferSize int) *Hub {
+	return &Hub{
+		topics:     make(map[int64]map[*Subscription]struct{}),
+		maxSubs:    maxSubs,
+		bufferSize: bufferSize,
+	}
+}
+
+type Subscription struct {
+	hub   *Hub
+	topic int64
+	ch    chan Event
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Events 订阅收到的事件
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Done 订阅被关闭时关闭，消费过慢被 Hub 踢掉时也会关闭
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+func (h *Hub) Subscribe(topic int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.maxSubs > 0 && h.total >= h.maxSubs {
+		return nil, ErrTooManySubscribers
+	}
+	sub := &Subscription{
+		hub:   h,
+		topic: topic,
+		ch:    make(chan Event, h.bufferSize),
+		done:  make(chan struct{}),
+	}
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		h.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	h.total++
+	return sub, nil
+}
+
+// Publish 不会阻塞发布者，缓冲区已满的订阅者会被直接断开，由客户端带 Last-Event-ID 重连补齐
+func (h *Hub) Publish(evt Event) {
+	var slow []*Subscription
+	h.mu.RLock()
+	for sub := range h.topics[evt.Topic] {
+		select {
+		case sub.ch <- evt:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+}
+
+// Count 当前订阅者总数
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.total
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	sub.once.Do(func() {
+		h.mu.Lock()
+		subs := h.topics[sub.topic]
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, sub.topic)
+		}
+		h.total--
+		h.mu.Unlock()
+		close(sub.done)
+	})
+}
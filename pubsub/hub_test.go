@@ -0,0 +1,58 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, h *Hub)
+	}{
+		{
+			name: "按 topic 分发",
+			run: func(t *testing.T, h *Hub) {
+				a, err := h.Subscribe(1)
+				require.NoError(t, err)
+				b, err := h.Subscribe(2)
+				require.NoError(t, err)
+				h.Publish(Event{ID: 1, Topic: 1})
+				assert.Equal(t, int64(1), (<-a.Events()).ID)
+				assert.Len(t, b.Events(), 0)
+			},
+		},
+		{
+			name: "超过订阅上限",
+			run: func(t *testing.T, h *Hub) {
+				for i := 0; i < 2; i++ {
+					_, err := h.Subscribe(1)
+					require.NoError(t, err)
+				}
+				_, err := h.Subscribe(1)
+				assert.ErrorIs(t, err, ErrTooManySubscribers)
+			},
+		},
+		{
+			name: "消费过慢被断开",
+			run: func(t *testing.T, h *Hub) {
+				sub, err := h.Subscribe(1)
+				require.NoError(t, err)
+				h.Publish(Event{ID: 1, Topic: 1})
+				h.Publish(Event{ID: 2, Topic: 1})
+				h.Publish(Event{ID: 3, Topic: 1})
+				<-sub.Done()
+				assert.Equal(t, 0, h.Count())
+				sub.Close()
+				assert.Equal(t, 0, h.Count())
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, NewHub(2, 2))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter 额度完全恢复还需要的时间
+	ResetAfter time.Duration
+	// RetryAfter 被拒绝时，下次可以请求还需要等待的时间
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// TokenBucket 令牌桶，允许 burst 大小的突发流量，长期平均速率为 rate 次/秒
+type TokenBucket struct {
+	store Store
+	rate  float64
+	burst int
+}
+
+func NewTokenBucket(store Store, rate float64, burst int) *TokenBucket {
+	return &TokenBucket{store: store, rate: rate, burst: burst}
+}
+
+func (t *TokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	tokens, ok, err := t.store.TakeToken(ctx, key, t.rate, t.burst, time.Now())
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{
+		Allowed:    ok,
+		Limit:      t.burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: seconds((float64(t.burst) - tokens) / t.rate),
+	}
+	if !ok {
+		res.RetryAfter = seconds((1 - tokens) / t.rate)
+	}
+	return res, nil
+}
+
+// SlidingWindow 滑动窗口，任意 window 时长内最多 limit 次
+type SlidingWindow struct {
+	store  Store
+	limit  int
+	window time.Duration
+}
+
+func NewSlidingWindow(store Store, limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{store: store, limit: limit, window: window}
+}
+
+func (s *SlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+	count, oldest, ok, err := s.store.AddToWindow(ctx, key, s.limit, s.window, now)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{
+		Allowed:   ok,
+		Limit:     s.limit,
+		Remaining: s.limit - count,
+	}
+	if count > 0 {
+		res.ResetAfter = oldest.Add(s.window).Sub(now)
+	}
+	if !ok {
+		res.RetryAfter = res.ResetAfter
+	}
+	return res, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
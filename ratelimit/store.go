@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Store 限流状态存储，每个方法都必须是原子的，多实例部署时可以换成 Redis + Lua 的实现
+type Store interface {
+	// TakeToken 按 rate 补充令牌（最多 burst 个）后尝试取走一个，返回剩余令牌数
+	TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error)
+	// AddToWindow 清理窗口外的记录，未达到 limit 时记下本次请求，返回窗口内的请求数和最早一次的时间
+	AddToWindow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (int, time.Time, bool, error)
+}
+
+// 清理长时间没有访问的 key 的间隔
+const memorySweepInterval = time.Minute
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// 令牌补满的时间，之后可以清理
+	full time.Time
+}
+
+type window struct {
+	hits   []time.Time
+	expire time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		windows: make(map[string]*window),
+	}
+}
+
+func (m *MemoryStore) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		m.buckets[key] = b
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(seconds((float64(burst) - b.tokens) / rate))
+	return b.tokens, allowed, nil
+}
+
+func (m *MemoryStore) AddToWindow(ctx context.Context, key string, limit int, win time.Duration, now time.Time) (int, time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	w, ok := m.windows[key]
+	if !ok {
+		w = &window{hits: make([]time.Time, 0, limit)}
+		m.windows[key] = w
+	}
+	start := now.Add(-win)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(start) {
+		i++
+	}
+	w.hits = w.hits[i:]
+	allowed := len(w.hits) < limit
+	if allowed {
+		w.hits = append(w.hits, now)
+	}
+	w.expire = now.Add(win)
+	var oldest time.Time
+	if len(w.hits) > 0 {
+		oldest = w.hits[0]
+	}
+	return len(w.hits), oldest, allowed, nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < memorySweepInterval {
+		return
+	}
+	m.swept = now
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, w := range m.windows {
+		if now.After(w.expire) {
+			delete(m.windows, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_TakeToken(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		_, ok, err := store.TakeToken(context.Background(), "k", 1, 3, now)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	tokens, ok, err := store.TakeToken(context.Background(), "k", 1, 3, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, float64(0), tokens)
+
+	// 一秒后补充一个令牌
+	_, ok, err = store.TakeToken(context.Background(), "k", 1, 3, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemoryStore_AddToWindow(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		_, _, ok, err := store.AddToWindow(context.Background(), "k", 2, time.Minute, now.Add(time.Duration(i)*time.Second))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	cnt, oldest, ok, err := store.AddToWindow(context.Background(), "k", 2, time.Minute, now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, cnt)
+	assert.Equal(t, now, oldest)
+
+	// 第一条记录滑出窗口
+	_, _, ok, err = store.AddToWindow(context.Background(), "k", 2, time.Minute, now.Add(time.Minute+time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/middleware"
+	"blog/validate"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 访问令牌的权限范围
+const (
+	ScopeRead          = "read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsWrite = "comments:write"
+)
+
+const (
+	// AccessTokenPrefix 访问令牌的前缀，中间件据此区分访问令牌和 JWT，泄露时也方便扫描出来
+	AccessTokenPrefix = "blog_pat_"
+	// 每个用户最多同时有效的令牌数
+	accessTokenLimit = 20
+)
+
+var errAccessTokenInvalid = errors.New("访问令牌已过期或已吊销")
+
+// AccessTokenHandler 个人访问令牌，给脚本和 CI 调用接口用，不需要模拟登录。
+// 只能用登录 token 管理，访问令牌不能创建或吊销令牌
+type AccessTokenHandler struct {
+	dao dao.AccessTokenDAO
+}
+
+func NewAccessTokenHandler(dao dao.AccessTokenDAO) *AccessTokenHandler {
+	return &AccessTokenHandler{dao: dao}
+}
+
+type AccessTokenVO struct {
+	Id         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  int64    `json:"expiresAt"`
+	LastUsedAt int64    `json:"lastUsedAt"`
+	Expired    bool     `json:"expired"`
+	Ctime      int64    `json:"ctime"`
+}
+
+type AccessTokenCreatedVO struct {
+	AccessTokenVO
+	// Token 明文只在创建时返回一次
+	Token string `json:"token"`
+}
+
+func (h *AccessTokenHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	tg := server.Group("/user/tokens", append(mws, requireLogin)...)
+	tg.POST("/create", h.Create)
+	tg.POST("/list", h.List)
+	tg.DELETE("/:id", h.Revoke)
+}
+
+func toAccessTokenVO(t dao.AccessToken, now int64) AccessTokenVO {
+	return AccessTokenVO{
+		Id:         t.ID,
+		Name:       t.Name,
+		Scopes:     strings.Split(t.Scopes, ","),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		Expired:    t.ExpiresAt <= now,
+		Ctime:      t.Ctime,
+	}
+}
+
+// Create 创建访问令牌，明文只在响应中出现一次
+func (h *AccessTokenHandler) Create(ctx *gin.Context) {
+	type CreateReq struct {
+		Name          string   `json:"name" binding:"required,notblank,max=64"`
+		Scopes        []string `json:"scopes" binding:"required,min=1,max=3,dive,oneof=read posts:write comments:write"`
+		ExpiresInDays int      `json:"expiresInDays" binding:"required,min=1,max=365"`
+	}
+	var req CreateReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("创建访问令牌参数绑定错误", zap.Error(err))
+		return
+	}
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	n, err := h.dao.CountActive(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("统计访问令牌失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if n >= accessTokenLimit {
+		fail(ctx, errs.TokenLimit.WithArgs(accessTokenLimit))
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成访问令牌失败", zap.Error(err))
+		return
+	}
+	plain := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	t := dao.AccessToken{
+		UserID:    userId,
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: hashAccessToken(plain),
+		Scopes:    strings.Join(uniqueScopes(req.Scopes), ","),
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays).UnixMilli(),
+	}
+	if t.ID, err = h.dao.Create(ctx, t); err != nil {
+		fail(ctx, err)
+		zap.L().Error("保存访问令牌失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	t.Ctime = time.Now().UnixMilli()
+	zap.L().Info("创建访问令牌", zap.Int64("user_id", userId), zap.Int64("token_id", t.ID), zap.String("scopes", t.Scopes))
+	success(ctx, msgTokenCreated, AccessTokenCreatedVO{
+		AccessTokenVO: toAccessTokenVO(t, t.Ctime),
+		Token:         plain,
+	})
+}
+
+// List 当前用户未吊销的访问令牌，不包含明文
+func (h *AccessTokenHandler) List(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	tokens, err := h.dao.ListByUser(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询访问令牌失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	now := time.Now().UnixMilli()
+	vos := make([]AccessTokenVO, 0, len(tokens))
+	for _, t := range tokens {
+		vos = append(vos, toAccessTokenVO(t, now))
+	}
+	success(ctx, msgTokenList, vos)
+}
+
+// Revoke 吊销访问令牌，立即失效
+func (h *AccessTokenHandler) Revoke(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		fail(ctx, errs.ErrInvalidArgument.With(err))
+		return
+	}
+	if err = h.dao.Revoke(ctx, userId, id); err != nil {
+		fail(ctx, notFound(err, errs.TokenNotFound))
+		zap.L().Info("吊销访问令牌失败", zap.Error(err), zap.Int64("user_id", userId), zap.Int64("token_id", id))
+		return
+	}
+	zap.L().Info("吊销访问令牌", zap.Int64("user_id", userId), zap.Int64("token_id", id))
+	success(ctx, msgTokenRevoked, nil)
+}
+
+// AccessTokenAuthenticator 供 LoginJWTMiddleware.AccessToken 使用，校验访问令牌并记录最后使用时间
+func AccessTokenAuthenticator(tokenDAO dao.AccessTokenDAO, userDAO dao.UserDAO) func(ctx *gin.Context, token string) (middleware.Principal, error) {
+	return func(ctx *gin.Context, token string) (middleware.Principal, error) {
+		t, err := tokenDAO.FindByHash(ctx, hashAccessToken(token))
+		if err != nil {
+			return middleware.Principal{}, err
+		}
+		if t.RevokedAt != 0 || t.ExpiresAt <= time.Now().UnixMilli() {
+			return middleware.Principal{}, errAccessTokenInvalid
+		}
+		usr, err := userDAO.FindById(ctx, t.UserID)
+		if err != nil {
+			return middleware.Principal{}, err
+		}
+		if err = tokenDAO.Touch(ctx, t.ID); err != nil {
+			zap.L().Error("记录访问令牌使用时间失败", zap.Error(err), zap.Int64("token_id", t.ID))
+		}
+		return middleware.Principal{
+			UserID:   t.UserID,
+			Username: usr.Username,
+			Lang:     usr.Locale,
+			Scopes:   strings.Split(t.Scopes, ","),
+		}, nil
+	}
+}
+
+// hashAccessToken 令牌有 256 位随机数，不需要加盐或慢哈希
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func uniqueScopes(scopes []string) []string {
+	res := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !slices.Contains(res, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
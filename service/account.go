@@ -0,0 +1,287 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/export"
+	"blog/media"
+	"blog/validate"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 每轮最多删除的账号数，剩下的留给下一轮
+const accountPurgeBatch = 100
+
+var (
+	commentStatusNames = map[uint8]string{
+		dao.CommentStatusApproved: "approved",
+		dao.CommentStatusPending:  "pending",
+		dao.CommentStatusRejected: "rejected",
+	}
+)
+
+// AccountHandler 导出个人数据和注销账号
+type AccountHandler struct {
+	userDAO     dao.UserDAO
+	postDAO     dao.PostDAO
+	commentDAO  dao.CommentDAO
+	reactionDAO dao.ReactionDAO
+	mediaDAO    dao.MediaDAO
+	// 删除账号后清理不再被引用的媒体文件
+	processor *media.Processor
+	// 申请注销后多久真正删除，期间可以撤销
+	grace time.Duration
+}
+
+type DeletionVO struct {
+	// 到期删除的时间，毫秒时间戳
+	ScheduledAt int64 `json:"scheduledAt"`
+}
+
+func NewAccountHandler(userDAO dao.UserDAO, postDAO dao.PostDAO, commentDAO dao.CommentDAO, reactionDAO dao.ReactionDAO,
+	mediaDAO dao.MediaDAO, processor *media.Processor, grace time.Duration) *AccountHandler {
+	return &AccountHandler{
+		userDAO:     userDAO,
+		postDAO:     postDAO,
+		commentDAO:  commentDAO,
+		reactionDAO: reactionDAO,
+		mediaDAO:    mediaDAO,
+		processor:   processor,
+		grace:       grace,
+	}
+}
+
+func (h *AccountHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	ug := server.Group("/user", append(mws, requireLogin)...)
+	ug.GET("/export", h.Export)
+	ug.POST("/delete", h.Delete)
+	ug.POST("/delete/cancel", h.CancelDelete)
+}
+
+// Export 以 ZIP 下载当前用户的全部数据
+func (h *AccountHandler) Export(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	archive, err := h.archive(ctx, userId)
+	if err != nil {
+		fail(ctx, notFound(err, errs.UserNotFound))
+		zap.L().Error("导出个人数据失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", archive.Profile.Username, archive.Generated.Format("20060102"))
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Header("Cache-Control", "no-store")
+	if err = export.Write(ctx.Writer, archive); err != nil {
+		// 已经开始写响应，只能记日志
+		zap.L().Error("写入导出文件失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+}
+
+func (h *AccountHandler) archive(ctx context.Context, userId int64) (export.Archive, error) {
+	usr, err := h.userDAO.FindById(ctx, userId)
+	if err != nil {
+		return export.Archive{}, err
+	}
+	posts, err := h.postDAO.FindByAuthor(ctx, userId)
+	if err != nil {
+		return export.Archive{}, err
+	}
+	comments, err := h.commentDAO.FindByUser(ctx, userId)
+	if err != nil {
+		return export.Archive{}, err
+	}
+	reactions, err := h.reactionDAO.ListByUser(ctx, userId)
+	if err != nil {
+		return export.Archive{}, err
+	}
+	// limit 为 -1 表示不分页
+	media, err := h.mediaDAO.ListByUser(ctx, userId, 0, -1)
+	if err != nil {
+		return export.Archive{}, err
+	}
+
+	a := export.Archive{
+		Profile: export.Profile{
+			Id:            userId,
+			Username:      usr.Username,
+			Email:         usr.Email,
+			EmailVerified: usr.EmailVerified,
+			DisplayName:   usr.DisplayName,
+			Bio:           usr.Bio,
+			Website:       usr.Website,
+			Avatar:        usr.Avatar,
+			Locale:        usr.Locale,
+			Joined:        usr.CreatedAt,
+		},
+		Posts:     make([]export.Post, 0, len(posts)),
+		Comments:  make([]export.Comment, 0, len(comments)),
+		Reactions: make([]export.Reaction, 0, len(reactions)),
+		Media:     make([]export.Media, 0, len(media)),
+		Generated: time.Now(),
+	}
+	for _, p := range posts {
+		a.Posts = append(a.Posts, export.Post{
+			Id:      p.ID,
+			Title:   p.Title,
+			Content: p.Content,
+			Ctime:   time.UnixMilli(p.Ctime),
+			Utime:   time.UnixMilli(p.Utime),
+		})
+	}
+	for _, c := range comments {
+		a.Comments = append(a.Comments, export.Comment{
+			Id:      c.ID,
+			PostId:  c.PostID,
+			Content: c.Content,
+			Status:  commentStatusNames[c.Status],
+			Ctime:   time.UnixMilli(c.Ctime),
+		})
+	}
+	for _, r := range reactions {
+		a.Reactions = append(a.Reactions, export.Reaction{
+			CommentId: r.CommentID,
+			Reaction:  r.Reaction,
+			Ctime:     time.UnixMilli(r.Ctime),
+		})
+	}
+	for _, m := range media {
+		a.Media = append(a.Media, export.Media{
+			URL:      mediaFilePrefix + m.Name,
+			Filename: m.Filename,
+			Mime:     m.Mime,
+			Size:     m.Size,
+			Ctime:    time.UnixMilli(m.Ctime),
+		})
+	}
+	return a, nil
+}
+
+// Delete 申请注销账号，宽限期过后才会真正删除
+func (h *AccountHandler) Delete(ctx *gin.Context) {
+	type DeleteReq struct {
+		Password string `json:"password" binding:"required"`
+	}
+	var req DeleteReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("注销账号参数绑定错误", zap.Error(err))
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	usr, err := h.userDAO.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, notFound(err, errs.UserNotFound))
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if err = checkPassword(usr, req.Password, errs.PasswordIncorrect); err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	// 重复申请不会推迟删除时间
+	at := usr.DeletionScheduledAt
+	if at == 0 {
+		at = time.Now().Add(h.grace).UnixMilli()
+		if err = h.userDAO.ScheduleDeletion(ctx, userId, at); err != nil {
+			fail(ctx, err)
+			zap.L().Error("申请注销失败", zap.Error(err), zap.Int64("user_id", userId))
+			return
+		}
+		zap.L().Info("用户申请注销", zap.Int64("user_id", userId), zap.Int64("scheduled_at", at))
+	}
+	success(ctx, msgDeletionScheduled, DeletionVO{ScheduledAt: at})
+}
+
+// CancelDelete 宽限期内撤销注销
+func (h *AccountHandler) CancelDelete(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	if err = h.userDAO.ScheduleDeletion(ctx, userId, 0); err != nil {
+		fail(ctx, err)
+		zap.L().Error("撤销注销失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	zap.L().Info("用户撤销注销", zap.Int64("user_id", userId))
+	success(ctx, msgDeletionCancelled, nil)
+}
+
+// Purge 删除宽限期已过的账号，返回删除的数量
+func (h *AccountHandler) Purge(ctx context.Context) (int, error) {
+	users, err := h.userDAO.ListDeletionDue(ctx, time.Now().UnixMilli(), accountPurgeBatch)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, usr := range users {
+		userId := int64(usr.ID)
+		files, err := h.mediaDAO.ListByUser(ctx, userId, 0, -1)
+		if err != nil {
+			return n, err
+		}
+		if err = h.userDAO.Erase(ctx, userId); err != nil {
+			return n, err
+		}
+		n++
+		zap.L().Info("账号已删除", zap.Int64("user_id", userId))
+		h.deleteFiles(ctx, files)
+	}
+	return n, nil
+}
+
+// deleteFiles 删除账号的媒体记录后，删掉不再被其他用户引用的原图和缩略图。
+// 文件按内容寻址，其他用户上传过相同内容时共用同一个文件，要保留
+func (h *AccountHandler) deleteFiles(ctx context.Context, files []dao.Media) {
+	for _, f := range files {
+		cnt, err := h.mediaDAO.CountByName(ctx, f.Name)
+		if err != nil {
+			zap.L().Error("查询媒体文件引用失败", zap.Error(err), zap.String("name", f.Name))
+			continue
+		}
+		if cnt > 0 {
+			continue
+		}
+		names := []string{f.Name}
+		for _, t := range f.Thumbnails {
+			names = append(names, t.Name)
+		}
+		for _, name := range names {
+			if err = h.processor.Delete(ctx, name); err != nil {
+				zap.L().Error("删除媒体文件失败", zap.Error(err), zap.String("name", name))
+			}
+		}
+	}
+}
+
+// RunPurger 定期删除到期的账号，直到 ctx 结束
+func (h *AccountHandler) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := h.Purge(ctx); err != nil {
+			zap.L().Error("删除到期账号失败", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
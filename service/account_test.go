@@ -0,0 +1,120 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/media"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func TestAccountDelete(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	testCases := []struct {
+		name          string
+		password      string
+		body          string
+		wantCode      int
+		wantScheduled bool
+	}{
+		{name: "密码正确", password: string(hash), body: `{"password":"secret123"}`, wantCode: http.StatusOK, wantScheduled: true},
+		{name: "密码错误", password: string(hash), body: `{"password":"wrong"}`, wantCode: http.StatusBadRequest},
+		// 第三方登录注册的账号要先设置密码
+		{name: "没有设置密码", body: `{"password":"anything"}`, wantCode: http.StatusConflict},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", Password: tc.password})
+			h := NewAccountHandler(users, nil, nil, nil, nil, nil, time.Hour)
+			server := newTestServer(fakeLogin(1))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/user/delete", tc.body)
+			assert.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			assert.Equal(t, tc.wantScheduled, users.users[1].DeletionScheduledAt > 0)
+		})
+	}
+}
+
+// purgeUserDAO 删除用户时一并删除媒体记录，和 GROMUserDAO.Erase 一致
+type purgeUserDAO struct {
+	*fakeUserDAO
+	media *fakeMediaDAO
+	mu    sync.Mutex
+	due   []int64
+}
+
+func (f *purgeUserDAO) ListDeletionDue(ctx context.Context, now int64, limit int) ([]dao.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.User
+	for _, id := range f.due {
+		res = append(res, dao.User{Model: gorm.Model{ID: uint(id)}})
+	}
+	f.due = nil
+	return res, nil
+}
+
+func (f *purgeUserDAO) Erase(ctx context.Context, id int64) error {
+	f.media.mu.Lock()
+	defer f.media.mu.Unlock()
+	f.media.media = slices.DeleteFunc(f.media.media, func(m dao.Media) bool {
+		return m.UserID == id
+	})
+	return nil
+}
+
+func TestAccountPurgeMedia(t *testing.T) {
+	storage, err := media.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	processor := media.NewProcessor(storage, media.Config{MaxBytes: 1 << 20, MaxPixels: 1 << 20, ThumbnailWidths: []int{16}})
+	upload := func(userId int64, width int) dao.Media {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, 20))))
+		file, err := processor.Process(context.Background(), &buf)
+		require.NoError(t, err)
+		m := dao.Media{UserID: userId, Name: file.Name}
+		for _, thumb := range file.Thumbnails {
+			m.Thumbnails = append(m.Thumbnails, dao.MediaThumbnail{Name: thumb.Name})
+		}
+		return m
+	}
+	own := upload(1, 40)
+	shared := upload(1, 50)
+	mediaDAO := &fakeMediaDAO{media: []dao.Media{own, shared, {UserID: 2, Name: shared.Name, Thumbnails: shared.Thumbnails}}}
+	users := &purgeUserDAO{fakeUserDAO: newFakeUserDAO(), media: mediaDAO, due: []int64{1}}
+	h := NewAccountHandler(users, nil, nil, nil, mediaDAO, processor, time.Hour)
+
+	n, err := h.Purge(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	exists := func(name string) bool {
+		rc, _, err := processor.Open(context.Background(), name)
+		if err != nil {
+			assert.ErrorIs(t, err, media.ErrNotFound)
+			return false
+		}
+		rc.Close()
+		return true
+	}
+	// 只有该用户引用的文件连同缩略图一起删除
+	require.Len(t, own.Thumbnails, 1)
+	assert.False(t, exists(own.Name))
+	assert.False(t, exists(own.Thumbnails[0].Name))
+	// 其他用户也上传过的文件保留
+	assert.True(t, exists(shared.Name))
+	assert.True(t, exists(shared.Thumbnails[0].Name))
+}
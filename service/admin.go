@@ -0,0 +1,70 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/guard"
+	"blog/validate"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminHandler 管理员接口
+type AdminHandler struct {
+	userDAO dao.UserDAO
+	guard   *guard.LoginGuard
+}
+
+func NewAdminHandler(userDAO dao.UserDAO, guard *guard.LoginGuard) *AdminHandler {
+	return &AdminHandler{userDAO: userDAO, guard: guard}
+}
+
+func (a *AdminHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	ag := server.Group("/admin", append(mws, requireLogin, a.requireAdmin)...)
+	ag.POST("/users/unlock", a.Unlock)
+}
+
+// requireAdmin 只有管理员可以访问
+func (a *AdminHandler) requireAdmin(ctx *gin.Context) {
+	userId := viewerId(ctx)
+	if userId == 0 {
+		fail(ctx, errs.ErrUnauthenticated)
+		return
+	}
+	usr, err := a.userDAO.FindById(ctx, userId)
+	if err != nil || usr.Role != dao.RoleAdmin {
+		fail(ctx, errs.AdminRequired)
+		zap.L().Warn("非管理员访问管理接口", zap.Int64("user_id", userId), zap.String("path", ctx.FullPath()))
+		return
+	}
+}
+
+// Unlock 解除账号或 IP 的登录锁定
+func (a *AdminHandler) Unlock(ctx *gin.Context) {
+	type UnlockReq struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	var req UnlockReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || (req.Username == "" && req.IP == "") {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("解锁参数绑定错误", zap.Error(err))
+		return
+	}
+	if req.Username != "" {
+		if err := a.guard.Unlock(ctx, req.Username); err != nil {
+			fail(ctx, err)
+			zap.L().Error("解锁账号失败", zap.Error(err), zap.String("username", req.Username))
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := a.guard.UnlockIP(ctx, req.IP); err != nil {
+			fail(ctx, err)
+			zap.L().Error("解锁IP失败", zap.Error(err), zap.String("ip", req.IP))
+			return
+		}
+	}
+	zap.L().Info("管理员解除登录锁定", zap.Int64("admin_id", viewerId(ctx)), zap.String("username", req.Username), zap.String("ip", req.IP))
+	success(ctx, msgUnlocked, nil)
+}
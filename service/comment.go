@@ -2,93 +2,162 @@ package service
 
 import (
 	"blog/dao"
-	"blog/domain"
+	"blog/errs"
+	"blog/filter"
+	"blog/mention"
+	"blog/pubsub"
+	"blog/validate"
+	"context"
+	"errors"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"net/http"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// 心跳间隔，防止代理因连接空闲而断开
+	commentStreamHeartbeat = 15 * time.Second
+	// 断线重连时最多补发的评论数
+	commentStreamResumeLimit = 100
+	// 建议客户端重连的等待时间（毫秒）
+	commentStreamRetry = 3000
 )
 
 type CommentHandler struct {
-	dao     dao.CommentDAO
-	userDAO dao.UserDAO
-	postDAO dao.PostDAO
+	dao      dao.CommentDAO
+	userDAO  dao.UserDAO
+	postDAO  dao.PostDAO
+	hub      *pubsub.Hub
+	mentions mentionRecorder
+
+	reactionDAO  dao.ReactionDAO
+	reactionKeys []string
+	moderation   uint8
+	filter       filter.Filter
+}
+
+type CommentConfig struct {
+	// 可用的表情回应，为空时使用 DefaultReactionKeys
+	ReactionKeys []string
+	// 全局评论审核模式，文章上可单独覆盖
+	Moderation uint8
+}
+
+type CommentVO struct {
+	dao.Comment
+	// 提及已替换为链接的内容
+	Rendered  string       `json:"rendered"`
+	Reactions []ReactionVO `json:"reactions"`
 }
 
-func NewCommentHandler(dao dao.CommentDAO, userDAO dao.UserDAO, postDAO dao.PostDAO) *CommentHandler {
-	return &CommentHandler{dao: dao, userDAO: userDAO, postDAO: postDAO}
+func NewCommentHandler(dao dao.CommentDAO, userDAO dao.UserDAO, postDAO dao.PostDAO, mentionDAO dao.MentionDAO,
+	reactionDAO dao.ReactionDAO, hub *pubsub.Hub, contentFilter filter.Filter, cfg CommentConfig) *CommentHandler {
+	reactionKeys := cfg.ReactionKeys
+	if len(reactionKeys) == 0 {
+		reactionKeys = DefaultReactionKeys
+	}
+	return &CommentHandler{
+		dao:          dao,
+		userDAO:      userDAO,
+		postDAO:      postDAO,
+		hub:          hub,
+		mentions:     mentionRecorder{userDAO: userDAO, mentionDAO: mentionDAO},
+		reactionDAO:  reactionDAO,
+		reactionKeys: reactionKeys,
+		moderation:   cfg.Moderation,
+		filter:       contentFilter,
+	}
 }
 
-func (c *CommentHandler) RegisterRoutes(server *gin.Engine) {
-	cg := server.Group("/comments")
-	cg.POST("/edit", c.Create)
+func (c *CommentHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	cg := server.Group("/comments", mws...)
+	cg.POST("/edit", requireScope(ScopeCommentsWrite), requireVerifiedEmail(c.userDAO), c.Create)
 	cg.POST("/list", c.List)
+	cg.GET("/stream/:postId", c.Stream)
+	cg.POST("/react", requireScope(ScopeCommentsWrite), c.React)
+	cg.POST("/reactions/users", c.ReactionUsers)
+	cg.POST("/moderation/pending", requireLogin, c.Pending)
+	cg.POST("/moderation/review", requireLogin, c.Review)
 }
 
 func (c *CommentHandler) Create(ctx *gin.Context) {
 	type CommentReq struct {
 		ID      int64  `json:"id"`
-		PostID  int64  `json:"postId"`
-		Content string `json:"content"`
+		PostID  int64  `json:"postId" binding:"required,gt=0"`
+		Content string `json:"content" binding:"notblank,max=5000"`
 	}
 	var req CommentReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数绑定错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("创建评论参数绑定错误", zap.Error(err))
 		return
 	}
 
 	// 获取用户ID
-	userIdInterface, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 401,
-			Msg:  "用户未登录",
-		})
-		return
-	}
-	userIdFloat, ok := userIdInterface.(float64)
-	if !ok {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户ID类型错误",
-		})
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
 		return
 	}
-	userId := int64(userIdFloat)
 
 	//检查文章是否存在
-	_, err := c.postDAO.FindById(ctx, req.PostID)
+	post, err := c.postDAO.FindById(ctx, req.PostID)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "评论文章不存在",
-		})
+		fail(ctx, notFound(err, errs.PostNotFound))
 		zap.L().Error("评论文章不存在", zap.Error(err))
 		return
 	}
 
-	id, err := c.dao.Create(ctx, dao.Comment{
+	status, err := c.initialStatus(ctx, post, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("判断评论审核状态失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+
+	decision, err := c.filter.Check(ctx, filter.Content{
+		Kind:   filter.KindComment,
+		UserID: userId,
+		PostID: req.PostID,
+		Body:   req.Content,
+	})
+	if err != nil {
+		zap.L().Error("评论内容过滤失败", zap.Error(err))
+	}
+	if decision.Verdict == filter.Reject {
+		fail(ctx, errs.CommentRejected.WithArgs(decision.Message()))
+		zap.L().Info("评论被内容过滤拒绝", zap.String("filter", decision.Filter), zap.Stringer("reason", decision.Message()), zap.Int64("user_id", userId))
+		return
+	}
+	if decision.Verdict == filter.Hold {
+		status = dao.CommentStatusPending
+	}
+
+	comment := dao.Comment{
 		ID:      req.ID,
 		UserID:  userId,
 		PostID:  req.PostID,
 		Content: req.Content,
-	})
+		Status:  status,
+	}
+	id, err := c.dao.Create(ctx, comment)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "创建评论失败",
-		})
+		fail(ctx, err)
 		zap.L().Error("创建评论失败", zap.Error(err))
 		return
 	}
-	ctx.JSON(200, domain.Result{
-		Code: 200,
-		Msg:  "创建评论成功",
-		Data: id,
-	})
+	comment.ID = id
+	if status == dao.CommentStatusPending {
+		// 待审核的评论不产生提及，覆盖同一条评论之前的提及
+		c.mentions.record(ctx, dao.MentionSourceComment, id, req.PostID, userId, "")
+		success(ctx, msgCommentHeld, id)
+		return
+	}
+	c.publish(ctx, comment)
+	success(ctx, msgCommentCreated, id)
 }
 
 func (c *CommentHandler) List(ctx *gin.Context) {
@@ -99,25 +168,124 @@ func (c *CommentHandler) List(ctx *gin.Context) {
 	}
 	var req ListReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数绑定错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("获取评论列表参数绑定错误", zap.Error(err))
 		return
 	}
 	comments, err := c.dao.LIST(ctx, req.PostID, req.Offest, req.Limit)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "获取评论列表失败",
-		})
+		fail(ctx, err)
 		zap.L().Error("获取评论列表失败", zap.Error(err))
 		return
 	}
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "获取评论列表成功",
-		Data: comments,
+	success(ctx, msgCommentList, c.toVOs(ctx, comments, readerId(ctx)))
+}
+
+// Stream 通过 SSE 实时推送文章的新评论，支持 Last-Event-ID 断线续传
+func (c *CommentHandler) Stream(ctx *gin.Context) {
+	idstr := ctx.Param("postId")
+	postId, err := strconv.ParseInt(idstr, 10, 64)
+	if err != nil {
+		fail(ctx, errs.ErrInvalidArgument.With(err))
+		zap.L().Error("参数错误", zap.Error(err), zap.String("param", idstr))
+		return
+	}
+	_, err = c.postDAO.FindById(ctx, postId)
+	if err != nil {
+		fail(ctx, notFound(err, errs.PostNotFound))
+		zap.L().Error("评论文章不存在", zap.Error(err), zap.Int64("post_id", postId))
+		return
+	}
+
+	// 先订阅再补发，避免补发期间产生的评论丢失
+	sub, err := c.hub.Subscribe(postId)
+	if errors.Is(err, pubsub.ErrTooManySubscribers) {
+		fail(ctx, errs.CommentStreamFull)
+		zap.L().Warn("评论订阅人数已满", zap.Int64("post_id", postId))
+		return
+	}
+	defer sub.Close()
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Render(-1, sse.Event{Event: "ready", Retry: commentStreamRetry, Data: postId})
+
+	var resumed int64
+	lastId := ctx.GetHeader("Last-Event-ID")
+	if lastId == "" {
+		lastId = ctx.Query("lastEventId")
+	}
+	if lastId != "" {
+		afterId, err := strconv.ParseInt(lastId, 10, 64)
+		if err == nil {
+			missed, err := c.dao.ListAfter(ctx, postId, afterId, commentStreamResumeLimit)
+			if err != nil {
+				zap.L().Error("补发评论失败", zap.Error(err), zap.Int64("post_id", postId))
+			}
+			for _, vo := range c.toVOs(ctx, missed, 0) {
+				ctx.Render(-1, commentEvent(vo.ID, vo))
+				resumed = vo.ID
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(commentStreamHeartbeat)
+	defer heartbeat.Stop()
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case evt := <-sub.Events():
+			// 已经在补发中推送过
+			if evt.ID <= resumed {
+				return true
+			}
+			ctx.Render(-1, commentEvent(evt.ID, evt.Data))
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-sub.Done():
+			// 消费太慢被踢下线，客户端会带上 Last-Event-ID 重连
+			return false
+		case <-ctx.Request.Context().Done():
+			return false
+		}
 	})
 }
+
+// publish 评论通过后才记录提及，再推送给订阅者
+func (c *CommentHandler) publish(ctx context.Context, comment dao.Comment) {
+	c.mentions.record(ctx, dao.MentionSourceComment, comment.ID, comment.PostID, comment.UserID, comment.Content)
+	c.hub.Publish(pubsub.Event{
+		ID:    comment.ID,
+		Topic: comment.PostID,
+		Name:  "comment",
+		Data:  c.toVOs(ctx, []dao.Comment{comment}, 0)[0],
+	})
+}
+
+func (c *CommentHandler) toVOs(ctx context.Context, comments []dao.Comment, viewer int64) []CommentVO {
+	ids := make([]int64, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	known := c.mentions.known(ctx, dao.MentionSourceComment, ids)
+	reactions := c.reactionSummaries(ctx, ids, viewer)
+	voList := make([]CommentVO, 0, len(comments))
+	for _, comment := range comments {
+		voList = append(voList, CommentVO{
+			Comment:   comment,
+			Rendered:  mention.Render(comment.Content, known[comment.ID]),
+			Reactions: reactions[comment.ID],
+		})
+	}
+	return voList
+}
+
+func commentEvent(id int64, data any) sse.Event {
+	return sse.Event{
+		Id:    strconv.FormatInt(id, 10),
+		Event: "comment",
+		Data:  data,
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/domain"
+	"blog/filter"
+	"blog/pubsub"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestCommentHandler(comments *fakeCommentDAO, mentions *fakeMentionDAO, cfg CommentConfig, posts ...dao.Post) *CommentHandler {
+	users := newFakeUserDAO(
+		dao.User{Model: gorm.Model{ID: 1}, Username: "alice", EmailVerified: true},
+		dao.User{Model: gorm.Model{ID: 2}, Username: "bob", EmailVerified: true},
+		dao.User{Model: gorm.Model{ID: 3}, Username: "mod", EmailVerified: true, Role: dao.RoleModerator},
+	)
+	return NewCommentHandler(comments, users, newFakePostDAO(posts...), mentions, &fakeReactionDAO{},
+		pubsub.NewHub(10, 10), filter.NewChain(), cfg)
+}
+
+func TestCommentMentionsFollowReview(t *testing.T) {
+	comments, mentions := newFakeCommentDAO(), &fakeMentionDAO{}
+	h := newTestCommentHandler(comments, mentions, CommentConfig{},
+		dao.Post{ID: 1, Author: 1, ModerationMode: dao.ModerationHoldAll})
+	mentioned := func() []string {
+		var names []string
+		for _, m := range mentions.mentions {
+			names = append(names, m.Username)
+		}
+		return names
+	}
+
+	bob := newTestServer(fakeLogin(2))
+	h.RegisterRoutes(bob)
+	recorder := doRequest(bob, http.MethodPost, "/comments/edit", `{"postId":1,"content":"你好 @alice"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, dao.CommentStatusPending, comments.comments[1].Status)
+	// 待审核的评论不会通知被提及的用户
+	assert.Empty(t, mentioned())
+
+	alice := newTestServer(fakeLogin(1))
+	h.RegisterRoutes(alice)
+	recorder = doRequest(alice, http.MethodPost, "/comments/moderation/review", `{"ids":[1],"action":"approve"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, []string{"alice"}, mentioned())
+
+	recorder = doRequest(alice, http.MethodPost, "/comments/moderation/review", `{"ids":[1],"action":"reject"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, mentioned())
+}
+
+func TestCommentInitialStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		global   uint8
+		postMode uint8
+		userId   int64
+		// existing 用户之前的评论
+		existing []dao.Comment
+		want     uint8
+	}{
+		{name: "未配置时不审核", userId: 2, want: dao.CommentStatusApproved},
+		{name: "全局不审核", global: dao.ModerationOpen, userId: 2, want: dao.CommentStatusApproved},
+		{name: "首次评论需审核", global: dao.ModerationHoldFirstTime, userId: 2, want: dao.CommentStatusPending},
+		{
+			name:     "有通过的评论后不再审核",
+			global:   dao.ModerationHoldFirstTime,
+			userId:   2,
+			existing: []dao.Comment{{ID: 100, UserID: 2, PostID: 1, Status: dao.CommentStatusApproved}},
+			want:     dao.CommentStatusApproved,
+		},
+		{
+			name:     "被拒绝的评论不算",
+			global:   dao.ModerationHoldFirstTime,
+			userId:   2,
+			existing: []dao.Comment{{ID: 100, UserID: 2, PostID: 1, Status: dao.CommentStatusRejected}},
+			want:     dao.CommentStatusPending,
+		},
+		{
+			name:     "全部需审核",
+			global:   dao.ModerationHoldAll,
+			userId:   2,
+			existing: []dao.Comment{{ID: 100, UserID: 2, PostID: 1, Status: dao.CommentStatusApproved}},
+			want:     dao.CommentStatusPending,
+		},
+		{name: "文章作者直接通过", global: dao.ModerationHoldAll, userId: 1, want: dao.CommentStatusApproved},
+		{name: "审核员直接通过", global: dao.ModerationHoldAll, userId: 3, want: dao.CommentStatusApproved},
+		{name: "文章上的设置覆盖全局", global: dao.ModerationHoldAll, postMode: dao.ModerationOpen, userId: 2, want: dao.CommentStatusApproved},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comments := newFakeCommentDAO(tc.existing...)
+			h := newTestCommentHandler(comments, &fakeMentionDAO{}, CommentConfig{Moderation: tc.global},
+				dao.Post{ID: 1, Author: 1, ModerationMode: tc.postMode})
+			server := newTestServer(fakeLogin(tc.userId))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/comments/edit", `{"postId":1,"content":"评论"}`)
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			assert.Equal(t, tc.want, comments.comments[comments.seq].Status)
+		})
+	}
+}
+
+func TestCommentReview(t *testing.T) {
+	testCases := []struct {
+		name     string
+		userId   int64
+		body     string
+		wantCode int
+		// wantStatus 审核后评论的状态，评论ID -> 状态
+		wantStatus map[int64]uint8
+	}{
+		{
+			name:       "文章作者通过",
+			userId:     1,
+			body:       `{"ids":[1,2],"action":"approve"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusApproved, 2: dao.CommentStatusApproved, 3: dao.CommentStatusPending},
+		},
+		{
+			name:       "文章作者拒绝",
+			userId:     1,
+			body:       `{"ids":[1],"action":"reject"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusRejected, 2: dao.CommentStatusPending},
+		},
+		{
+			name:       "重复的ID",
+			userId:     1,
+			body:       `{"ids":[1,1,2],"action":"approve"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusApproved, 2: dao.CommentStatusApproved},
+		},
+		{
+			name:       "不能审核别人文章下的评论",
+			userId:     1,
+			body:       `{"ids":[1,3],"action":"approve"}`,
+			wantCode:   http.StatusForbidden,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusPending, 3: dao.CommentStatusPending},
+		},
+		{
+			name:       "审核员可以审核全部",
+			userId:     3,
+			body:       `{"ids":[1,3],"action":"approve"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusApproved, 3: dao.CommentStatusApproved},
+		},
+		{
+			name:       "评论不存在",
+			userId:     1,
+			body:       `{"ids":[1,404],"action":"approve"}`,
+			wantCode:   http.StatusNotFound,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusPending},
+		},
+		{
+			name:       "未知操作",
+			userId:     1,
+			body:       `{"ids":[1],"action":"delete"}`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: map[int64]uint8{1: dao.CommentStatusPending},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comments := newFakeCommentDAO(
+				dao.Comment{ID: 1, UserID: 2, PostID: 1, Content: "一", Status: dao.CommentStatusPending},
+				dao.Comment{ID: 2, UserID: 2, PostID: 1, Content: "二", Status: dao.CommentStatusPending},
+				dao.Comment{ID: 3, UserID: 2, PostID: 2, Content: "三", Status: dao.CommentStatusPending},
+			)
+			h := newTestCommentHandler(comments, &fakeMentionDAO{}, CommentConfig{},
+				dao.Post{ID: 1, Author: 1}, dao.Post{ID: 2, Author: 2})
+			server := newTestServer(fakeLogin(tc.userId))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/comments/moderation/review", tc.body)
+			assert.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			for id, status := range tc.wantStatus {
+				assert.Equal(t, status, comments.comments[id].Status, "评论 %d", id)
+			}
+		})
+	}
+}
+
+func TestCommentListReader(t *testing.T) {
+	testCases := []struct {
+		name        string
+		login       gin.HandlerFunc
+		wantReacted bool
+	}{
+		{name: "匿名", login: fakeLogin(0)},
+		{name: "登录 token", login: fakeLogin(2), wantReacted: true},
+		{name: "有 read 权限的访问令牌", login: fakeLogin(2, ScopeRead), wantReacted: true},
+		// 没有 read 权限的访问令牌只能按匿名读取
+		{name: "没有 read 权限的访问令牌", login: fakeLogin(2, ScopeCommentsWrite)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comments := newFakeCommentDAO(dao.Comment{ID: 1, UserID: 1, PostID: 1, Content: "评论", Status: dao.CommentStatusApproved})
+			h := newTestCommentHandler(comments, &fakeMentionDAO{}, CommentConfig{}, dao.Post{ID: 1, Author: 1})
+			h.reactionDAO = &fakeReactionDAO{reactions: []dao.Reaction{{CommentID: 1, UserID: 2, Reaction: "heart"}}}
+			server := newTestServer(tc.login)
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/comments/list", `{"postId":1}`)
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			var res struct {
+				Data []CommentVO `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			require.Len(t, res.Data, 1)
+			require.Len(t, res.Data[0].Reactions, 1)
+			assert.Equal(t, int64(1), res.Data[0].Reactions[0].Count)
+			assert.Equal(t, tc.wantReacted, res.Data[0].Reactions[0].Reacted)
+		})
+	}
+}
+
+func TestCommentReactionKeys(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       CommentConfig
+		reaction  string
+		wantCode  int
+		wantError string
+	}{
+		{name: "默认表情", reaction: "thumbsup", wantCode: http.StatusOK},
+		{name: "不在默认表情中", reaction: "rocket", wantCode: http.StatusBadRequest, wantError: "reaction.not_allowed"},
+		{name: "配置的表情", cfg: CommentConfig{ReactionKeys: []string{"rocket"}}, reaction: "rocket", wantCode: http.StatusOK},
+		// 配置后只能使用配置的表情
+		{name: "不在配置中", cfg: CommentConfig{ReactionKeys: []string{"rocket"}}, reaction: "thumbsup",
+			wantCode: http.StatusBadRequest, wantError: "reaction.not_allowed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comments := newFakeCommentDAO(dao.Comment{ID: 1, UserID: 1, PostID: 1, Content: "评论", Status: dao.CommentStatusApproved})
+			h := newTestCommentHandler(comments, &fakeMentionDAO{}, tc.cfg, dao.Post{ID: 1, Author: 1})
+			server := newTestServer(fakeLogin(2))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/comments/react", `{"commentId":1,"reaction":"`+tc.reaction+`"}`)
+			require.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			var res domain.Result
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			assert.Equal(t, tc.wantError, res.Error)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"blog/domain"
+	"blog/errs"
+	"blog/i18n"
+	"blog/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+)
+
+// fail 中止请求，错误由 middleware.ErrorBuilder 统一渲染
+func fail(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
+
+// notFound 记录不存在时换成更具体的错误，数据库故障等其他错误原样返回
+func notFound(err error, e *errs.Error) error {
+	if errors.Is(err, errs.ErrNotFound) {
+		return e.With(err)
+	}
+	return err
+}
+
+// currentUserId 当前登录用户ID
+func currentUserId(ctx *gin.Context) (int64, error) {
+	userIdInterface, exists := ctx.Get("user_id")
+	if !exists {
+		return 0, errs.ErrUnauthenticated
+	}
+	userIdFloat, ok := userIdInterface.(float64)
+	if !ok {
+		return 0, errs.ErrUnauthenticated
+	}
+	return int64(userIdFloat), nil
+}
+
+// requireLogin 声明路由需要登录，全局的 JWT 中间件是可选登录模式，未登录时在这里返回 401。
+// 只接受登录 token，访问令牌能调用的路由用 requireScope 声明
+func requireLogin(ctx *gin.Context) {
+	if _, err := currentUserId(ctx); err != nil {
+		fail(ctx, err)
+		return
+	}
+	if _, ok := ctx.Get(middleware.ScopesKey); ok {
+		fail(ctx, errs.SessionRequired)
+	}
+}
+
+// requireScope 声明路由需要登录，使用访问令牌时还要有 scope 权限，登录 token 不受限制
+func requireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, err := currentUserId(ctx); err != nil {
+			fail(ctx, err)
+			return
+		}
+		scopes, ok := ctx.Value(middleware.ScopesKey).([]string)
+		if ok && !slices.Contains(scopes, scope) {
+			fail(ctx, errs.TokenScope.WithArgs(scope))
+		}
+	}
+}
+
+// viewerId 当前登录用户ID，未登录时为 0
+func viewerId(ctx *gin.Context) int64 {
+	userIdFloat, _ := ctx.Value("user_id").(float64)
+	return int64(userIdFloat)
+}
+
+// readerId 允许匿名访问的读接口中的查看者ID，访问令牌没有 read 权限时按匿名处理
+func readerId(ctx *gin.Context) int64 {
+	scopes, ok := ctx.Value(middleware.ScopesKey).([]string)
+	if ok && !slices.Contains(scopes, ScopeRead) {
+		return 0
+	}
+	return viewerId(ctx)
+}
+
+// success 返回成功响应，提示文案按请求的语言翻译
+func success(ctx *gin.Context, key string, data any) {
+	lang := locale(ctx)
+	ctx.Header("Content-Language", lang)
+	ctx.JSON(http.StatusOK, domain.Result{
+		Code: 200,
+		Msg:  i18n.T(lang, key),
+		Data: data,
+	})
+}
+
+// locale 优先使用登录用户偏好的语言，其次按 Accept-Language 协商
+func locale(ctx *gin.Context) string {
+	return i18n.Resolve(ctx.GetString(i18n.ContextKey), ctx.GetHeader("Accept-Language"))
+}
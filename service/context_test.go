@@ -0,0 +1,126 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/domain"
+	"blog/filter"
+	"blog/jwks"
+	"blog/middleware"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newAccessServer 注册文章和评论路由，login 模拟不同的登录状态
+func newAccessServer(login gin.HandlerFunc) *gin.Engine {
+	users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", EmailVerified: true})
+	posts := newFakePostDAO(dao.Post{ID: 1, Title: "标题", Content: "内容", Author: 1})
+	comments := newFakeCommentDAO(dao.Comment{ID: 1, UserID: 1, PostID: 1, Content: "评论", Status: dao.CommentStatusApproved})
+	server := newTestServer(login)
+	NewPostHandler(posts, users, &fakeMentionDAO{}, newFakeTagDAO(), filter.NewChain()).RegisterRoutes(server)
+	newTestCommentHandler(comments, &fakeMentionDAO{}, CommentConfig{}, dao.Post{ID: 1, Author: 1}).RegisterRoutes(server)
+	return server
+}
+
+func TestRouteAccess(t *testing.T) {
+	testCases := []struct {
+		name      string
+		login     gin.HandlerFunc
+		method    string
+		path      string
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		// 读接口允许匿名访问
+		{name: "匿名查看文章", login: fakeLogin(0), method: http.MethodGet, path: "/posts/detail/1", wantCode: http.StatusOK},
+		{name: "匿名查看评论", login: fakeLogin(0), method: http.MethodPost, path: "/comments/list", body: `{"postId":1}`, wantCode: http.StatusOK},
+		// 写接口需要登录
+		{name: "匿名发文章", login: fakeLogin(0), method: http.MethodPost, path: "/posts/edit", body: `{"title":"标题","content":"内容"}`,
+			wantCode: http.StatusUnauthorized, wantError: "unauthenticated"},
+		{name: "匿名删文章", login: fakeLogin(0), method: http.MethodDelete, path: "/posts/delete/1",
+			wantCode: http.StatusUnauthorized, wantError: "unauthenticated"},
+		{name: "匿名发评论", login: fakeLogin(0), method: http.MethodPost, path: "/comments/edit", body: `{"postId":1,"content":"评论"}`,
+			wantCode: http.StatusUnauthorized, wantError: "unauthenticated"},
+		{name: "匿名表情回应", login: fakeLogin(0), method: http.MethodPost, path: "/comments/react", body: `{"commentId":1,"reaction":"heart"}`,
+			wantCode: http.StatusUnauthorized, wantError: "unauthenticated"},
+		{name: "匿名审核评论", login: fakeLogin(0), method: http.MethodPost, path: "/comments/moderation/pending", body: `{}`,
+			wantCode: http.StatusUnauthorized, wantError: "unauthenticated"},
+		// 访问令牌受 scope 限制，只能登录后调用的接口不接受访问令牌
+		{name: "访问令牌缺少权限", login: fakeLogin(1, ScopeRead), method: http.MethodPost, path: "/posts/edit", body: `{"title":"标题","content":"内容"}`,
+			wantCode: http.StatusForbidden, wantError: "auth.token_scope"},
+		{name: "访问令牌审核评论", login: fakeLogin(1, ScopeRead, ScopeCommentsWrite), method: http.MethodPost, path: "/comments/moderation/pending", body: `{}`,
+			wantCode: http.StatusForbidden, wantError: "auth.session_required"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := doRequest(newAccessServer(tc.login), tc.method, tc.path, tc.body)
+			require.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			var res domain.Result
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			assert.Equal(t, tc.wantError, res.Error)
+		})
+	}
+}
+
+// 全局 JWT 中间件是可选登录，被吊销的 token 按匿名处理：读接口正常返回，写接口返回 401
+func TestRevokedTokenAnonymous(t *testing.T) {
+	key, err := jwks.Generate("test")
+	require.NoError(t, err)
+	keys, err := jwks.New([]*jwks.Key{key}, "")
+	require.NoError(t, err)
+	exp := time.Now().Add(time.Hour).Unix()
+	revoked, err := keys.Sign(jwt.MapClaims{"id": 1, middleware.SessionKey: "s-revoked", "exp": exp})
+	require.NoError(t, err)
+	active, err := keys.Sign(jwt.MapClaims{"id": 1, middleware.SessionKey: "s-active", "exp": exp})
+	require.NoError(t, err)
+
+	var user any
+	login := middleware.NewLoginJWTMiddleware(keys).Optional().
+		Check(func(ctx *gin.Context, claims jwt.MapClaims) bool {
+			return claims[middleware.SessionKey] != "s-revoked"
+		}).Build()
+	server := newAccessServer(func(ctx *gin.Context) {
+		login(ctx)
+		user, _ = ctx.Get("user_id")
+	})
+
+	testCases := []struct {
+		name     string
+		token    string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantUser any
+	}{
+		{name: "有效 token 发评论", token: active, method: http.MethodPost, path: "/comments/edit", body: `{"postId":1,"content":"评论"}`,
+			wantCode: http.StatusOK, wantUser: float64(1)},
+		{name: "吊销的 token 查看文章", token: revoked, method: http.MethodGet, path: "/posts/detail/1", wantCode: http.StatusOK},
+		{name: "吊销的 token 查看评论", token: revoked, method: http.MethodPost, path: "/comments/list", body: `{"postId":1}`,
+			wantCode: http.StatusOK},
+		{name: "吊销的 token 发评论", token: revoked, method: http.MethodPost, path: "/comments/edit", body: `{"postId":1,"content":"评论"}`,
+			wantCode: http.StatusUnauthorized},
+		{name: "吊销的 token 删文章", token: revoked, method: http.MethodDelete, path: "/posts/delete/1", wantCode: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user = nil
+			req := newRequest(tc.method, tc.path, tc.body)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			// 被吊销的 token 不会在 context 中留下用户信息
+			assert.Equal(t, tc.wantUser, user)
+		})
+	}
+}
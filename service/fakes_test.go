@@ -0,0 +1,520 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/middleware"
+	"blog/validate"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	if err := validate.Register(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// 内存实现的 DAO，只实现测试用到的方法，其余方法由嵌入的 nil 接口 panic，漏掉时测试会直接失败
+
+type fakeUserDAO struct {
+	dao.UserDAO
+	mu    sync.Mutex
+	users map[int64]dao.User
+}
+
+func newFakeUserDAO(users ...dao.User) *fakeUserDAO {
+	f := &fakeUserDAO{users: map[int64]dao.User{}}
+	for _, u := range users {
+		f.users[int64(u.ID)] = u
+	}
+	return f
+}
+
+func (f *fakeUserDAO) FindById(ctx context.Context, id int64) (dao.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[id]
+	if !ok {
+		return dao.User{}, errs.ErrNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUserDAO) FindByIds(ctx context.Context, ids []int64) ([]dao.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.User
+	for _, id := range ids {
+		if u, ok := f.users[id]; ok {
+			res = append(res, u)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeUserDAO) FindByEmail(ctx context.Context, email string) (dao.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return dao.User{}, errs.ErrNotFound
+}
+
+func (f *fakeUserDAO) ScheduleDeletion(ctx context.Context, id int64, at int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.users[id]
+	u.DeletionScheduledAt = at
+	f.users[id] = u
+	return nil
+}
+
+func (f *fakeUserDAO) UpdateProfile(ctx context.Context, id int64, p dao.ProfileUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[id]
+	if !ok {
+		return errs.ErrNotFound
+	}
+	for _, field := range []struct {
+		dst *string
+		src *string
+	}{{&u.DisplayName, p.DisplayName}, {&u.Bio, p.Bio}, {&u.Website, p.Website}, {&u.Avatar, p.Avatar}} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	f.users[id] = u
+	return nil
+}
+
+func (f *fakeUserDAO) FindByUsername(ctx context.Context, username string) (dao.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// 和 MySQL 默认的排序规则一样不区分大小写
+	for _, u := range f.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, nil
+		}
+	}
+	return dao.User{}, errs.ErrNotFound
+}
+
+func (f *fakeUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[id]
+	if !ok {
+		return errs.ErrNotFound
+	}
+	u.Password = password
+	u.TokenVersion++
+	f.users[id] = u
+	return nil
+}
+
+type fakePostDAO struct {
+	dao.PostDAO
+	mu    sync.Mutex
+	posts map[int64]dao.Post
+	seq   int64
+}
+
+func newFakePostDAO(posts ...dao.Post) *fakePostDAO {
+	f := &fakePostDAO{posts: map[int64]dao.Post{}}
+	for _, p := range posts {
+		f.posts[p.ID] = p
+		f.seq = max(f.seq, p.ID)
+	}
+	return f
+}
+
+func (f *fakePostDAO) Create(ctx context.Context, post dao.Post) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	post.ID = f.seq
+	f.posts[post.ID] = post
+	return post.ID, nil
+}
+
+func (f *fakePostDAO) UpdateById(ctx context.Context, post dao.Post) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old, ok := f.posts[post.ID]
+	if !ok {
+		return errs.ErrForbidden
+	}
+	old.Title, old.Content = post.Title, post.Content
+	f.posts[post.ID] = old
+	return nil
+}
+
+func (f *fakePostDAO) FindById(ctx context.Context, id int64) (dao.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.posts[id]
+	if !ok {
+		return dao.Post{}, errs.ErrNotFound
+	}
+	return p, nil
+}
+
+func (f *fakePostDAO) ListRecent(ctx context.Context, authorId int64, tag string, limit int) ([]dao.Post, error) {
+	return f.ListByAuthor(ctx, authorId, 0, limit)
+}
+
+func (f *fakePostDAO) ListByAuthor(ctx context.Context, authorId int64, offset int, limit int) ([]dao.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Post
+	for _, p := range f.posts {
+		if authorId == 0 || p.Author == authorId {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Ctime > res[j].Ctime })
+	if offset > len(res) {
+		offset = len(res)
+	}
+	res = res[offset:]
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (f *fakePostDAO) CountByAuthor(ctx context.Context, authorId int64) (int64, error) {
+	posts, err := f.ListByAuthor(ctx, authorId, 0, 0)
+	return int64(len(posts)), err
+}
+
+type fakeCommentDAO struct {
+	dao.CommentDAO
+	mu       sync.Mutex
+	comments map[int64]dao.Comment
+	seq      int64
+}
+
+func newFakeCommentDAO(comments ...dao.Comment) *fakeCommentDAO {
+	f := &fakeCommentDAO{comments: map[int64]dao.Comment{}}
+	for _, c := range comments {
+		f.comments[c.ID] = c
+		f.seq = max(f.seq, c.ID)
+	}
+	return f
+}
+
+func (f *fakeCommentDAO) Create(ctx context.Context, comment dao.Comment) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if comment.ID == 0 {
+		f.seq++
+		comment.ID = f.seq
+	}
+	f.comments[comment.ID] = comment
+	return comment.ID, nil
+}
+
+func (f *fakeCommentDAO) FindById(ctx context.Context, id int64) (dao.Comment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.comments[id]
+	if !ok {
+		return dao.Comment{}, errs.ErrNotFound
+	}
+	return c, nil
+}
+
+func (f *fakeCommentDAO) LIST(ctx context.Context, postId int64, offset int, limit int) ([]dao.Comment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Comment
+	for _, c := range f.comments {
+		if c.PostID == postId && c.Status == dao.CommentStatusApproved {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (f *fakeCommentDAO) FindByIds(ctx context.Context, ids []int64) ([]dao.Comment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Comment
+	for id, c := range f.comments {
+		if slices.Contains(ids, id) {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (f *fakeCommentDAO) CountByUser(ctx context.Context, userId int64, status uint8) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cnt int64
+	for _, c := range f.comments {
+		if c.UserID == userId && c.Status == status {
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (f *fakeCommentDAO) UpdateStatus(ctx context.Context, ids []int64, status uint8) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if c, ok := f.comments[id]; ok {
+			c.Status = status
+			f.comments[id] = c
+		}
+	}
+	return nil
+}
+
+type fakeReactionDAO struct {
+	dao.ReactionDAO
+	mu        sync.Mutex
+	reactions []dao.Reaction
+}
+
+func (f *fakeReactionDAO) Toggle(ctx context.Context, commentId int64, userId int64, reaction string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.reactions)
+	f.reactions = slices.DeleteFunc(f.reactions, func(r dao.Reaction) bool {
+		return r.CommentID == commentId && r.UserID == userId && r.Reaction == reaction
+	})
+	if len(f.reactions) < n {
+		return false, nil
+	}
+	f.reactions = append(f.reactions, dao.Reaction{CommentID: commentId, UserID: userId, Reaction: reaction})
+	return true, nil
+}
+
+func (f *fakeReactionDAO) CountByComments(ctx context.Context, commentIds []int64) ([]dao.ReactionCount, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := map[dao.ReactionCount]int64{}
+	for _, r := range f.reactions {
+		if slices.Contains(commentIds, r.CommentID) {
+			counts[dao.ReactionCount{CommentID: r.CommentID, Reaction: r.Reaction}]++
+		}
+	}
+	var res []dao.ReactionCount
+	for k, cnt := range counts {
+		k.Count = cnt
+		res = append(res, k)
+	}
+	return res, nil
+}
+
+func (f *fakeReactionDAO) FindByUser(ctx context.Context, commentIds []int64, userId int64) ([]dao.Reaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Reaction
+	for _, r := range f.reactions {
+		if r.UserID == userId && slices.Contains(commentIds, r.CommentID) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+type fakeMediaDAO struct {
+	dao.MediaDAO
+	mu    sync.Mutex
+	media []dao.Media
+}
+
+func (f *fakeMediaDAO) ListByUser(ctx context.Context, userId int64, offset int, limit int) ([]dao.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Media
+	for _, m := range f.media {
+		if m.UserID == userId {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeMediaDAO) CountByName(ctx context.Context, name string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cnt int64
+	for _, m := range f.media {
+		if m.Name == name {
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+type fakeSessionDAO struct {
+	dao.SessionDAO
+	mu       sync.Mutex
+	sessions []dao.Session
+}
+
+func (f *fakeSessionDAO) RevokeOthers(ctx context.Context, userId int64, keepSID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, s := range f.sessions {
+		if s.UserID == userId && s.SID != keepSID && s.RevokedAt == 0 {
+			f.sessions[i].RevokedAt = time.Now().UnixMilli()
+		}
+	}
+	return nil
+}
+
+type fakeAccessTokenDAO struct {
+	dao.AccessTokenDAO
+	mu     sync.Mutex
+	tokens []dao.AccessToken
+}
+
+func (f *fakeAccessTokenDAO) FindByHash(ctx context.Context, hash string) (dao.AccessToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.tokens {
+		if t.TokenHash == hash {
+			return t, nil
+		}
+	}
+	return dao.AccessToken{}, errs.ErrNotFound
+}
+
+func (f *fakeAccessTokenDAO) RevokeAll(ctx context.Context, userId int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, t := range f.tokens {
+		if t.UserID == userId && t.RevokedAt == 0 {
+			f.tokens[i].RevokedAt = time.Now().UnixMilli()
+		}
+	}
+	return nil
+}
+
+func (f *fakeAccessTokenDAO) Touch(ctx context.Context, id int64) error {
+	return nil
+}
+
+type fakeTagDAO struct {
+	dao.TagDAO
+	mu   sync.Mutex
+	tags map[int64][]string
+	// replaced 调用 Replace 的次数
+	replaced int
+}
+
+func newFakeTagDAO() *fakeTagDAO {
+	return &fakeTagDAO{tags: map[int64][]string{}}
+}
+
+func (f *fakeTagDAO) Replace(ctx context.Context, postId int64, tags []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replaced++
+	f.tags[postId] = slices.Clone(tags)
+	return nil
+}
+
+func (f *fakeTagDAO) FindByPosts(ctx context.Context, postIds []int64) ([]dao.PostTag, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.PostTag
+	for _, id := range postIds {
+		for _, tag := range f.tags[id] {
+			res = append(res, dao.PostTag{PostID: id, Tag: tag})
+		}
+	}
+	return res, nil
+}
+
+type fakeMentionDAO struct {
+	dao.MentionDAO
+	mu       sync.Mutex
+	mentions []dao.Mention
+}
+
+func (f *fakeMentionDAO) Replace(ctx context.Context, sourceType string, sourceId int64, mentions []dao.Mention) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mentions = slices.DeleteFunc(f.mentions, func(m dao.Mention) bool {
+		return m.SourceType == sourceType && m.SourceID == sourceId
+	})
+	for _, m := range mentions {
+		m.SourceType, m.SourceID = sourceType, sourceId
+		f.mentions = append(f.mentions, m)
+	}
+	return nil
+}
+
+func (f *fakeMentionDAO) FindBySources(ctx context.Context, sourceType string, sourceIds []int64) ([]dao.Mention, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []dao.Mention
+	for _, m := range f.mentions {
+		if m.SourceType == sourceType && slices.Contains(sourceIds, m.SourceID) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// fakeLogin 模拟登录中间件写入的用户信息，scopes 不为空时模拟访问令牌
+func fakeLogin(userId int64, scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if userId == 0 {
+			return
+		}
+		ctx.Set("user_id", float64(userId))
+		if len(scopes) > 0 {
+			ctx.Set(middleware.ScopesKey, scopes)
+		}
+	}
+}
+
+// newTestServer 带错误渲染中间件的测试服务器
+func newTestServer(mws ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(append([]gin.HandlerFunc{middleware.NewErrorBuilder().Build()}, mws...)...)
+	return server
+}
+
+func doRequest(server *gin.Engine, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, newRequest(method, target, body))
+	return recorder
+}
+
+// newRequest body 不为空时作为 JSON 请求体
+func newRequest(method string, target string, body string) *http.Request {
+	if body == "" {
+		return httptest.NewRequest(method, target, nil)
+	}
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
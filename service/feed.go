@@ -0,0 +1,178 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/feed"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type FeedConfig struct {
+	Title       string
+	Description string
+	// 站点地址，如 https://blog.example.com
+	SiteURL string
+	// 文章页面的地址，%d 会被替换为文章ID
+	PostURL string
+	// 每个订阅源输出的文章数
+	Items int
+	// 为 true 时只输出摘要，否则输出全文
+	Summary bool
+	// 摘要的字数
+	SummaryLength int
+}
+
+// FeedHandler 公开的 RSS、Atom 和 JSON Feed 订阅源，可以按作者和标签筛选
+type FeedHandler struct {
+	postDAO dao.PostDAO
+	userDAO dao.UserDAO
+	views   postViews
+	cfg     FeedConfig
+}
+
+func NewFeedHandler(postDAO dao.PostDAO, userDAO dao.UserDAO, mentionDAO dao.MentionDAO, tagDAO dao.TagDAO, cfg FeedConfig) *FeedHandler {
+	cfg.SiteURL = strings.TrimSuffix(cfg.SiteURL, "/")
+	return &FeedHandler{
+		postDAO: postDAO,
+		userDAO: userDAO,
+		views: postViews{
+			userDAO:  userDAO,
+			tagDAO:   tagDAO,
+			mentions: mentionRecorder{userDAO: userDAO, mentionDAO: mentionDAO},
+		},
+		cfg: cfg,
+	}
+}
+
+func (h *FeedHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	fg := server.Group("/", mws...)
+	fg.GET("/feed.xml", h.serve(feed.RSS, feed.ContentTypeRSS))
+	fg.GET("/atom.xml", h.serve(feed.Atom, feed.ContentTypeAtom))
+	fg.GET("/feed.json", h.serve(feed.JSON, feed.ContentTypeJSON))
+}
+
+// serve 支持 ?author=用户名 和 ?tag=标签 筛选
+func (h *FeedHandler) serve(render func(io.Writer, feed.Feed) error, contentType string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		f, err := h.build(ctx, ctx.Query("author"), ctx.Query("tag"))
+		if err != nil {
+			fail(ctx, notFound(err, errs.UserNotFound))
+			zap.L().Info("生成订阅源失败", zap.Error(err), zap.String("url", ctx.Request.URL.String()))
+			return
+		}
+		f.Self = h.cfg.SiteURL + ctx.Request.URL.RequestURI()
+
+		var buf bytes.Buffer
+		if err = render(&buf, f); err != nil {
+			fail(ctx, err)
+			zap.L().Error("输出订阅源失败", zap.Error(err))
+			return
+		}
+		ctx.Header("Cache-Control", "public, max-age=300")
+		if notModified(ctx, contentETag(buf.Bytes()), f.Updated) {
+			return
+		}
+		ctx.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+func (h *FeedHandler) build(ctx context.Context, username string, tag string) (feed.Feed, error) {
+	f := feed.Feed{
+		Title:       h.cfg.Title,
+		Description: h.cfg.Description,
+		Link:        h.cfg.SiteURL + "/",
+	}
+	var authorId int64
+	if username != "" {
+		usr, err := h.userDAO.FindByUsername(ctx, username)
+		if err != nil {
+			return feed.Feed{}, err
+		}
+		authorId = int64(usr.ID)
+		f.Title += " - " + displayName(toAuthorVO(usr))
+	}
+	tags := normalizeTags([]string{tag})
+	tag = ""
+	if len(tags) > 0 {
+		tag = tags[0]
+		f.Title += " #" + tag
+	}
+
+	posts, err := h.postDAO.ListRecent(ctx, authorId, tag, h.cfg.Items)
+	if err != nil {
+		return feed.Feed{}, err
+	}
+	for _, vo := range h.views.build(ctx, posts) {
+		link := fmt.Sprintf(h.cfg.PostURL, vo.Id)
+		item := feed.Item{
+			ID:         link,
+			Title:      vo.Title,
+			Link:       link,
+			Author:     displayName(vo.Author),
+			Categories: vo.Tags,
+			Published:  time.UnixMilli(vo.Ctime),
+			Updated:    time.UnixMilli(vo.Utime),
+		}
+		if h.cfg.Summary {
+			item.Summary = feed.Summarize(vo.Content, h.cfg.SummaryLength)
+		} else {
+			item.Content = vo.Content
+		}
+		if item.Updated.After(f.Updated) {
+			f.Updated = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+// displayName 没有设置昵称时使用用户名
+func displayName(a AuthorVO) string {
+	if a.DisplayName != "" {
+		return a.DisplayName
+	}
+	return a.Username
+}
+
+// contentETag 按响应内容生成强校验的 ETag
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified 设置 ETag 和 Last-Modified，客户端缓存仍然有效时返回 304
+func notModified(ctx *gin.Context, etag string, modified time.Time) bool {
+	ctx.Header("ETag", etag)
+	if !modified.IsZero() {
+		ctx.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	// 有 If-None-Match 时忽略 If-Modified-Since
+	if inm := ctx.GetHeader("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				ctx.Status(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if ims := ctx.GetHeader("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err == nil && !modified.Truncate(time.Second).After(t) {
+			ctx.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"blog/dao"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFeedHandler(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC).UnixMilli()
+	users := newFakeUserDAO(
+		dao.User{Model: gorm.Model{ID: 1}, Username: "alice", DisplayName: "Alice"},
+		dao.User{Model: gorm.Model{ID: 2}, Username: "bob"},
+	)
+	posts := newFakePostDAO(
+		dao.Post{ID: 1, Title: "第一篇", Content: "你好 @bob", Author: 1, Ctime: now, Utime: now},
+		dao.Post{ID: 2, Title: "第二篇", Content: "正文", Author: 2, Ctime: now + 1000, Utime: now + 1000},
+	)
+	tags := newFakeTagDAO()
+	tags.tags[1] = []string{"go"}
+	mentions := &fakeMentionDAO{mentions: []dao.Mention{
+		{SourceType: dao.MentionSourcePost, SourceID: 1, UserID: 2, Username: "bob"},
+	}}
+	h := NewFeedHandler(posts, users, mentions, tags, FeedConfig{
+		Title:   "博客",
+		SiteURL: "https://blog.example.com/",
+		PostURL: "https://blog.example.com/posts/%d",
+		Items:   10,
+	})
+	server := newTestServer()
+	h.RegisterRoutes(server)
+
+	testCases := []struct {
+		name        string
+		target      string
+		wantCode    int
+		wantContain []string
+	}{
+		{name: "RSS", target: "/feed.xml", wantCode: http.StatusOK, wantContain: []string{"第一篇", "第二篇", "<category>go</category>"}},
+		{name: "Atom", target: "/atom.xml", wantCode: http.StatusOK, wantContain: []string{"第一篇", "Alice"}},
+		{name: "JSON Feed", target: "/feed.json", wantCode: http.StatusOK, wantContain: []string{"第一篇", "https://blog.example.com/posts/2"}},
+		{name: "按作者筛选", target: "/feed.json?author=bob", wantCode: http.StatusOK, wantContain: []string{"第二篇"}},
+		{name: "作者不存在", target: "/feed.json?author=nobody", wantCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := doRequest(server, http.MethodGet, tc.target, "")
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for _, s := range tc.wantContain {
+				assert.Contains(t, recorder.Body.String(), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"blog/jwks"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// JWKSHandler 公开 token 的验证公钥，其他服务据此验证本站签发的 token
+type JWKSHandler struct {
+	keys *jwks.KeySet
+}
+
+func NewJWKSHandler(keys *jwks.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	wg := server.Group("/.well-known", mws...)
+	wg.GET("/jwks.json", h.JWKS)
+}
+
+// JWKS 按 RFC 7517 的格式返回，不使用统一的响应结构。
+// 轮换时新公钥要先发布出去，其他服务的缓存过期后才能开始用新私钥签名
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.keys.JWKS())
+}
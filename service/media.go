@@ -0,0 +1,200 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/media"
+	"blog/validate"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// 媒体文件的访问路径前缀
+const mediaFilePrefix = "/media/files/"
+
+// 媒体库每页最多返回的文件数
+const mediaListLimit = 100
+
+type MediaHandler struct {
+	dao       dao.MediaDAO
+	userDAO   dao.UserDAO
+	processor *media.Processor
+}
+
+type MediaThumbnailVO struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type MediaVO struct {
+	Id         int64              `json:"id"`
+	URL        string             `json:"url"`
+	Filename   string             `json:"filename"`
+	Mime       string             `json:"mime"`
+	Size       int64              `json:"size"`
+	Width      int                `json:"width"`
+	Height     int                `json:"height"`
+	Thumbnails []MediaThumbnailVO `json:"thumbnails"`
+	Ctime      int64              `json:"ctime"`
+}
+
+func NewMediaHandler(dao dao.MediaDAO, userDAO dao.UserDAO, processor *media.Processor) *MediaHandler {
+	return &MediaHandler{dao: dao, userDAO: userDAO, processor: processor}
+}
+
+func (h *MediaHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	mg := server.Group("/media", mws...)
+	mg.POST("/upload", requireScope(ScopePostsWrite), requireVerifiedEmail(h.userDAO), h.Upload)
+	mg.POST("/list", requireScope(ScopeRead), h.List)
+	mg.GET("/files/:name", h.File)
+}
+
+func toMediaVO(m dao.Media) MediaVO {
+	thumbs := make([]MediaThumbnailVO, 0, len(m.Thumbnails))
+	for _, t := range m.Thumbnails {
+		thumbs = append(thumbs, MediaThumbnailVO{URL: mediaFilePrefix + t.Name, Width: t.Width, Height: t.Height})
+	}
+	return MediaVO{
+		Id:         m.ID,
+		URL:        mediaFilePrefix + m.Name,
+		Filename:   m.Filename,
+		Mime:       m.Mime,
+		Size:       m.Size,
+		Width:      m.Width,
+		Height:     m.Height,
+		Thumbnails: thumbs,
+		Ctime:      m.Ctime,
+	}
+}
+
+// Upload 上传图片到当前用户的媒体库，表单字段为 file
+func (h *MediaHandler) Upload(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	// 留出 multipart 头部的余量，文件本身的大小由 Processor 判断
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, h.processor.MaxBytes()+1<<20)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			fail(ctx, errs.MediaTooLarge.WithArgs(h.processor.MaxBytes()>>20).With(err))
+			return
+		}
+		fail(ctx, errs.ErrInvalidArgument.With(err))
+		zap.L().Info("上传文件参数错误", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("打开上传文件失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	defer f.Close()
+
+	file, err := h.processor.Process(ctx, f)
+	switch {
+	case errors.Is(err, media.ErrTooLarge):
+		fail(ctx, errs.MediaTooLarge.WithArgs(h.processor.MaxBytes()>>20).With(err))
+		return
+	case errors.Is(err, media.ErrUnsupportedType):
+		fail(ctx, errs.MediaUnsupported.With(err))
+		zap.L().Info("上传文件类型不支持", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	case err != nil:
+		fail(ctx, err)
+		zap.L().Error("处理上传文件失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+
+	thumbs := make([]dao.MediaThumbnail, 0, len(file.Thumbnails))
+	for _, t := range file.Thumbnails {
+		thumbs = append(thumbs, dao.MediaThumbnail{Name: t.Name, Width: t.Width, Height: t.Height})
+	}
+	m, err := h.dao.Create(ctx, dao.Media{
+		UserID:     userId,
+		Name:       file.Name,
+		Filename:   truncate(header.Filename, 255),
+		Mime:       file.Mime,
+		Size:       file.Size,
+		Width:      file.Width,
+		Height:     file.Height,
+		Thumbnails: thumbs,
+	})
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("保存媒体记录失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgMediaUploaded, toMediaVO(m))
+}
+
+// List 当前用户的媒体库，最新上传的在前
+func (h *MediaHandler) List(ctx *gin.Context) {
+	type ListReq struct {
+		Offset int `json:"offset" binding:"min=0"`
+		Limit  int `json:"limit" binding:"min=0,max=100"`
+	}
+	var req ListReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("获取媒体库参数绑定错误", zap.Error(err))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = mediaListLimit
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	list, err := h.dao.ListByUser(ctx, userId, req.Offset, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("获取媒体库失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	voList := make([]MediaVO, 0, len(list))
+	for _, m := range list {
+		voList = append(voList, toMediaVO(m))
+	}
+	success(ctx, msgMediaList, voList)
+}
+
+// File 读取原图或缩略图，文件名由内容哈希生成，内容不会变，可以永久缓存
+func (h *MediaHandler) File(ctx *gin.Context) {
+	name := ctx.Param("name")
+	rc, mime, err := h.processor.Open(ctx, name)
+	if errors.Is(err, media.ErrNotFound) {
+		fail(ctx, errs.MediaNotFound.With(err))
+		return
+	}
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("读取媒体文件失败", zap.Error(err), zap.String("name", name))
+		return
+	}
+	defer rc.Close()
+	ctx.DataFromReader(http.StatusOK, -1, mime, rc, map[string]string{
+		"Cache-Control":          "public, max-age=31536000, immutable",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// truncate 按字符截断，避免截断半个汉字
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/mention"
+	"blog/validate"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type MentionHandler struct {
+	dao     dao.MentionDAO
+	userDAO dao.UserDAO
+}
+
+type MentionVO struct {
+	Id         int64  `json:"id"`
+	SourceType string `json:"sourceType"`
+	SourceId   int64  `json:"sourceId"`
+	PostId     int64  `json:"postId"`
+	Author     string `json:"author"`
+	Ctime      int64  `json:"ctime"`
+}
+
+func NewMentionHandler(dao dao.MentionDAO, userDAO dao.UserDAO) *MentionHandler {
+	return &MentionHandler{dao: dao, userDAO: userDAO}
+}
+
+func (m *MentionHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	mg := server.Group("/mentions", append(mws, requireScope(ScopeRead))...)
+	mg.POST("/list", m.List)
+}
+
+// List 当前用户被提及的记录
+func (m *MentionHandler) List(ctx *gin.Context) {
+	type ListReq struct {
+		Offest int `json:"offset"`
+		Limit  int `json:"limit"`
+	}
+	var req ListReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("获取提及列表参数绑定错误", zap.Error(err))
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	mentions, err := m.dao.ListByUser(ctx, userId, req.Offest, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("获取提及列表失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	voList := make([]MentionVO, 0, len(mentions))
+	for _, mt := range mentions {
+		usr, err := m.userDAO.FindById(ctx, mt.AuthorID)
+		authorName := ""
+		if err == nil {
+			authorName = usr.Username
+		}
+		voList = append(voList, MentionVO{
+			Id:         mt.ID,
+			SourceType: mt.SourceType,
+			SourceId:   mt.SourceID,
+			PostId:     mt.PostID,
+			Author:     authorName,
+			Ctime:      mt.Ctime,
+		})
+	}
+	success(ctx, msgMentionList, voList)
+}
+
+// mentionRecorder 供文章和评论共用的提及解析、存储和渲染
+type mentionRecorder struct {
+	userDAO    dao.UserDAO
+	mentionDAO dao.MentionDAO
+}
+
+// record 解析内容中的 @用户名 并保存，提及失败不影响内容本身的保存
+func (m mentionRecorder) record(ctx context.Context, sourceType string, sourceId int64, postId int64, authorId int64, content string) {
+	var mentions []dao.Mention
+	// 用户名查询不区分大小写，@Bob 和 @bob 会查到同一个用户
+	seen := make(map[uint]struct{})
+	for _, name := range mention.Parse(content) {
+		usr, err := m.userDAO.FindByUsername(ctx, name)
+		if err != nil {
+			// 未知用户名保持纯文本
+			continue
+		}
+		if _, ok := seen[usr.ID]; ok {
+			continue
+		}
+		seen[usr.ID] = struct{}{}
+		mentions = append(mentions, dao.Mention{
+			UserID:   int64(usr.ID),
+			Username: usr.Username,
+			AuthorID: authorId,
+			PostID:   postId,
+		})
+	}
+	err := m.mentionDAO.Replace(ctx, sourceType, sourceId, mentions)
+	if err != nil {
+		zap.L().Error("保存提及失败", zap.Error(err), zap.String("source_type", sourceType), zap.Int64("source_id", sourceId))
+	}
+}
+
+// known 返回每条内容中已解析到的用户名
+func (m mentionRecorder) known(ctx context.Context, sourceType string, sourceIds []int64) map[int64]map[string]struct{} {
+	res := make(map[int64]map[string]struct{}, len(sourceIds))
+	mentions, err := m.mentionDAO.FindBySources(ctx, sourceType, sourceIds)
+	if err != nil {
+		zap.L().Error("查询提及失败", zap.Error(err), zap.String("source_type", sourceType))
+		return res
+	}
+	for _, mt := range mentions {
+		names, ok := res[mt.SourceID]
+		if !ok {
+			names = make(map[string]struct{})
+			res[mt.SourceID] = names
+		}
+		names[mt.Username] = struct{}{}
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"blog/dao"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMentionRecorder(t *testing.T) {
+	users := newFakeUserDAO(
+		dao.User{Model: gorm.Model{ID: 1}, Username: "alice"},
+		dao.User{Model: gorm.Model{ID: 2}, Username: "bob"},
+		dao.User{Model: gorm.Model{ID: 3}, Username: "carol"},
+	)
+	testCases := []struct {
+		name    string
+		content string
+		want    []int64
+	}{
+		{name: "多个用户", content: "@bob @carol 看看", want: []int64{2, 3}},
+		// 用户名查询不区分大小写，同一个用户只记一次
+		{name: "大小写不同的同一个用户", content: "@Bob @bob @BOB", want: []int64{2}},
+		{name: "未知用户", content: "@dave", want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mentions := &fakeMentionDAO{}
+			m := mentionRecorder{userDAO: users, mentionDAO: mentions}
+			m.record(context.Background(), dao.MentionSourceComment, 1, 1, 1, tc.content)
+			var got []int64
+			for _, mt := range mentions.mentions {
+				got = append(got, mt.UserID)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
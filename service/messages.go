@@ -0,0 +1,48 @@
+package service
+
+import "blog/i18n"
+
+// 成功提示的文案键，翻译在 i18n/locales 中
+var (
+	msgSignedUp          = i18n.Key("user.signed_up")
+	msgLoggedIn          = i18n.Key("user.logged_in")
+	msgLoggedOut         = i18n.Key("user.logged_out")
+	msgMFARequired       = i18n.Key("user.mfa_required")
+	msgTOTPEnroll        = i18n.Key("user.totp_enroll")
+	msgTOTPEnabled       = i18n.Key("user.totp_enabled")
+	msgTOTPDisabled      = i18n.Key("user.totp_disabled")
+	msgRecoveryCodes     = i18n.Key("user.recovery_codes")
+	msgLocaleUpdated     = i18n.Key("user.locale_updated")
+	msgTokenCreated      = i18n.Key("user.token_created")
+	msgTokenList         = i18n.Key("user.token_list")
+	msgTokenRevoked      = i18n.Key("user.token_revoked")
+	msgSessionList       = i18n.Key("user.session_list")
+	msgSessionRevoked    = i18n.Key("user.session_revoked")
+	msgEmailVerifiedOK   = i18n.Key("user.email_verified")
+	msgVerificationSent  = i18n.Key("user.verification_sent")
+	msgProfile           = i18n.Key("user.profile")
+	msgProfileUpdated    = i18n.Key("user.profile_updated")
+	msgPublicProfile     = i18n.Key("user.public_profile")
+	msgDeletionScheduled = i18n.Key("user.deletion_scheduled")
+	msgDeletionCancelled = i18n.Key("user.deletion_cancelled")
+	msgResetSent         = i18n.Key("password.reset_sent")
+	msgPasswordReset     = i18n.Key("password.reset")
+	msgPasswordChanged   = i18n.Key("password.changed")
+	msgUnlocked          = i18n.Key("admin.unlocked")
+	msgPostCreated       = i18n.Key("post.created")
+	msgPostUpdated       = i18n.Key("post.updated")
+	msgPostDeleted       = i18n.Key("post.deleted")
+	msgPostDetail        = i18n.Key("post.detail")
+	msgPostList          = i18n.Key("post.list")
+	msgModerationUpdated = i18n.Key("post.moderation_updated")
+	msgCommentCreated    = i18n.Key("comment.created")
+	msgCommentHeld       = i18n.Key("comment.created_pending")
+	msgCommentList       = i18n.Key("comment.list")
+	msgCommentPending    = i18n.Key("comment.pending")
+	msgCommentReviewed   = i18n.Key("comment.reviewed")
+	msgReacted           = i18n.Key("reaction.reacted")
+	msgReactionUsers     = i18n.Key("reaction.users")
+	msgMentionList       = i18n.Key("mention.list")
+	msgMediaUploaded     = i18n.Key("media.uploaded")
+	msgMediaList         = i18n.Key("media.list")
+)
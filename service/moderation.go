@@ -0,0 +1,172 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/validate"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"slices"
+)
+
+// 单次批量审核的最大评论数
+const maxReviewBatch = 100
+
+// initialStatus 根据文章或全局的审核模式决定新评论的初始状态，文章作者和审核员的评论直接通过
+func (c *CommentHandler) initialStatus(ctx context.Context, post dao.Post, userId int64) (uint8, error) {
+	mode := post.ModerationMode
+	if mode == dao.ModerationInherit {
+		mode = c.moderation
+	}
+	if mode == dao.ModerationInherit || mode == dao.ModerationOpen || post.Author == userId {
+		return dao.CommentStatusApproved, nil
+	}
+	usr, err := c.userDAO.FindById(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	if usr.IsModerator() {
+		return dao.CommentStatusApproved, nil
+	}
+	if mode == dao.ModerationHoldAll {
+		return dao.CommentStatusPending, nil
+	}
+	cnt, err := c.dao.CountByUser(ctx, userId, dao.CommentStatusApproved)
+	if err != nil {
+		return 0, err
+	}
+	if cnt == 0 {
+		return dao.CommentStatusPending, nil
+	}
+	return dao.CommentStatusApproved, nil
+}
+
+// Pending 待审核评论，审核员可以看到全部，文章作者只能看到自己文章下的
+func (c *CommentHandler) Pending(ctx *gin.Context) {
+	type PendingReq struct {
+		PostID int64 `json:"postId"`
+		Offest int   `json:"offset"`
+		Limit  int   `json:"limit"`
+	}
+	var req PendingReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("获取待审核评论参数绑定错误", zap.Error(err))
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	usr, err := c.userDAO.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询审核用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	authorId := userId
+	if usr.IsModerator() {
+		authorId = 0
+	}
+	comments, err := c.dao.ListPending(ctx, authorId, req.PostID, req.Offest, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("获取待审核评论失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgCommentPending, c.toVOs(ctx, comments, userId))
+}
+
+// Review 批量通过或拒绝评论
+func (c *CommentHandler) Review(ctx *gin.Context) {
+	type ReviewReq struct {
+		IDs []int64 `json:"ids"`
+		// approve 或 reject
+		Action string `json:"action"`
+	}
+	var req ReviewReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("审核评论参数绑定错误", zap.Error(err))
+		return
+	}
+	var status uint8
+	switch req.Action {
+	case "approve":
+		status = dao.CommentStatusApproved
+	case "reject":
+		status = dao.CommentStatusRejected
+	default:
+		fail(ctx, errs.ModerationAction)
+		return
+	}
+	// 重复的ID只算一次，否则和查到的评论数对不上
+	slices.Sort(req.IDs)
+	req.IDs = slices.Compact(req.IDs)
+	if len(req.IDs) == 0 || len(req.IDs) > maxReviewBatch {
+		fail(ctx, errs.ModerationBatch)
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	usr, err := c.userDAO.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询审核用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	comments, err := c.dao.FindByIds(ctx, req.IDs)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询待审核评论失败", zap.Error(err))
+		return
+	}
+	if len(comments) != len(req.IDs) {
+		fail(ctx, errs.CommentNotFound)
+		return
+	}
+
+	// 不是审核员时，只能审核自己文章下的评论
+	if !usr.IsModerator() {
+		checked := make(map[int64]bool)
+		for _, comment := range comments {
+			if checked[comment.PostID] {
+				continue
+			}
+			post, err := c.postDAO.FindById(ctx, comment.PostID)
+			if err != nil || post.Author != userId {
+				fail(ctx, errs.ModerationDenied)
+				zap.L().Error("没有审核权限", zap.Int64("post_id", comment.PostID), zap.Int64("user_id", userId))
+				return
+			}
+			checked[comment.PostID] = true
+		}
+	}
+
+	err = c.dao.UpdateStatus(ctx, req.IDs, status)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("更新评论审核状态失败", zap.Error(err))
+		return
+	}
+	for _, comment := range comments {
+		switch {
+		case status == dao.CommentStatusApproved && comment.Status != dao.CommentStatusApproved:
+			comment.Status = status
+			c.publish(ctx, comment)
+		case status == dao.CommentStatusRejected && comment.Status == dao.CommentStatusApproved:
+			// 拒绝已通过的评论时撤回其中的提及
+			c.mentions.record(ctx, dao.MentionSourceComment, comment.ID, comment.PostID, comment.UserID, "")
+		}
+	}
+	success(ctx, msgCommentReviewed, nil)
+}
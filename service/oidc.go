@@ -0,0 +1,253 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/oidc"
+	"blog/sign"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// OIDCConfig 第三方登录配置
+type OIDCConfig struct {
+	// Providers 登录方式名称到客户端，名称出现在登录和回调地址中，如 /user/oidc/github/login
+	Providers map[string]*oidc.Client
+	// AfterLogin 登录完成后跳转的前端页面，开启了两步验证时在 fragment 中带上 mfaToken
+	AfterLogin string
+	// Secure state cookie 是否只在 HTTPS 下发送
+	Secure bool
+}
+
+// OIDCHandler OpenID Connect 登录：授权码模式加 PKCE。
+// 第一次登录时按身份提供方已验证的邮箱关联到已有用户，没有时自动注册
+type OIDCHandler struct {
+	userDAO     dao.UserDAO
+	identityDAO dao.IdentityDAO
+	tokens      *TokenIssuer
+	mfa         *TwoFactor
+	signer      *sign.Signer
+	cfg         OIDCConfig
+}
+
+func NewOIDCHandler(userDAO dao.UserDAO, identityDAO dao.IdentityDAO, tokens *TokenIssuer, mfa *TwoFactor, signer *sign.Signer, cfg OIDCConfig) *OIDCHandler {
+	return &OIDCHandler{userDAO: userDAO, identityDAO: identityDAO, tokens: tokens, mfa: mfa, signer: signer, cfg: cfg}
+}
+
+func (h *OIDCHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	og := server.Group("/user/oidc", mws...)
+	og.GET("/:provider/login", h.Login)
+	og.GET("/:provider/callback", h.Callback)
+}
+
+// Login 生成 state、nonce 和 PKCE verifier，签名后存到 cookie 中，再跳转到身份提供方
+func (h *OIDCHandler) Login(ctx *gin.Context) {
+	provider := ctx.Param("provider")
+	client, ok := h.cfg.Providers[provider]
+	if !ok {
+		fail(ctx, errs.OIDCUnknown)
+		return
+	}
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成第三方登录参数失败", zap.Error(err))
+		return
+	}
+	authURL, err := client.AuthCodeURL(ctx, req)
+	if err != nil {
+		fail(ctx, errs.ErrUnavailable.With(err))
+		zap.L().Error("获取身份提供方配置失败", zap.Error(err), zap.String("provider", provider))
+		return
+	}
+	value := h.signer.Sign(oidcPurpose(provider), strings.Join([]string{req.State, req.Nonce, req.Verifier}, "."), oidcStateTTL)
+	h.setStateCookie(ctx, value, int(oidcStateTTL.Seconds()))
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 校验 state，用授权码换取 id_token，登录成功后跳转回前端
+func (h *OIDCHandler) Callback(ctx *gin.Context) {
+	provider := ctx.Param("provider")
+	client, ok := h.cfg.Providers[provider]
+	if !ok {
+		fail(ctx, errs.OIDCUnknown)
+		return
+	}
+	if e := ctx.Query("error"); e != "" {
+		fail(ctx, errs.OIDCFailed)
+		zap.L().Info("身份提供方拒绝授权", zap.String("provider", provider), zap.String("error", e), zap.String("description", ctx.Query("error_description")))
+		return
+	}
+	req, err := h.authRequest(ctx, provider)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Info("第三方登录 state 无效", zap.Error(err), zap.String("provider", provider))
+		return
+	}
+	// state 只能用一次
+	h.setStateCookie(ctx, "", -1)
+
+	claims, err := client.Exchange(ctx, ctx.Query("code"), req)
+	if err != nil {
+		fail(ctx, errs.OIDCFailed.With(err))
+		zap.L().Warn("第三方登录换取 token 失败", zap.Error(err), zap.String("provider", provider))
+		return
+	}
+	usr, err := h.resolve(ctx, provider, claims)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Info("第三方登录关联用户失败", zap.Error(err), zap.String("provider", provider), zap.String("subject", claims.Subject))
+		return
+	}
+
+	// 开启了两步验证的账号同样需要验证码，mfa token 放在 fragment 中，不会发到服务器或出现在日志里
+	if usr.TOTPEnabled {
+		pending := h.mfa.pending(usr)
+		ctx.Redirect(http.StatusFound, h.cfg.AfterLogin+"#mfaToken="+url.QueryEscape(pending.MFAToken))
+		return
+	}
+	if err = h.tokens.IssueCookie(ctx, usr); err != nil {
+		fail(ctx, err)
+		zap.L().Error("用户登录生成token失败", zap.Error(err))
+		return
+	}
+	zap.L().Info("第三方登录", zap.Uint("user_id", usr.ID), zap.String("provider", provider))
+	ctx.Redirect(http.StatusFound, h.cfg.AfterLogin)
+}
+
+// authRequest 从 cookie 中取回跳转前生成的参数，并与回调中的 state 比较
+func (h *OIDCHandler) authRequest(ctx *gin.Context, provider string) (oidc.AuthRequest, error) {
+	value, err := ctx.Cookie(oidcStateCookie)
+	if err != nil {
+		return oidc.AuthRequest{}, errs.OIDCStateInvalid.With(err)
+	}
+	subject, err := h.signer.Verify(oidcPurpose(provider), value)
+	if err != nil {
+		return oidc.AuthRequest{}, errs.OIDCStateInvalid.With(err)
+	}
+	parts := strings.Split(subject, ".")
+	if len(parts) != 3 {
+		return oidc.AuthRequest{}, errs.OIDCStateInvalid
+	}
+	req := oidc.AuthRequest{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+	if subtle.ConstantTimeCompare([]byte(req.State), []byte(ctx.Query("state"))) != 1 {
+		return oidc.AuthRequest{}, errs.OIDCStateInvalid
+	}
+	return req, nil
+}
+
+// resolve 已关联过的直接登录；否则按已验证的邮箱关联到已有用户，没有时注册新用户
+func (h *OIDCHandler) resolve(ctx context.Context, provider string, claims oidc.Claims) (dao.User, error) {
+	ident, err := h.identityDAO.Find(ctx, provider, claims.Subject)
+	if err == nil {
+		return h.userDAO.FindById(ctx, ident.UserID)
+	}
+	if !errors.Is(err, errs.ErrNotFound) {
+		return dao.User{}, err
+	}
+	// 未验证的邮箱可能是别人的，不能用来关联账号
+	if claims.Email == "" || !claims.EmailVerified {
+		return dao.User{}, errs.OIDCEmailInvalid
+	}
+	usr, err := h.userDAO.FindByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// 本站未验证的邮箱可能是别人抢注的，关联后抢注的人仍能用密码登录
+		if !usr.EmailVerified {
+			return dao.User{}, errs.OIDCEmailConflict
+		}
+	case errors.Is(err, errs.ErrNotFound):
+		if usr, err = h.signUp(ctx, claims); err != nil {
+			return dao.User{}, err
+		}
+	default:
+		return dao.User{}, err
+	}
+	err = h.identityDAO.Create(ctx, dao.Identity{
+		UserID:   int64(usr.ID),
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return dao.User{}, err
+	}
+	zap.L().Info("关联第三方账号", zap.Uint("user_id", usr.ID), zap.String("provider", provider))
+	return usr, nil
+}
+
+// signUp 注册没有密码的用户，之后可以通过忘记密码设置密码
+func (h *OIDCHandler) signUp(ctx context.Context, claims oidc.Claims) (dao.User, error) {
+	base := oidcUsername(claims)
+	name := base
+	for i := 0; ; i++ {
+		userId, err := h.userDAO.CreateUser(ctx, dao.User{
+			Username:      name,
+			Email:         claims.Email,
+			EmailVerified: true,
+			DisplayName:   truncate(claims.Name, 64),
+		})
+		if err == nil {
+			return h.userDAO.FindById(ctx, userId)
+		}
+		if !errors.Is(err, errs.ErrConflict) || i >= 5 {
+			return dao.User{}, err
+		}
+		// 用户名被占用时加随机后缀重试
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return dao.User{}, err
+		}
+		name = fmt.Sprintf("%s-%04d", truncate(base, 27), n.Int64())
+	}
+}
+
+var usernameIllegal = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// oidcUsername 优先用 preferred_username，其次是邮箱的用户名部分，去掉用户名中不允许的字符
+func oidcUsername(claims oidc.Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	name = truncate(usernameIllegal.ReplaceAllString(name, "_"), 32)
+	if utf8.RuneCountInString(name) < 3 {
+		name = "user_" + name
+	}
+	return name
+}
+
+// oidcPurpose 不同身份提供方的 state 不能互相使用
+func oidcPurpose(provider string) string {
+	return "oidc-state:" + provider
+}
+
+func (h *OIDCHandler) setStateCookie(ctx *gin.Context, value string, maxAge int) {
+	// 回调是从身份提供方跳转回来的顶级导航，SameSite=Lax 时会带上 cookie
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/user/oidc/",
+		MaxAge:   maxAge,
+		Secure:   h.cfg.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
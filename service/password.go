@@ -0,0 +1,241 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/mailer"
+	"blog/validate"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 后台发送重置密码邮件的超时时间
+const resetSendTimeout = 30 * time.Second
+
+// PasswordResetter 生成一次性的重置密码 token 并通过邮件发送，库里只保存 token 的哈希
+type PasswordResetter struct {
+	dao      dao.PasswordResetDAO
+	mailer   mailer.Mailer
+	resetURL string
+	ttl      time.Duration
+}
+
+// NewPasswordResetter resetURL 为前端重置密码页面的地址，如 https://blog.example.com/password/reset，
+// token 作为查询参数附加在后面，页面拿到后调用 POST /user/password/reset
+func NewPasswordResetter(dao dao.PasswordResetDAO, m mailer.Mailer, resetURL string, ttl time.Duration) *PasswordResetter {
+	return &PasswordResetter{dao: dao, mailer: m, resetURL: resetURL, ttl: ttl}
+}
+
+func (r *PasswordResetter) Send(ctx context.Context, user dao.User) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	err := r.dao.Create(ctx, dao.PasswordReset{
+		UserID:    int64(user.ID),
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(r.ttl).UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	sep := "?"
+	if strings.Contains(r.resetURL, "?") {
+		sep = "&"
+	}
+	link := r.resetURL + sep + "token=" + url.QueryEscape(token)
+	return r.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %d 分钟内点击下面的链接重置密码，链接只能使用一次：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件，你的密码不会被修改。\n",
+			user.Username, int(r.ttl.Minutes()), link),
+	})
+}
+
+// Consume 校验并用掉 token，返回对应的用户ID
+func (r *PasswordResetter) Consume(ctx context.Context, token string) (int64, error) {
+	reset, err := r.dao.Consume(ctx, hashResetToken(token))
+	if err != nil {
+		return 0, err
+	}
+	return reset.UserID, nil
+}
+
+// Invalidate 密码修改后作废其他还没用过的 token
+func (r *PasswordResetter) Invalidate(ctx context.Context, userId int64) error {
+	return r.dao.InvalidateUser(ctx, userId)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPassword 校验敏感操作前重新输入的密码，不匹配时返回 mismatch。
+// 第三方登录注册的账号没有密码，要先通过忘记密码设置一个
+func checkPassword(usr dao.User, password string, mismatch *errs.Error) error {
+	if usr.Password == "" {
+		return errs.PasswordNotSet
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(usr.Password), []byte(password)); err != nil {
+		return mismatch
+	}
+	return nil
+}
+
+// CheckTokenVersion 拒绝修改密码之前签发的 token
+func CheckTokenVersion(userDAO dao.UserDAO) func(ctx *gin.Context, claims jwt.MapClaims) bool {
+	return func(ctx *gin.Context, claims jwt.MapClaims) bool {
+		userId, ok := claims["id"].(float64)
+		if !ok {
+			return false
+		}
+		// 旧版本签发的 token 没有 tv，视为 0
+		tv, _ := claims["tv"].(float64)
+		usr, err := userDAO.FindById(ctx, int64(userId))
+		if err != nil {
+			zap.L().Info("token 对应的用户不存在", zap.Error(err), zap.Int64("user_id", int64(userId)))
+			return false
+		}
+		return int64(tv) == usr.TokenVersion
+	}
+}
+
+// ForgotPassword 无论邮箱是否注册都返回成功，避免被用来探测邮箱
+func (u *UserHandler) ForgotPassword(ctx *gin.Context) {
+	type ForgotReq struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	var req ForgotReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("忘记密码参数绑定错误", zap.Error(err))
+		return
+	}
+	usr, err := u.dao.FindByEmail(ctx, req.Email)
+	if err == nil {
+		// 写库和发邮件放到后台，已注册和未注册的邮箱响应时间一致
+		go func() {
+			sendCtx, cancel := context.WithTimeout(context.Background(), resetSendTimeout)
+			defer cancel()
+			if err := u.resetter.Send(sendCtx, usr); err != nil {
+				zap.L().Error("发送重置密码邮件失败", zap.Error(err), zap.Uint("user_id", usr.ID))
+			}
+		}()
+	}
+	success(ctx, msgResetSent, nil)
+}
+
+// ResetPassword 用邮件中的 token 设置新密码
+func (u *UserHandler) ResetPassword(ctx *gin.Context) {
+	type ResetReq struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,password"`
+	}
+	var req ResetReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("重置密码参数绑定错误", zap.Error(err))
+		return
+	}
+	userId, err := u.resetter.Consume(ctx, req.Token)
+	if err != nil {
+		// token 无效时为 errs.ResetTokenInvalid
+		fail(ctx, err)
+		zap.L().Info("校验重置密码 token 失败", zap.Error(err))
+		return
+	}
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if err = u.updatePassword(ctx, userId, req.Password); err != nil {
+		fail(ctx, err)
+		zap.L().Error("重置密码失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	// 能收到邮件说明是本人，顺便解除登录锁定
+	if err = u.guard.Unlock(ctx, usr.Username); err != nil {
+		zap.L().Error("解除登录锁定失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	success(ctx, msgPasswordReset, nil)
+}
+
+// ChangePassword 已登录用户修改密码，需要提供旧密码
+func (u *UserHandler) ChangePassword(ctx *gin.Context) {
+	type ChangeReq struct {
+		OldPassword string `json:"oldPassword" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required,password"`
+	}
+	var req ChangeReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("修改密码参数绑定错误", zap.Error(err))
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if err = checkPassword(usr, req.OldPassword, errs.WrongPassword); err != nil {
+		fail(ctx, err)
+		return
+	}
+	if err = u.updatePassword(ctx, userId, req.NewPassword); err != nil {
+		fail(ctx, err)
+		zap.L().Error("修改密码失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+
+	// 其他设备上的登录全部失效，当前设备换发新 token
+	usr, err = u.dao.FindById(ctx, userId)
+	if err == nil {
+		err = u.tokens.Issue(ctx, usr)
+	}
+	if err != nil {
+		zap.L().Error("修改密码后换发token失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	success(ctx, msgPasswordChanged, nil)
+}
+
+// updatePassword 更新密码会递增 TokenVersion，使已签发的 token 全部失效，其他设备上的会话同时吊销。
+// 个人访问令牌不带 TokenVersion，需要单独吊销，否则泄露的密码被重置后令牌仍然可用
+func (u *UserHandler) updatePassword(ctx *gin.Context, userId int64, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err = u.dao.UpdatePassword(ctx, userId, string(hashedPassword)); err != nil {
+		return err
+	}
+	if err = u.tokens.EndOtherSessions(ctx, userId); err != nil {
+		return err
+	}
+	if err = u.accessTokens.RevokeAll(ctx, userId); err != nil {
+		return err
+	}
+	return u.resetter.Invalidate(ctx, userId)
+}
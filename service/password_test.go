@@ -0,0 +1,242 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/guard"
+	"blog/mailer"
+	"blog/middleware"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakePasswordResetDAO 按哈希保存 token，过期和已使用的判断与数据库的条件更新一致
+type fakePasswordResetDAO struct {
+	mu     sync.Mutex
+	resets map[string]dao.PasswordReset
+}
+
+func newFakePasswordResetDAO() *fakePasswordResetDAO {
+	return &fakePasswordResetDAO{resets: map[string]dao.PasswordReset{}}
+}
+
+func (f *fakePasswordResetDAO) Create(ctx context.Context, r dao.PasswordReset) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resets[r.TokenHash] = r
+	return nil
+}
+
+func (f *fakePasswordResetDAO) Consume(ctx context.Context, tokenHash string) (dao.PasswordReset, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, ok := f.resets[tokenHash]
+	now := time.Now().UnixMilli()
+	if !ok || r.UsedAt != 0 || r.ExpiresAt <= now {
+		return dao.PasswordReset{}, errs.ResetTokenInvalid
+	}
+	r.UsedAt = now
+	f.resets[tokenHash] = r
+	return r, nil
+}
+
+func (f *fakePasswordResetDAO) InvalidateUser(ctx context.Context, userId int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, r := range f.resets {
+		if r.UserID == userId && r.UsedAt == 0 {
+			r.UsedAt = time.Now().UnixMilli()
+			f.resets[k] = r
+		}
+	}
+	return nil
+}
+
+// fakeMailer 把邮件放进 channel，方便等待后台发送
+type fakeMailer struct {
+	sent chan mailer.Message
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{sent: make(chan mailer.Message, 10)}
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// resetToken 从邮件正文的链接里取出 token
+func resetToken(t *testing.T, msg mailer.Message) string {
+	const prefix = "https://blog.example.com/password/reset?token="
+	i := strings.Index(msg.Body, prefix)
+	require.GreaterOrEqual(t, i, 0, msg.Body)
+	token, _, _ := strings.Cut(msg.Body[i+len(prefix):], "\n")
+	return token
+}
+
+func TestPasswordResetter(t *testing.T) {
+	user := dao.User{Model: gorm.Model{ID: 1}, Username: "alice", Email: "alice@example.com"}
+	testCases := []struct {
+		name string
+		ttl  time.Duration
+		// before 在使用 token 之前执行
+		before  func(t *testing.T, r *PasswordResetter, token string)
+		token   func(token string) string
+		wantErr error
+	}{
+		{name: "正常使用", ttl: time.Minute},
+		{
+			name: "只能用一次",
+			ttl:  time.Minute,
+			before: func(t *testing.T, r *PasswordResetter, token string) {
+				_, err := r.Consume(context.Background(), token)
+				require.NoError(t, err)
+			},
+			wantErr: errs.ResetTokenInvalid,
+		},
+		{name: "已过期", ttl: -time.Second, wantErr: errs.ResetTokenInvalid},
+		{
+			name:    "token 错误",
+			ttl:     time.Minute,
+			token:   func(token string) string { return token + "x" },
+			wantErr: errs.ResetTokenInvalid,
+		},
+		{
+			name: "修改密码后作废",
+			ttl:  time.Minute,
+			before: func(t *testing.T, r *PasswordResetter, token string) {
+				require.NoError(t, r.Invalidate(context.Background(), 1))
+			},
+			wantErr: errs.ResetTokenInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resets, m := newFakePasswordResetDAO(), newFakeMailer()
+			r := NewPasswordResetter(resets, m, "https://blog.example.com/password/reset", tc.ttl)
+			require.NoError(t, r.Send(context.Background(), user))
+			msg := <-m.sent
+			assert.Equal(t, []string{user.Email}, msg.To)
+			token := resetToken(t, msg)
+			// 库里只有哈希
+			assert.NotContains(t, resets.resets, token)
+
+			if tc.before != nil {
+				tc.before(t, r, token)
+			}
+			if tc.token != nil {
+				token = tc.token(token)
+			}
+			userId, err := r.Consume(context.Background(), token)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), userId)
+		})
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	testCases := []struct {
+		name     string
+		email    string
+		wantMail bool
+	}{
+		{name: "已注册邮箱", email: "alice@example.com", wantMail: true},
+		{name: "未注册邮箱同样返回成功", email: "nobody@example.com"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resets, m := newFakePasswordResetDAO(), newFakeMailer()
+			h := &UserHandler{
+				dao:      newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", Email: "alice@example.com"}),
+				resetter: NewPasswordResetter(resets, m, "https://blog.example.com/password/reset", time.Minute),
+			}
+			server := newTestServer()
+			server.POST("/user/password/forgot", h.ForgotPassword)
+
+			recorder := doRequest(server, http.MethodPost, "/user/password/forgot", `{"email":"`+tc.email+`"}`)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			if !tc.wantMail {
+				select {
+				case msg := <-m.sent:
+					t.Fatalf("不应发送邮件：%v", msg.To)
+				case <-time.After(50 * time.Millisecond):
+				}
+				assert.Empty(t, resets.resets)
+				return
+			}
+			select {
+			case msg := <-m.sent:
+				assert.Equal(t, []string{tc.email}, msg.To)
+			case <-time.After(time.Second):
+				t.Fatal("没有在后台发送重置密码邮件")
+			}
+		})
+	}
+}
+
+func TestCheckTokenVersion(t *testing.T) {
+	users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", TokenVersion: 2})
+	check := CheckTokenVersion(users)
+	testCases := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{name: "版本一致", claims: jwt.MapClaims{"id": float64(1), "tv": float64(2)}, want: true},
+		{name: "修改密码前签发", claims: jwt.MapClaims{"id": float64(1), "tv": float64(1)}},
+		{name: "旧版本 token 没有 tv", claims: jwt.MapClaims{"id": float64(1)}},
+		{name: "用户不存在", claims: jwt.MapClaims{"id": float64(2), "tv": float64(0)}},
+		{name: "没有用户ID", claims: jwt.MapClaims{"tv": float64(2)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(nil)
+			assert.Equal(t, tc.want, check(ctx, tc.claims))
+		})
+	}
+}
+
+// 个人访问令牌不受 TokenVersion 约束，重置密码后必须被吊销
+func TestResetPasswordRevokesAccessTokens(t *testing.T) {
+	const pat = AccessTokenPrefix + "secret"
+	users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice"})
+	accessTokens := &fakeAccessTokenDAO{tokens: []dao.AccessToken{
+		{ID: 1, UserID: 1, TokenHash: hashAccessToken(pat), Scopes: ScopeRead, ExpiresAt: time.Now().Add(time.Hour).UnixMilli()},
+	}}
+	resets := newFakePasswordResetDAO()
+	require.NoError(t, resets.Create(context.Background(), dao.PasswordReset{
+		UserID: 1, TokenHash: hashResetToken("reset-token"), ExpiresAt: time.Now().Add(time.Minute).UnixMilli(),
+	}))
+	h := NewUserHandler(users, guard.NewLoginGuard(guard.NewMemoryStore(), guard.Policy{}, guard.Policy{}), nil,
+		NewPasswordResetter(resets, newFakeMailer(), "https://blog.example.com/password/reset", time.Minute),
+		NewTokenIssuer(nil, &fakeSessionDAO{}, middleware.DefaultTokenCookie, time.Hour), accessTokens, nil)
+	server := newTestServer()
+	server.POST("/user/password/reset", h.ResetPassword)
+	authenticate := AccessTokenAuthenticator(accessTokens, users)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, err := authenticate(ctx, pat)
+	require.NoError(t, err)
+
+	recorder := doRequest(server, http.MethodPost, "/user/password/reset", `{"token":"reset-token","password":"N3w-passw0rd!"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	_, err = authenticate(ctx, pat)
+	assert.ErrorIs(t, err, errAccessTokenInvalid)
+}
@@ -2,109 +2,114 @@ package service
 
 import (
 	"blog/dao"
-	"blog/domain"
+	"blog/errs"
+	"blog/filter"
+	"blog/mention"
+	"blog/validate"
+	"context"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"net/http"
 	"strconv"
+	"strings"
 )
 
 type PostHandler struct {
-	dao     dao.PostDAO
-	userDao dao.UserDAO
+	dao      dao.PostDAO
+	userDao  dao.UserDAO
+	tagDao   dao.TagDAO
+	mentions mentionRecorder
+	views    postViews
+	filter   filter.Filter
 }
 
 type PostVO struct {
 	Id      int64  `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
-	Author  string `json:"author"`
-	Ctime   int64  `json:"ctime"`
-	Utime   int64  `json:"utime"`
+	// 提及已替换为链接的内容
+	Rendered string   `json:"rendered"`
+	Author   AuthorVO `json:"author"`
+	Tags     []string `json:"tags"`
+	Ctime    int64    `json:"ctime"`
+	Utime    int64    `json:"utime"`
 }
 
-func NewPostHandler(dao dao.PostDAO, userDao dao.UserDAO) *PostHandler {
-	return &PostHandler{dao: dao, userDao: userDao}
+func NewPostHandler(dao dao.PostDAO, userDao dao.UserDAO, mentionDao dao.MentionDAO, tagDao dao.TagDAO, contentFilter filter.Filter) *PostHandler {
+	mentions := mentionRecorder{userDAO: userDao, mentionDAO: mentionDao}
+	return &PostHandler{
+		dao:      dao,
+		userDao:  userDao,
+		tagDao:   tagDao,
+		mentions: mentions,
+		views:    postViews{userDAO: userDao, tagDAO: tagDao, mentions: mentions},
+		filter:   contentFilter,
+	}
 }
 
-func (p *PostHandler) RegisterRoutes(server *gin.Engine) {
-	pg := server.Group("/posts")
-	pg.POST("/edit", p.Edit)
-	pg.DELETE("/delete/:id", p.Delete)
+func (p *PostHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	pg := server.Group("/posts", mws...)
+	pg.POST("/edit", requireScope(ScopePostsWrite), requireVerifiedEmail(p.userDao), p.Edit)
+	pg.DELETE("/delete/:id", requireScope(ScopePostsWrite), p.Delete)
 	pg.GET("/detail/:id", p.Detail)
 	pg.POST("/list", p.List)
+	pg.POST("/moderation", requireLogin, p.SetModeration)
 }
 
 func (p *PostHandler) Edit(ctx *gin.Context) {
 	type Req struct {
-		Id      int64  `json:"id"`
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		Id      int64  `json:"id" binding:"min=0"`
+		Title   string `json:"title" binding:"notblank,max=200"`
+		Content string `json:"content" binding:"notblank,max=100000"`
+		// 整体替换文章的标签，不传时保持原来的标签，传空数组时清空
+		Tags *[]string `json:"tags" binding:"omitempty,max=10,dive,notblank,max=32"`
 	}
 	var req Req
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("文章参数绑定错误", zap.Error(err))
 		return
 	}
 
-	userIdInterface, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 401,
-			Msg:  "用户未登录",
-		})
-		return
-	}
-
-	userIdFloat, ok := userIdInterface.(float64)
-	if !ok {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户ID错误",
-		})
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
 		return
 	}
-	userId := int64(userIdFloat)
 
+	// 先确认有修改权限，再检查内容，别人的文章不会经过过滤器
 	if req.Id > 0 {
 		post, err := p.dao.FindById(ctx, req.Id)
 		if err != nil {
-			ctx.JSON(http.StatusOK, domain.Result{
-				Code: 400,
-				Msg:  "文章不存在",
-			})
+			fail(ctx, notFound(err, errs.PostNotFound))
 			zap.L().Error("文章不存在", zap.Error(err), zap.Int64("post_id", req.Id))
 			return
 		}
 		if post.Author != userId {
-			ctx.JSON(http.StatusOK, domain.Result{
-				Code: 400,
-				Msg:  "没有修改权限",
-			})
+			fail(ctx, errs.PostForbidden)
 			zap.L().Error("没有修改权限", zap.Int64("post_id", req.Id), zap.Int64("user_id", userId))
 			return
 		}
+	}
+	if !p.checkContent(ctx, userId, req.Id, req.Title, req.Content) {
+		return
+	}
+
+	if req.Id > 0 {
 		err = p.dao.UpdateById(ctx, dao.Post{
 			ID:      req.Id,
 			Title:   req.Title,
 			Content: req.Content,
 		})
 		if err != nil {
-			ctx.JSON(http.StatusOK, domain.Result{
-				Code: 500,
-				Msg:  "文章更新失败",
-			})
+			fail(ctx, err)
 			zap.L().Error("文章更新失败", zap.Error(err), zap.Int64("post_id", req.Id))
 			return
 		}
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 200,
-			Msg:  "文章更新成功",
-		})
+		p.mentions.record(ctx, dao.MentionSourcePost, req.Id, req.Id, userId, req.Content)
+		if req.Tags != nil {
+			p.saveTags(ctx, req.Id, *req.Tags)
+		}
+		success(ctx, msgPostUpdated, nil)
 		return
 	}
 
@@ -114,127 +119,96 @@ func (p *PostHandler) Edit(ctx *gin.Context) {
 		Author:  userId,
 	})
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "文章创建失败",
-		})
+		fail(ctx, err)
 		zap.L().Error("文章创建失败", zap.Error(err))
 		return
 	}
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "文章创建成功",
-		Data: id,
+	p.mentions.record(ctx, dao.MentionSourcePost, id, id, userId, req.Content)
+	if req.Tags != nil {
+		p.saveTags(ctx, id, *req.Tags)
+	}
+	success(ctx, msgPostCreated, id)
+}
+
+// checkContent 内容过滤，被拒绝时写入错误并返回 false。文章没有审核队列，转人工审核的内容照常发布，只记录日志
+func (p *PostHandler) checkContent(ctx *gin.Context, userId int64, postId int64, title string, content string) bool {
+	decision, err := p.filter.Check(ctx, filter.Content{
+		Kind:   filter.KindPost,
+		UserID: userId,
+		PostID: postId,
+		Update: postId > 0,
+		Title:  title,
+		Body:   content,
 	})
+	if err != nil {
+		zap.L().Error("文章内容过滤失败", zap.Error(err))
+	}
+	switch decision.Verdict {
+	case filter.Reject:
+		fail(ctx, errs.PostRejected.WithArgs(decision.Message()))
+		zap.L().Info("文章被内容过滤拒绝", zap.String("filter", decision.Filter), zap.Stringer("reason", decision.Message()), zap.Int64("user_id", userId))
+		return false
+	case filter.Hold:
+		zap.L().Warn("文章内容需要人工复查", zap.String("filter", decision.Filter), zap.Stringer("reason", decision.Message()),
+			zap.Int64("user_id", userId), zap.Int64("post_id", postId))
+	}
+	return true
 }
 
 func (p *PostHandler) Delete(ctx *gin.Context) {
 	idstr := ctx.Param("id")
 	id, err := strconv.ParseInt(idstr, 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.With(err))
 		zap.L().Error("参数错误", zap.Error(err), zap.String("param", idstr))
 		return
 	}
 	//获取用户ID
-	userIdInterface, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 401,
-			Msg:  "用户未登录",
-		})
-		return
-	}
-	userIdFloat, ok := userIdInterface.(float64)
-	if !ok {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户ID错误",
-		})
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
 		return
 	}
-	userId := int64(userIdFloat)
 
 	post, err := p.dao.FindById(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "文章不存在",
-		})
+		fail(ctx, notFound(err, errs.PostNotFound))
 		zap.L().Error("删除文章不存在", zap.Error(err), zap.Int64("post_id", id))
 		return
 	}
 	if post.Author != userId {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "没有删除权限",
-		})
+		fail(ctx, errs.PostForbidden)
 		zap.L().Error("没有删除权限", zap.Int64("post_id", id), zap.Int64("user_id", userId))
 		return
 	}
 
 	err = p.dao.DeleteById(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "删除文章失败",
-		})
+		fail(ctx, err)
 		zap.L().Error("删除文章失败", zap.Error(err), zap.Int64("post_id", id))
 		return
 	}
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "删除文章成功",
-	})
+	p.mentions.record(ctx, dao.MentionSourcePost, id, id, userId, "")
+	p.saveTags(ctx, id, nil)
+	success(ctx, msgPostDeleted, nil)
 }
 
 func (p *PostHandler) Detail(ctx *gin.Context) {
 	idstr := ctx.Param("id")
 	id, err := strconv.ParseInt(idstr, 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.With(err))
 		zap.L().Error("参数错误", zap.Error(err), zap.String("param", idstr))
 		return
 	}
 	postList, err := p.dao.FindById(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "查询文章详情不存在",
-		})
+		fail(ctx, notFound(err, errs.PostNotFound))
 		zap.L().Error("查询文章详情不存在", zap.Error(err), zap.Int64("post_id", id))
 		return
 	}
 
-	usr, err := p.userDao.FindById(ctx, postList.Author)
-	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "查询文章作者失败",
-		})
-		zap.L().Error("查询文章作者失败", zap.Error(err), zap.Int64("user_id", postList.Author))
-		return
-	}
-
-	res := PostVO{
-		Id:      postList.ID,
-		Title:   postList.Title,
-		Content: postList.Content,
-		Author:  usr.Username,
-		Ctime:   postList.Ctime,
-		Utime:   postList.Utime,
-	}
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "查询文章详情成功",
-		Data: res,
-	})
+	success(ctx, msgPostDetail, p.toVOs(ctx, []dao.Post{postList})[0])
 }
 
 func (p *PostHandler) List(ctx *gin.Context) {
@@ -244,62 +218,141 @@ func (p *PostHandler) List(ctx *gin.Context) {
 	}
 	var req ListReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("获取文章列表参数绑定错误", zap.Error(err))
 		return
 	}
 
-	userIdInterface, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 401,
-			Msg:  "用户未登录",
-		})
+	// 文章列表允许匿名访问
+	res, err := p.dao.List(ctx, readerId(ctx), req.Offest, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("获取文章列表失败", zap.Error(err))
 		return
 	}
+	success(ctx, msgPostList, p.toVOs(ctx, res))
+}
 
-	userIdFloat, ok := userIdInterface.(float64)
-	userId := int64(userIdFloat)
-	if !ok {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户ID错误",
-		})
+// SetModeration 设置文章的评论审核模式，文章作者和审核员可操作
+func (p *PostHandler) SetModeration(ctx *gin.Context) {
+	type Req struct {
+		PostID int64 `json:"postId"`
+		Mode   uint8 `json:"mode"`
+	}
+	var req Req
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("审核模式参数绑定错误", zap.Error(err))
+		return
+	}
+	if req.Mode > dao.ModerationHoldAll {
+		fail(ctx, errs.ModerationMode)
 		return
 	}
 
-	res, err := p.dao.List(ctx, userId, req.Offest, req.Limit)
+	userId, err := currentUserId(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "获取文章列表失败",
-		})
-		zap.L().Error("获取文章列表失败", zap.Error(err))
+		fail(ctx, err)
+		return
+	}
+
+	post, err := p.dao.FindById(ctx, req.PostID)
+	if err != nil {
+		fail(ctx, notFound(err, errs.PostNotFound))
+		zap.L().Error("文章不存在", zap.Error(err), zap.Int64("post_id", req.PostID))
+		return
+	}
+	if post.Author != userId {
+		usr, err := p.userDao.FindById(ctx, userId)
+		if err != nil || !usr.IsModerator() {
+			fail(ctx, errs.PostForbidden)
+			zap.L().Error("没有修改审核模式权限", zap.Int64("post_id", req.PostID), zap.Int64("user_id", userId))
+			return
+		}
+	}
+
+	err = p.dao.UpdateModeration(ctx, req.PostID, req.Mode)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("修改审核模式失败", zap.Error(err), zap.Int64("post_id", req.PostID))
 		return
 	}
-	var voList []PostVO
-	for _, post := range res {
-		usr, err := p.userDao.FindById(ctx, post.Author)
-		authorName := ""
-		if err == nil {
-			authorName = usr.Username
+	success(ctx, msgModerationUpdated, nil)
+}
+
+func (p *PostHandler) toVOs(ctx context.Context, posts []dao.Post) []PostVO {
+	return p.views.build(ctx, posts)
+}
+
+// saveTags 标签保存失败不影响文章本身
+func (p *PostHandler) saveTags(ctx context.Context, postId int64, tags []string) {
+	if err := p.tagDao.Replace(ctx, postId, normalizeTags(tags)); err != nil {
+		zap.L().Error("保存文章标签失败", zap.Error(err), zap.Int64("post_id", postId))
+	}
+}
+
+// normalizeTags 去掉首尾空白和开头的 #，统一小写并去重
+func normalizeTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(tag), "#")))
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
 		}
+		seen[tag] = struct{}{}
+		res = append(res, tag)
+	}
+	return res
+}
+
+// postViews 组装文章的展示数据，文章接口、资料页和订阅源共用
+type postViews struct {
+	userDAO  dao.UserDAO
+	tagDAO   dao.TagDAO
+	mentions mentionRecorder
+}
+
+// build 批量查询作者、标签和提及，组装文章列表
+func (v postViews) build(ctx context.Context, posts []dao.Post) []PostVO {
+	ids := make([]int64, 0, len(posts))
+	authorIds := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+		authorIds = append(authorIds, post.Author)
+	}
+	known := v.mentions.known(ctx, dao.MentionSourcePost, ids)
+	authors := loadAuthors(ctx, v.userDAO, authorIds)
+	tags := v.tags(ctx, ids)
+	voList := make([]PostVO, 0, len(posts))
+	for _, post := range posts {
 		voList = append(voList, PostVO{
-			Id:      post.ID,
-			Title:   post.Title,
-			Content: post.Content,
-			Author:  authorName,
-			Ctime:   post.Ctime,
-			Utime:   post.Utime,
+			Id:       post.ID,
+			Title:    post.Title,
+			Content:  post.Content,
+			Rendered: mention.Render(post.Content, known[post.ID]),
+			Author:   authors[post.Author],
+			Tags:     tags[post.ID],
+			Ctime:    post.Ctime,
+			Utime:    post.Utime,
 		})
 	}
+	return voList
+}
 
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "获取文章列表成功",
-		Data: voList,
-	})
+// tags 文章ID -> 标签，没有标签的文章返回空数组而不是 null
+func (v postViews) tags(ctx context.Context, postIds []int64) map[int64][]string {
+	res := make(map[int64][]string, len(postIds))
+	for _, id := range postIds {
+		res[id] = []string{}
+	}
+	rows, err := v.tagDAO.FindByPosts(ctx, postIds)
+	if err != nil {
+		zap.L().Error("查询文章标签失败", zap.Error(err))
+		return res
+	}
+	for _, row := range rows {
+		res[row.PostID] = append(res[row.PostID], row.Tag)
+	}
+	return res
 }
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/domain"
+	"blog/filter"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPostEditTags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		wantTags []string
+	}{
+		{name: "不传标签保持原样", body: `{"id":1,"title":"标题","content":"正文"}`, wantTags: []string{"go"}},
+		{name: "传空数组清空", body: `{"id":1,"title":"标题","content":"正文","tags":[]}`, wantTags: []string{}},
+		{name: "整体替换", body: `{"id":1,"title":"标题","content":"正文","tags":["#Web"," go "]}`, wantTags: []string{"web", "go"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", EmailVerified: true})
+			tags := newFakeTagDAO()
+			tags.tags[1] = []string{"go"}
+			h := NewPostHandler(newFakePostDAO(dao.Post{ID: 1, Title: "旧标题", Author: 1}), users, &fakeMentionDAO{}, tags, filter.NewChain())
+			server := newTestServer(fakeLogin(1))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/posts/edit", tc.body)
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			assert.Equal(t, tc.wantTags, tags.tags[1])
+		})
+	}
+}
+
+func TestPostEditFilterOrder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		userId   int64
+		body     string
+		wantCode int
+	}{
+		// 没有权限时不经过过滤器，也不会被记入重复检测
+		{name: "别人的文章先判断权限", userId: 2, body: `{"id":1,"title":"标题","content":"同样的正文内容"}`, wantCode: http.StatusForbidden},
+		{name: "原样保存不算重复", userId: 1, body: `{"id":1,"title":"标题","content":"同样的正文内容"}`, wantCode: http.StatusOK},
+	}
+	users := newFakeUserDAO(
+		dao.User{Model: gorm.Model{ID: 1}, Username: "alice", EmailVerified: true},
+		dao.User{Model: gorm.Model{ID: 2}, Username: "bob", EmailVerified: true},
+	)
+	h := NewPostHandler(newFakePostDAO(dao.Post{ID: 1, Title: "标题", Author: 1}), users, &fakeMentionDAO{}, newFakeTagDAO(),
+		filter.NewChain(filter.NewDuplicateFilter(time.Minute, 3)))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(fakeLogin(tc.userId))
+			h.RegisterRoutes(server)
+			for i := 0; i < 2; i++ {
+				recorder := doRequest(server, http.MethodPost, "/posts/edit", tc.body)
+				assert.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// 过滤器给出的原因按请求的语言翻译
+func TestPostRejectedReason(t *testing.T) {
+	testCases := []struct {
+		name    string
+		lang    string
+		wantMsg string
+	}{
+		{name: "中文", lang: "zh", wantMsg: "文章未通过内容检查：链接过多（2 个）"},
+		{name: "英文", lang: "en", wantMsg: "Post was rejected: too many links (2)"},
+	}
+	users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", EmailVerified: true})
+	h := NewPostHandler(newFakePostDAO(), users, &fakeMentionDAO{}, newFakeTagDAO(),
+		filter.NewChain(filter.LinkFilter{RejectAt: 2}))
+	server := newTestServer(fakeLogin(1))
+	h.RegisterRoutes(server)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newRequest(http.MethodPost, "/posts/edit", `{"title":"标题","content":"https://a.example.com https://b.example.com"}`)
+			req.Header.Set("Accept-Language", tc.lang)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+			var res domain.Result
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			assert.Equal(t, "post.rejected", res.Error)
+			assert.Equal(t, tc.wantMsg, res.Msg)
+		})
+	}
+}
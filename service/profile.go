@@ -0,0 +1,225 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/validate"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 公开资料页每页最多返回的文章数
+const profilePostLimit = 50
+
+// AuthorVO 文章和评论中展示的作者信息
+type AuthorVO struct {
+	Id          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+// PublicProfileVO 任何人都能看到的资料
+type PublicProfileVO struct {
+	AuthorVO
+	Bio     string `json:"bio"`
+	Website string `json:"website"`
+	// 注册时间，毫秒时间戳
+	Joined int64 `json:"joined"`
+}
+
+// ProfileVO 本人看到的资料，多了邮箱等私密信息
+type ProfileVO struct {
+	PublicProfileVO
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	Locale        string `json:"locale"`
+	// 是否开启了两步验证
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+	// 第三方登录注册的账号没有密码，注销账号等操作前要先通过忘记密码设置
+	HasPassword bool `json:"hasPassword"`
+	// 已申请注销时为到期删除的时间
+	DeletionScheduledAt int64 `json:"deletionScheduledAt,omitempty"`
+}
+
+type ProfileStatsVO struct {
+	Posts    int64 `json:"posts"`
+	Comments int64 `json:"comments"`
+}
+
+type ProfilePageVO struct {
+	Profile PublicProfileVO `json:"profile"`
+	Stats   ProfileStatsVO  `json:"stats"`
+	Posts   []PostVO        `json:"posts"`
+}
+
+func toAuthorVO(u dao.User) AuthorVO {
+	return AuthorVO{
+		Id:          int64(u.ID),
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Avatar:      u.Avatar,
+	}
+}
+
+func toPublicProfileVO(u dao.User) PublicProfileVO {
+	return PublicProfileVO{
+		AuthorVO: toAuthorVO(u),
+		Bio:      u.Bio,
+		Website:  u.Website,
+		Joined:   u.CreatedAt.UnixMilli(),
+	}
+}
+
+// loadAuthors 批量查询作者，查不到的作者只返回ID
+func loadAuthors(ctx context.Context, userDAO dao.UserDAO, ids []int64) map[int64]AuthorVO {
+	res := make(map[int64]AuthorVO, len(ids))
+	for _, id := range ids {
+		res[id] = AuthorVO{Id: id}
+	}
+	users, err := userDAO.FindByIds(ctx, ids)
+	if err != nil {
+		zap.L().Error("批量查询作者失败", zap.Error(err))
+		return res
+	}
+	for _, u := range users {
+		res[int64(u.ID)] = toAuthorVO(u)
+	}
+	return res
+}
+
+type ProfileHandler struct {
+	userDAO    dao.UserDAO
+	postDAO    dao.PostDAO
+	commentDAO dao.CommentDAO
+	views      postViews
+}
+
+func NewProfileHandler(userDAO dao.UserDAO, postDAO dao.PostDAO, commentDAO dao.CommentDAO, mentionDAO dao.MentionDAO,
+	tagDAO dao.TagDAO) *ProfileHandler {
+	return &ProfileHandler{
+		userDAO:    userDAO,
+		postDAO:    postDAO,
+		commentDAO: commentDAO,
+		views: postViews{
+			userDAO:  userDAO,
+			tagDAO:   tagDAO,
+			mentions: mentionRecorder{userDAO: userDAO, mentionDAO: mentionDAO},
+		},
+	}
+}
+
+func (h *ProfileHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	ug := server.Group("/user", mws...)
+	ug.GET("/profile", requireScope(ScopeRead), h.Profile)
+	ug.POST("/profile", requireLogin, h.UpdateProfile)
+	ug.GET("/profile/:username", h.PublicProfile)
+}
+
+// Profile 当前用户的资料
+func (h *ProfileHandler) Profile(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	usr, err := h.userDAO.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, notFound(err, errs.UserNotFound))
+		zap.L().Error("查询用户资料失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgProfile, ProfileVO{
+		PublicProfileVO:     toPublicProfileVO(usr),
+		Email:               usr.Email,
+		EmailVerified:       usr.EmailVerified,
+		Locale:              usr.Locale,
+		TwoFactorEnabled:    usr.TOTPEnabled,
+		HasPassword:         usr.Password != "",
+		DeletionScheduledAt: usr.DeletionScheduledAt,
+	})
+}
+
+// UpdateProfile 更新公开资料，只更新传了的字段，传空字符串清空该字段
+func (h *ProfileHandler) UpdateProfile(ctx *gin.Context) {
+	// omitzero 对指针同时跳过 nil 和空字符串，传空字符串可以清空网址
+	type ProfileReq struct {
+		DisplayName *string `json:"displayName" binding:"omitempty,max=64"`
+		Bio         *string `json:"bio" binding:"omitempty,max=500"`
+		Website     *string `json:"website" binding:"omitzero,http_url,max=255"`
+		Avatar      *string `json:"avatar" binding:"omitzero,http_url,max=255"`
+	}
+	var req ProfileReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("更新资料参数绑定错误", zap.Error(err))
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	err = h.userDAO.UpdateProfile(ctx, userId, dao.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		Website:     req.Website,
+		Avatar:      req.Avatar,
+	})
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("更新资料失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgProfileUpdated, nil)
+}
+
+// PublicProfile 公开资料页，包含统计和已发布的文章
+func (h *ProfileHandler) PublicProfile(ctx *gin.Context) {
+	type PageReq struct {
+		Offset int `form:"offset" binding:"min=0"`
+		Limit  int `form:"limit" binding:"min=0,max=50"`
+	}
+	var req PageReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("查询资料页参数绑定错误", zap.Error(err))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = profilePostLimit
+	}
+
+	username := ctx.Param("username")
+	usr, err := h.userDAO.FindByUsername(ctx, username)
+	if err != nil {
+		fail(ctx, notFound(err, errs.UserNotFound))
+		zap.L().Info("查询资料页用户不存在", zap.Error(err), zap.String("username", username))
+		return
+	}
+	userId := int64(usr.ID)
+
+	posts, err := h.postDAO.ListByAuthor(ctx, userId, req.Offset, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户文章失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	var stats ProfileStatsVO
+	stats.Posts, err = h.postDAO.CountByAuthor(ctx, userId)
+	if err != nil {
+		zap.L().Error("统计用户文章数失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	stats.Comments, err = h.commentDAO.CountByUser(ctx, userId, dao.CommentStatusApproved)
+	if err != nil {
+		zap.L().Error("统计用户评论数失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+
+	success(ctx, msgPublicProfile, ProfilePageVO{
+		Profile: toPublicProfileVO(usr),
+		Stats:   stats,
+		Posts:   h.views.build(ctx, posts),
+	})
+}
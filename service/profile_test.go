@@ -0,0 +1,154 @@
+package service
+
+import (
+	"blog/dao"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	alice := dao.User{Model: gorm.Model{ID: 1}, Username: "alice", DisplayName: "Alice", Bio: "你好",
+		Website: "https://alice.example", Avatar: "https://alice.example/a.png"}
+	testCases := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     dao.User
+	}{
+		{
+			name:     "只更新传了的字段",
+			body:     `{"bio":"新的简介"}`,
+			wantCode: http.StatusOK,
+			want: dao.User{DisplayName: "Alice", Bio: "新的简介",
+				Website: "https://alice.example", Avatar: "https://alice.example/a.png"},
+		},
+		{
+			name:     "空字符串清空字段",
+			body:     `{"website":"","displayName":"A"}`,
+			wantCode: http.StatusOK,
+			want:     dao.User{DisplayName: "A", Bio: "你好", Avatar: "https://alice.example/a.png"},
+		},
+		{
+			name:     "空请求不修改",
+			body:     `{}`,
+			wantCode: http.StatusOK,
+			want: dao.User{DisplayName: "Alice", Bio: "你好",
+				Website: "https://alice.example", Avatar: "https://alice.example/a.png"},
+		},
+		{
+			name:     "网址格式错误",
+			body:     `{"website":"alice"}`,
+			wantCode: http.StatusBadRequest,
+			want: dao.User{DisplayName: "Alice", Bio: "你好",
+				Website: "https://alice.example", Avatar: "https://alice.example/a.png"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newFakeUserDAO(alice)
+			h := NewProfileHandler(users, newFakePostDAO(), newFakeCommentDAO(), &fakeMentionDAO{}, newFakeTagDAO())
+			server := newTestServer(fakeLogin(1))
+			h.RegisterRoutes(server)
+
+			recorder := doRequest(server, http.MethodPost, "/user/profile", tc.body)
+			require.Equal(t, tc.wantCode, recorder.Code, recorder.Body.String())
+			got := users.users[1]
+			assert.Equal(t, tc.want.DisplayName, got.DisplayName)
+			assert.Equal(t, tc.want.Bio, got.Bio)
+			assert.Equal(t, tc.want.Website, got.Website)
+			assert.Equal(t, tc.want.Avatar, got.Avatar)
+		})
+	}
+}
+
+func TestPublicProfile(t *testing.T) {
+	joined := time.UnixMilli(1700000000000)
+	users := newFakeUserDAO(
+		dao.User{Model: gorm.Model{ID: 1, CreatedAt: joined}, Username: "alice", DisplayName: "Alice", Bio: "你好",
+			Email: "alice@example.com"},
+		dao.User{Model: gorm.Model{ID: 2}, Username: "bob"},
+	)
+	posts := newFakePostDAO(
+		dao.Post{ID: 1, Author: 1, Title: "第一篇", Ctime: 1},
+		dao.Post{ID: 2, Author: 1, Title: "第二篇", Ctime: 2},
+		dao.Post{ID: 3, Author: 2, Title: "bob 的文章", Ctime: 3},
+	)
+	comments := newFakeCommentDAO(
+		dao.Comment{ID: 1, UserID: 1, PostID: 3, Status: dao.CommentStatusApproved},
+		// 待审核的评论不计入
+		dao.Comment{ID: 2, UserID: 1, PostID: 3, Status: dao.CommentStatusPending},
+	)
+	h := NewProfileHandler(users, posts, comments, &fakeMentionDAO{}, newFakeTagDAO())
+	server := newTestServer(fakeLogin(0))
+	h.RegisterRoutes(server)
+
+	recorder := doRequest(server, http.MethodGet, "/user/profile/alice?limit=1", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var res struct {
+		Data ProfilePageVO `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, PublicProfileVO{
+		AuthorVO: AuthorVO{Id: 1, Username: "alice", DisplayName: "Alice"},
+		Bio:      "你好",
+		Joined:   joined.UnixMilli(),
+	}, res.Data.Profile)
+	// 公开资料页不返回邮箱
+	assert.NotContains(t, recorder.Body.String(), "alice@example.com")
+	assert.Equal(t, ProfileStatsVO{Posts: 2, Comments: 1}, res.Data.Stats)
+	require.Len(t, res.Data.Posts, 1)
+	assert.Equal(t, "第二篇", res.Data.Posts[0].Title)
+	assert.Equal(t, "alice", res.Data.Posts[0].Author.Username)
+
+	recorder = doRequest(server, http.MethodGet, "/user/profile/carol", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// failingUserDAO 批量查询用户总是失败
+type failingUserDAO struct {
+	dao.UserDAO
+}
+
+func (failingUserDAO) FindByIds(ctx context.Context, ids []int64) ([]dao.User, error) {
+	return nil, assert.AnError
+}
+
+func TestLoadAuthors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		userDAO dao.UserDAO
+		ids     []int64
+		want    map[int64]AuthorVO
+	}{
+		{
+			name:    "查到的作者",
+			userDAO: newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", DisplayName: "Alice"}),
+			ids:     []int64{1},
+			want:    map[int64]AuthorVO{1: {Id: 1, Username: "alice", DisplayName: "Alice"}},
+		},
+		{
+			name:    "查不到的作者只返回ID",
+			userDAO: newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice"}),
+			ids:     []int64{1, 2},
+			want:    map[int64]AuthorVO{1: {Id: 1, Username: "alice"}, 2: {Id: 2}},
+		},
+		{
+			name:    "查询失败",
+			userDAO: failingUserDAO{},
+			ids:     []int64{1},
+			want:    map[int64]AuthorVO{1: {Id: 1}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, loadAuthors(context.Background(), tc.userDAO, tc.ids))
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/validate"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DefaultReactionKeys 未配置时可用的表情回应
+var DefaultReactionKeys = []string{"thumbsup", "thumbsdown", "heart", "laugh", "tada", "confused", "eyes"}
+
+type ReactionVO struct {
+	Reaction string `json:"reaction"`
+	Count    int64  `json:"count"`
+	// 当前用户是否回应过
+	Reacted bool `json:"reacted"`
+}
+
+type ReactionUserVO struct {
+	Id       int64  `json:"id"`
+	Username string `json:"username"`
+	Ctime    int64  `json:"ctime"`
+}
+
+// React 添加或取消对评论的表情回应
+func (c *CommentHandler) React(ctx *gin.Context) {
+	type ReactReq struct {
+		CommentID int64  `json:"commentId"`
+		Reaction  string `json:"reaction"`
+	}
+	var req ReactReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("表情回应参数绑定错误", zap.Error(err))
+		return
+	}
+	if !c.allowedReaction(req.Reaction) {
+		fail(ctx, errs.ReactionNotAllowed)
+		return
+	}
+
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	comment, err := c.dao.FindById(ctx, req.CommentID)
+	if err == nil && comment.Status != dao.CommentStatusApproved {
+		err = errs.ErrNotFound
+	}
+	if err != nil {
+		fail(ctx, notFound(err, errs.CommentNotFound))
+		zap.L().Error("回应的评论不存在", zap.Error(err), zap.Int64("comment_id", req.CommentID))
+		return
+	}
+
+	added, err := c.reactionDAO.Toggle(ctx, req.CommentID, userId, req.Reaction)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("表情回应失败", zap.Error(err), zap.Int64("comment_id", req.CommentID))
+		return
+	}
+	success(ctx, msgReacted, added)
+}
+
+// ReactionUsers 查询用某个表情回应了评论的用户
+func (c *CommentHandler) ReactionUsers(ctx *gin.Context) {
+	type UsersReq struct {
+		CommentID int64  `json:"commentId"`
+		Reaction  string `json:"reaction"`
+		Offest    int    `json:"offset"`
+		Limit     int    `json:"limit"`
+	}
+	var req UsersReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("查询回应用户参数绑定错误", zap.Error(err))
+		return
+	}
+	if !c.allowedReaction(req.Reaction) {
+		fail(ctx, errs.ReactionNotAllowed)
+		return
+	}
+	reactions, err := c.reactionDAO.ListUsers(ctx, req.CommentID, req.Reaction, req.Offest, req.Limit)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询回应用户失败", zap.Error(err), zap.Int64("comment_id", req.CommentID))
+		return
+	}
+	voList := make([]ReactionUserVO, 0, len(reactions))
+	for _, r := range reactions {
+		usr, err := c.userDAO.FindById(ctx, r.UserID)
+		username := ""
+		if err == nil {
+			username = usr.Username
+		}
+		voList = append(voList, ReactionUserVO{
+			Id:       r.UserID,
+			Username: username,
+			Ctime:    r.Ctime,
+		})
+	}
+	success(ctx, msgReactionUsers, voList)
+}
+
+func (c *CommentHandler) allowedReaction(reaction string) bool {
+	for _, key := range c.reactionKeys {
+		if key == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// reactionSummaries 按配置的表情顺序汇总每条评论的回应数，viewer 为 0 时不标记是否回应过
+func (c *CommentHandler) reactionSummaries(ctx context.Context, commentIds []int64, viewer int64) map[int64][]ReactionVO {
+	res := make(map[int64][]ReactionVO, len(commentIds))
+	counts, err := c.reactionDAO.CountByComments(ctx, commentIds)
+	if err != nil {
+		zap.L().Error("统计表情回应失败", zap.Error(err))
+		return res
+	}
+	reacted := make(map[int64]map[string]bool)
+	if viewer > 0 {
+		mine, err := c.reactionDAO.FindByUser(ctx, commentIds, viewer)
+		if err != nil {
+			zap.L().Error("查询用户表情回应失败", zap.Error(err), zap.Int64("user_id", viewer))
+		}
+		for _, r := range mine {
+			if reacted[r.CommentID] == nil {
+				reacted[r.CommentID] = make(map[string]bool)
+			}
+			reacted[r.CommentID][r.Reaction] = true
+		}
+	}
+	byComment := make(map[int64]map[string]int64)
+	for _, cnt := range counts {
+		if byComment[cnt.CommentID] == nil {
+			byComment[cnt.CommentID] = make(map[string]int64)
+		}
+		byComment[cnt.CommentID][cnt.Reaction] = cnt.Count
+	}
+	for commentId, m := range byComment {
+		// 已从配置中移除的表情不再展示
+		for _, key := range c.reactionKeys {
+			if m[key] == 0 {
+				continue
+			}
+			res[commentId] = append(res[commentId], ReactionVO{
+				Reaction: key,
+				Count:    m[key],
+				Reacted:  reacted[commentId][key],
+			})
+		}
+	}
+	return res
+}
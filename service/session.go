@@ -0,0 +1,112 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// SessionHandler 查看在哪些设备上登录过，可以单独吊销某个会话
+type SessionHandler struct {
+	dao dao.SessionDAO
+}
+
+func NewSessionHandler(dao dao.SessionDAO) *SessionHandler {
+	return &SessionHandler{dao: dao}
+}
+
+type SessionVO struct {
+	Id         int64  `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	Ctime      int64  `json:"ctime"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	// Current 是否为发起请求的会话
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	sg := server.Group("/user/sessions", append(mws, requireLogin)...)
+	sg.POST("/list", h.List)
+	sg.DELETE("/:id", h.Revoke)
+}
+
+// CheckSession 拒绝已吊销或已过期会话的 token
+func CheckSession(sessions dao.SessionDAO) func(ctx *gin.Context, claims jwt.MapClaims) bool {
+	return func(ctx *gin.Context, claims jwt.MapClaims) bool {
+		sid, ok := claims[middleware.SessionKey].(string)
+		if !ok {
+			// 旧版本签发的 token 没有 sid，有效期内仍然可用
+			return true
+		}
+		userId, _ := claims["id"].(float64)
+		s, err := sessions.FindBySID(ctx, sid)
+		if err != nil {
+			zap.L().Info("token 对应的会话不存在", zap.Error(err), zap.Int64("user_id", int64(userId)))
+			return false
+		}
+		if s.UserID != int64(userId) || s.RevokedAt != 0 || s.ExpiresAt <= time.Now().UnixMilli() {
+			return false
+		}
+		if err = sessions.Touch(ctx, sid, ctx.ClientIP()); err != nil {
+			zap.L().Error("记录会话使用时间失败", zap.Error(err), zap.Int64("session_id", s.ID))
+		}
+		return true
+	}
+}
+
+// List 当前用户未过期的会话
+func (h *SessionHandler) List(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	sessions, err := h.dao.ListActive(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询会话失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	current := ctx.GetString(middleware.SessionKey)
+	vos := make([]SessionVO, 0, len(sessions))
+	for _, s := range sessions {
+		vos = append(vos, SessionVO{
+			Id:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			Ctime:      s.Ctime,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.SID == current,
+		})
+	}
+	success(ctx, msgSessionList, vos)
+}
+
+// Revoke 吊销会话，该会话的 token 在下一次请求时被中间件拒绝
+func (h *SessionHandler) Revoke(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		fail(ctx, errs.ErrInvalidArgument.With(err))
+		return
+	}
+	if err = h.dao.Revoke(ctx, userId, id); err != nil {
+		fail(ctx, notFound(err, errs.SessionNotFound))
+		zap.L().Info("吊销会话失败", zap.Error(err), zap.Int64("user_id", userId), zap.Int64("session_id", id))
+		return
+	}
+	zap.L().Info("吊销会话", zap.Int64("user_id", userId), zap.Int64("session_id", id))
+	success(ctx, msgSessionRevoked, nil)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/sitemap"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 生成 sitemap 时每次从数据库读取的文章数
+const sitemapBatch = 5000
+
+type SitemapConfig struct {
+	// 站点地址，如 https://blog.example.com
+	SiteURL string
+	// 文章页面的地址，%d 会被替换为文章ID
+	PostURL string
+	// 单个 sitemap 文件最多的 URL 数，为 0 时使用 sitemap.MaxURLs
+	MaxURLs int
+	// robots.txt 中禁止抓取的路径前缀
+	Disallow []string
+	// Disallow 下允许抓取的路径前缀，爬虫按最长匹配生效
+	Allow []string
+}
+
+// SitemapHandler 输出 sitemap 和 robots.txt，文章没有变化时直接使用上次生成的结果
+type SitemapHandler struct {
+	postDAO dao.PostDAO
+	cfg     SitemapConfig
+	robots  []byte
+
+	mu      sync.Mutex
+	built   bool
+	version dao.PublishedVersion
+	files   sitemapFiles
+}
+
+// sitemapFiles 生成好的 sitemap，只有一个文件时 index 就是这个文件本身
+type sitemapFiles struct {
+	index    []byte
+	modified time.Time
+	pages    [][]byte
+	pageMods []time.Time
+}
+
+func NewSitemapHandler(postDAO dao.PostDAO, cfg SitemapConfig) *SitemapHandler {
+	cfg.SiteURL = strings.TrimSuffix(cfg.SiteURL, "/")
+	if cfg.MaxURLs <= 0 || cfg.MaxURLs > sitemap.MaxURLs {
+		cfg.MaxURLs = sitemap.MaxURLs
+	}
+	var robots strings.Builder
+	robots.WriteString("User-agent: *\n")
+	for _, path := range cfg.Allow {
+		robots.WriteString("Allow: " + path + "\n")
+	}
+	for _, path := range cfg.Disallow {
+		robots.WriteString("Disallow: " + path + "\n")
+	}
+	robots.WriteString("\nSitemap: " + cfg.SiteURL + "/sitemap.xml\n")
+	return &SitemapHandler{postDAO: postDAO, cfg: cfg, robots: []byte(robots.String())}
+}
+
+func (h *SitemapHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	sg := server.Group("/", mws...)
+	sg.GET("/sitemap.xml", h.Index)
+	sg.GET("/sitemaps/:name", h.Page)
+	sg.GET("/robots.txt", h.Robots)
+}
+
+func (h *SitemapHandler) Robots(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=86400")
+	ctx.Data(http.StatusOK, "text/plain; charset=utf-8", h.robots)
+}
+
+// Index URL 不超过上限时直接返回 sitemap，否则返回引用 /sitemaps/N.xml 的索引
+func (h *SitemapHandler) Index(ctx *gin.Context) {
+	files, err := h.current(ctx)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成 sitemap 失败", zap.Error(err))
+		return
+	}
+	h.serveXML(ctx, files.index, files.modified)
+}
+
+func (h *SitemapHandler) Page(ctx *gin.Context) {
+	name := ctx.Param("name")
+	n, err := strconv.Atoi(strings.TrimSuffix(name, ".xml"))
+	if err != nil || !strings.HasSuffix(name, ".xml") {
+		fail(ctx, errs.ErrNotFound)
+		return
+	}
+	files, err := h.current(ctx)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成 sitemap 失败", zap.Error(err))
+		return
+	}
+	if n < 1 || n > len(files.pages) {
+		fail(ctx, errs.ErrNotFound)
+		return
+	}
+	h.serveXML(ctx, files.pages[n-1], files.pageMods[n-1])
+}
+
+func (h *SitemapHandler) serveXML(ctx *gin.Context, body []byte, modified time.Time) {
+	ctx.Header("Cache-Control", "public, max-age=3600")
+	if notModified(ctx, contentETag(body), modified) {
+		return
+	}
+	ctx.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+}
+
+// current 文章有变化时重新生成，否则返回缓存
+func (h *SitemapHandler) current(ctx context.Context) (sitemapFiles, error) {
+	version, err := h.postDAO.PublishedVersion(ctx)
+	if err != nil {
+		return sitemapFiles{}, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.built && h.version == version {
+		return h.files, nil
+	}
+	files, err := h.generate(ctx)
+	if err != nil {
+		return sitemapFiles{}, err
+	}
+	h.built, h.version, h.files = true, version, files
+	zap.L().Info("重新生成 sitemap", zap.Int64("posts", version.Count), zap.Int("files", len(files.pages)))
+	return files, nil
+}
+
+func (h *SitemapHandler) generate(ctx context.Context) (sitemapFiles, error) {
+	urls := []sitemap.URL{{Loc: h.cfg.SiteURL + "/"}}
+	var afterId int64
+	for {
+		posts, err := h.postDAO.ListPublishedAfter(ctx, afterId, sitemapBatch)
+		if err != nil {
+			return sitemapFiles{}, err
+		}
+		for _, post := range posts {
+			urls = append(urls, sitemap.URL{
+				Loc:     fmt.Sprintf(h.cfg.PostURL, post.ID),
+				LastMod: time.UnixMilli(post.Utime),
+			})
+		}
+		if len(posts) < sitemapBatch {
+			break
+		}
+		afterId = posts[len(posts)-1].ID
+	}
+
+	var files sitemapFiles
+	var refs []sitemap.URL
+	for i, group := range sitemap.Split(urls, h.cfg.MaxURLs) {
+		var buf bytes.Buffer
+		if err := sitemap.WriteURLSet(&buf, group); err != nil {
+			return sitemapFiles{}, err
+		}
+		mod := sitemap.LastMod(group)
+		files.pages = append(files.pages, buf.Bytes())
+		files.pageMods = append(files.pageMods, mod)
+		refs = append(refs, sitemap.URL{Loc: fmt.Sprintf("%s/sitemaps/%d.xml", h.cfg.SiteURL, i+1), LastMod: mod})
+	}
+	files.modified = sitemap.LastMod(refs)
+	if len(files.pages) == 1 {
+		files.index = files.pages[0]
+		return files, nil
+	}
+	var buf bytes.Buffer
+	if err := sitemap.WriteIndex(&buf, refs); err != nil {
+		return sitemapFiles{}, err
+	}
+	files.index = buf.Bytes()
+	return files, nil
+}
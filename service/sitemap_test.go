@@ -0,0 +1,26 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSitemapRobots(t *testing.T) {
+	h := NewSitemapHandler(newFakePostDAO(), SitemapConfig{
+		SiteURL:  "https://blog.example.com/",
+		Disallow: []string{"/admin/", "/user/"},
+		Allow:    []string{"/user/profile/"},
+	})
+	server := newTestServer()
+	h.RegisterRoutes(server)
+
+	recorder := doRequest(server, http.MethodGet, "/robots.txt", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "User-agent: *\n"+
+		"Allow: /user/profile/\n"+
+		"Disallow: /admin/\n"+
+		"Disallow: /user/\n"+
+		"\nSitemap: https://blog.example.com/sitemap.xml\n", recorder.Body.String())
+}
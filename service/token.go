@@ -0,0 +1,108 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/jwks"
+	"blog/middleware"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"time"
+)
+
+// TokenIssuer 签发登录 token。API 客户端从 Authorization 响应头取 token，
+// 浏览器登录时声明 cookie 模式，token 写入 HttpOnly cookie，同时下发 CSRF cookie。
+// 每次登录记录一个会话，token 中的 sid 指向该会话
+type TokenIssuer struct {
+	keys     *jwks.KeySet
+	sessions dao.SessionDAO
+	cookie   middleware.TokenCookie
+	ttl      time.Duration
+}
+
+func NewTokenIssuer(keys *jwks.KeySet, sessions dao.SessionDAO, cookie middleware.TokenCookie, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{keys: keys, sessions: sessions, cookie: cookie, ttl: ttl}
+}
+
+// Issue 登录、修改密码等需要换发 token 时调用，沿用当前请求的模式
+func (t *TokenIssuer) Issue(ctx *gin.Context, user dao.User) error {
+	return t.issue(ctx, user, middleware.UseCookie(ctx))
+}
+
+// IssueCookie 用于第三方登录回调等浏览器跳转的场景，只能使用 cookie 模式
+func (t *TokenIssuer) IssueCookie(ctx *gin.Context, user dao.User) error {
+	return t.issue(ctx, user, true)
+}
+
+func (t *TokenIssuer) issue(ctx *gin.Context, user dao.User, useCookie bool) error {
+	now := time.Now()
+	sid, err := t.session(ctx, user, now.Add(t.ttl))
+	if err != nil {
+		return err
+	}
+	claims := jwt.MapClaims{
+		"id":                  user.ID,
+		"username":            user.Username,
+		"tv":                  user.TokenVersion,
+		"lang":                user.Locale,
+		middleware.SessionKey: sid,
+		"iat":                 now.Unix(),
+		"exp":                 now.Add(t.ttl).Unix(),
+	}
+	var csrf string
+	if useCookie {
+		if csrf, err = middleware.NewCSRFToken(); err != nil {
+			return err
+		}
+		claims[middleware.CSRFClaim] = csrf
+	}
+	tokenString, err := t.keys.Sign(claims)
+	if err != nil {
+		return err
+	}
+	if useCookie {
+		t.cookie.Set(ctx, tokenString, csrf, t.ttl)
+		return nil
+	}
+	ctx.Header("Authorization", "Bearer "+tokenString)
+	return nil
+}
+
+// session 同一会话中换发 token（如修改语言偏好）时沿用原来的会话并延长有效期，否则记录一次新的登录
+func (t *TokenIssuer) session(ctx *gin.Context, user dao.User, expiresAt time.Time) (string, error) {
+	if sid := ctx.GetString(middleware.SessionKey); sid != "" && viewerId(ctx) == int64(user.ID) {
+		return sid, t.sessions.Extend(ctx, sid, expiresAt.UnixMilli())
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	sid := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now().UnixMilli()
+	err := t.sessions.Create(ctx, dao.Session{
+		UserID:     int64(user.ID),
+		SID:        sid,
+		UserAgent:  truncate(ctx.Request.UserAgent(), 255),
+		IP:         ctx.ClientIP(),
+		ExpiresAt:  expiresAt.UnixMilli(),
+		LastSeenAt: now,
+	})
+	return sid, err
+}
+
+// EndOtherSessions 修改或重置密码后吊销用户的其他会话，当前请求所在的会话保留
+func (t *TokenIssuer) EndOtherSessions(ctx *gin.Context, userId int64) error {
+	return t.sessions.RevokeOthers(ctx, userId, ctx.GetString(middleware.SessionKey))
+}
+
+// Clear 吊销当前会话并删除 cookie 模式下的 token，header 模式的 token 由客户端自己丢弃
+func (t *TokenIssuer) Clear(ctx *gin.Context) {
+	if sid := ctx.GetString(middleware.SessionKey); sid != "" {
+		if err := t.sessions.RevokeBySID(ctx, sid); err != nil {
+			zap.L().Error("退出登录吊销会话失败", zap.Error(err), zap.Int64("user_id", viewerId(ctx)))
+		}
+	}
+	t.cookie.Clear(ctx)
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/sign"
+	"blog/totp"
+	"blog/validate"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mfaPurpose        = "mfa-login"
+	recoveryCodeCount = 10
+)
+
+// TwoFactor TOTP 两步验证。开启后登录分两步：密码正确时只返回短期有效的 mfa token，
+// 再用 mfa token 加验证码或恢复码换取正式的登录 token
+type TwoFactor struct {
+	recovery dao.RecoveryCodeDAO
+	signer   *sign.Signer
+	// 验证器 App 中显示的名称
+	issuer string
+	ttl    time.Duration
+}
+
+func NewTwoFactor(recovery dao.RecoveryCodeDAO, signer *sign.Signer, issuer string, ttl time.Duration) *TwoFactor {
+	return &TwoFactor{recovery: recovery, signer: signer, issuer: issuer, ttl: ttl}
+}
+
+type MFAPendingVO struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+type TOTPEnrollVO struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// data:image/png;base64 格式的二维码
+	QRCode string `json:"qrCode"`
+}
+
+type RecoveryCodesVO struct {
+	Codes []string `json:"codes"`
+}
+
+// pending 密码校验通过后签发的 mfa token，修改密码后失效
+func (f *TwoFactor) pending(user dao.User) MFAPendingVO {
+	subject := fmt.Sprintf("%d:%d", user.ID, user.TokenVersion)
+	return MFAPendingVO{
+		MFARequired: true,
+		MFAToken:    f.signer.Sign(mfaPurpose, subject, f.ttl),
+		ExpiresIn:   int64(f.ttl.Seconds()),
+	}
+}
+
+func (f *TwoFactor) parsePending(token string) (userId int64, tokenVersion int64, err error) {
+	subject, err := f.signer.Verify(mfaPurpose, token)
+	if err != nil {
+		return 0, 0, errs.MFATokenInvalid.With(err)
+	}
+	id, tv, ok := strings.Cut(subject, ":")
+	if !ok {
+		return 0, 0, errs.MFATokenInvalid
+	}
+	userId, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, 0, errs.MFATokenInvalid.With(err)
+	}
+	tokenVersion, err = strconv.ParseInt(tv, 10, 64)
+	if err != nil {
+		return 0, 0, errs.MFATokenInvalid.With(err)
+	}
+	return userId, tokenVersion, nil
+}
+
+// verify 6 位数字按 TOTP 验证码校验，否则按恢复码校验，两者都只能用一次
+func (f *TwoFactor) verify(ctx context.Context, userDAO dao.UserDAO, user dao.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return errs.TOTPInvalid
+		}
+		return userDAO.UseTOTPStep(ctx, int64(user.ID), step)
+	}
+	return f.recovery.Consume(ctx, int64(user.ID), hashRecoveryCode(code))
+}
+
+// newRecoveryCodes 生成新的恢复码，旧的全部失效，明文只在这里返回一次
+func (f *TwoFactor) newRecoveryCodes(ctx context.Context, userId int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		// 80 位随机数，16 个字符，分成两段方便抄写
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		code := s[:8] + "-" + s[8:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	if err := f.recovery.Replace(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginTOTP 登录第二步，用 mfa token 和验证码换取登录 token
+func (u *UserHandler) LoginTOTP(ctx *gin.Context) {
+	type LoginTOTPReq struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+		Code     string `json:"code" binding:"required,max=32"`
+	}
+	var req LoginTOTPReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("两步验证登录参数绑定错误", zap.Error(err))
+		return
+	}
+	userId, tv, err := u.mfa.parsePending(req.MFAToken)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Info("mfa token 无效", zap.Error(err))
+		return
+	}
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, notFound(err, errs.MFATokenInvalid))
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if usr.TokenVersion != tv || !usr.TOTPEnabled {
+		fail(ctx, errs.MFATokenInvalid)
+		return
+	}
+
+	// 和密码一样计入登录失败次数，防止暴力猜验证码
+	ip := ctx.ClientIP()
+	if u.throttled(ctx, usr.Username, ip) {
+		return
+	}
+	if err = u.mfa.verify(ctx, u.dao, usr, req.Code); err != nil {
+		fail(ctx, err)
+		zap.L().Info("两步验证失败", zap.Error(err), zap.Int64("user_id", userId), zap.String("ip", ip))
+		return
+	}
+	if err = u.guard.Succeed(ctx, usr.Username, ip); err != nil {
+		zap.L().Error("清除登录失败记录失败", zap.Error(err))
+	}
+	if err = u.tokens.Issue(ctx, usr); err != nil {
+		fail(ctx, err)
+		zap.L().Error("用户登录生成token失败", zap.Error(err))
+		return
+	}
+	success(ctx, msgLoggedIn, nil)
+}
+
+// EnrollTOTP 生成新的密钥，确认之前不会生效，重复调用会换一个密钥
+func (u *UserHandler) EnrollTOTP(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if usr.TOTPEnabled {
+		fail(ctx, errs.TOTPEnabled)
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成 TOTP 密钥失败", zap.Error(err))
+		return
+	}
+	if err = u.dao.SetTOTPSecret(ctx, userId, secret); err != nil {
+		fail(ctx, err)
+		zap.L().Error("保存 TOTP 密钥失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	uri := totp.URI(u.mfa.issuer, usr.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成二维码失败", zap.Error(err))
+		return
+	}
+	success(ctx, msgTOTPEnroll, TOTPEnrollVO{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ConfirmTOTP 输入验证器 App 上的验证码确认开启，返回恢复码
+func (u *UserHandler) ConfirmTOTP(ctx *gin.Context) {
+	type ConfirmReq struct {
+		Code string `json:"code" binding:"required,max=32"`
+	}
+	var req ConfirmReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("确认两步验证参数绑定错误", zap.Error(err))
+		return
+	}
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if usr.TOTPEnabled {
+		fail(ctx, errs.TOTPEnabled)
+		return
+	}
+	if usr.TOTPSecret == "" {
+		fail(ctx, errs.TOTPNotEnrolled)
+		return
+	}
+	step, ok := totp.Validate(usr.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		fail(ctx, errs.TOTPInvalid)
+		return
+	}
+	codes, err := u.mfa.newRecoveryCodes(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成恢复码失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if err = u.dao.EnableTOTP(ctx, userId, step); err != nil {
+		fail(ctx, err)
+		zap.L().Error("开启两步验证失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	zap.L().Info("开启两步验证", zap.Int64("user_id", userId))
+	success(ctx, msgTOTPEnabled, RecoveryCodesVO{Codes: codes})
+}
+
+// DisableTOTP 关闭两步验证，需要密码和验证码（或恢复码）
+func (u *UserHandler) DisableTOTP(ctx *gin.Context) {
+	type DisableReq struct {
+		Password string `json:"password" binding:"required,max=72"`
+		Code     string `json:"code" binding:"required,max=32"`
+	}
+	var req DisableReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("关闭两步验证参数绑定错误", zap.Error(err))
+		return
+	}
+	usr, ok := u.enabledTOTPUser(ctx)
+	if !ok {
+		return
+	}
+	// 和 LoginTOTP 一样计入登录失败次数，会话被盗用时也不能暴力猜密码和验证码
+	ip := ctx.ClientIP()
+	if u.throttled(ctx, usr.Username, ip) {
+		return
+	}
+	if err := checkPassword(usr, req.Password, errs.PasswordIncorrect); err != nil {
+		fail(ctx, err)
+		return
+	}
+	userId := int64(usr.ID)
+	if err := u.mfa.verify(ctx, u.dao, usr, req.Code); err != nil {
+		fail(ctx, err)
+		zap.L().Info("关闭两步验证时验证码错误", zap.Error(err), zap.Int64("user_id", userId), zap.String("ip", ip))
+		return
+	}
+	if err := u.guard.Succeed(ctx, usr.Username, ip); err != nil {
+		zap.L().Error("清除登录失败记录失败", zap.Error(err))
+	}
+	if err := u.dao.SetTOTPSecret(ctx, userId, ""); err != nil {
+		fail(ctx, err)
+		zap.L().Error("关闭两步验证失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if err := u.mfa.recovery.Replace(ctx, userId, nil); err != nil {
+		zap.L().Error("删除恢复码失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	zap.L().Info("关闭两步验证", zap.Int64("user_id", userId))
+	success(ctx, msgTOTPDisabled, nil)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要验证码
+func (u *UserHandler) RegenerateRecoveryCodes(ctx *gin.Context) {
+	type RegenerateReq struct {
+		Code string `json:"code" binding:"required,max=32"`
+	}
+	var req RegenerateReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("生成恢复码参数绑定错误", zap.Error(err))
+		return
+	}
+	usr, ok := u.enabledTOTPUser(ctx)
+	if !ok {
+		return
+	}
+	ip := ctx.ClientIP()
+	if u.throttled(ctx, usr.Username, ip) {
+		return
+	}
+	if err := u.mfa.verify(ctx, u.dao, usr, req.Code); err != nil {
+		fail(ctx, err)
+		zap.L().Info("生成恢复码时验证码错误", zap.Error(err), zap.Uint("user_id", usr.ID), zap.String("ip", ip))
+		return
+	}
+	if err := u.guard.Succeed(ctx, usr.Username, ip); err != nil {
+		zap.L().Error("清除登录失败记录失败", zap.Error(err))
+	}
+	codes, err := u.mfa.newRecoveryCodes(ctx, int64(usr.ID))
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("生成恢复码失败", zap.Error(err), zap.Uint("user_id", usr.ID))
+		return
+	}
+	success(ctx, msgRecoveryCodes, RecoveryCodesVO{Codes: codes})
+}
+
+// enabledTOTPUser 当前用户，没有开启两步验证时返回 errs.TOTPNotEnrolled
+func (u *UserHandler) enabledTOTPUser(ctx *gin.Context) (dao.User, bool) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return dao.User{}, false
+	}
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return dao.User{}, false
+	}
+	if !usr.TOTPEnabled {
+		fail(ctx, errs.TOTPNotEnrolled)
+		return dao.User{}, false
+	}
+	return usr, true
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/domain"
+	"blog/guard"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 已登录的接口校验验证码时同样计入失败次数，会话被盗用后也不能暴力猜验证码
+func TestTOTPCodeThrottled(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("passw0rd"), bcrypt.MinCost)
+	require.NoError(t, err)
+	testCases := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "关闭两步验证", path: "/user/2fa/disable", body: `{"password":"passw0rd","code":"000000"}`},
+		{name: "重新生成恢复码", path: "/user/2fa/recovery-codes", body: `{"code":"000000"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newFakeUserDAO(dao.User{Model: gorm.Model{ID: 1}, Username: "alice", Password: string(hash),
+				TOTPEnabled: true, TOTPSecret: "not-a-secret"})
+			policy := guard.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Forget: time.Hour}
+			h := &UserHandler{dao: users, guard: guard.NewLoginGuard(guard.NewMemoryStore(), policy, policy)}
+			server := newTestServer(fakeLogin(1))
+			h.RegisterRoutes(server)
+
+			wantErrors := []string{"auth.totp_invalid", "auth.totp_invalid", "auth.login_throttled"}
+			for _, want := range wantErrors {
+				recorder := doRequest(server, http.MethodPost, tc.path, tc.body)
+				var res domain.Result
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				assert.Equal(t, want, res.Error, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -2,146 +2,224 @@ package service
 
 import (
 	"blog/dao"
-	"blog/domain"
-	"github.com/dgrijalva/jwt-go"
+	"blog/errs"
+	"blog/guard"
+	"blog/i18n"
+	"blog/validate"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-	"net/http"
-	"time"
+	"math"
+	"strconv"
+	"sync"
 )
 
 type UserHandler struct {
-	dao dao.UserDAO
+	dao          dao.UserDAO
+	guard        *guard.LoginGuard
+	verifier     *EmailVerifier
+	resetter     *PasswordResetter
+	tokens       *TokenIssuer
+	accessTokens dao.AccessTokenDAO
+	mfa          *TwoFactor
 }
 
-func NewUserHandler(dao dao.UserDAO) *UserHandler {
-	return &UserHandler{dao: dao}
+func NewUserHandler(dao dao.UserDAO, guard *guard.LoginGuard, verifier *EmailVerifier, resetter *PasswordResetter, tokens *TokenIssuer, accessTokens dao.AccessTokenDAO, mfa *TwoFactor) *UserHandler {
+	return &UserHandler{dao: dao, guard: guard, verifier: verifier, resetter: resetter, tokens: tokens, accessTokens: accessTokens, mfa: mfa}
 }
 
-func (u *UserHandler) RegisterRoutes(server *gin.Engine) {
-	ug := server.Group("/user")
+// 用户不存在时用来比较的哈希，让响应时间和密码错误时一致
+var dummyPassword = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func (u *UserHandler) RegisterRoutes(server *gin.Engine, mws ...gin.HandlerFunc) {
+	ug := server.Group("/user", mws...)
 	ug.POST("/signup", u.SignUp)
 	ug.POST("/login", u.Login)
+	ug.POST("/login/2fa", u.LoginTOTP)
+	ug.POST("/logout", u.Logout)
+	ug.GET("/verify", u.VerifyEmail)
+	ug.POST("/verify/resend", requireLogin, u.ResendVerification)
+	ug.POST("/password/forgot", u.ForgotPassword)
+	ug.POST("/password/reset", u.ResetPassword)
+	ug.POST("/password/change", requireLogin, u.ChangePassword)
+	ug.POST("/locale", requireLogin, u.UpdateLocale)
+	ug.POST("/2fa/enroll", requireLogin, u.EnrollTOTP)
+	ug.POST("/2fa/confirm", requireLogin, u.ConfirmTOTP)
+	ug.POST("/2fa/disable", requireLogin, u.DisableTOTP)
+	ug.POST("/2fa/recovery-codes", requireLogin, u.RegenerateRecoveryCodes)
 }
 
 func (u *UserHandler) SignUp(c *gin.Context) {
 	type SignUpRequest struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Username string `json:"username" binding:"required,username"`
+		Password string `json:"password" binding:"required,password"`
+		Email    string `json:"email" binding:"required,email,max=128"`
 	}
 
 	var req SignUpRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(c, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("用户注册绑定参数失败", zap.Error(err))
 		return
 	}
 	_, err := u.dao.FindByUsername(c, req.Username)
 	if err == nil {
-		c.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户名已被注册",
-		})
+		fail(c, errs.UsernameTaken)
 		return
 	}
 	_, err = u.dao.FindByEmail(c, req.Email)
 	if err == nil {
-		c.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "邮箱已被注册",
-		})
+		fail(c, errs.EmailTaken)
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "注册失败",
-		})
+		fail(c, err)
 		zap.L().Error("用户注册密码加密失败", zap.Error(err))
 		return
 	}
 
-	err = u.dao.CreateUser(c, dao.User{
+	userId, err := u.dao.CreateUser(c, dao.User{
 		Username: req.Username,
 		Password: string(hashedPassword),
 		Email:    req.Email,
 	})
 	if err != nil {
-		c.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "注册失败",
-		})
+		fail(c, err)
 		zap.L().Error("用户注册失败", zap.Error(err))
 		return
 	}
-	c.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "注册成功",
-	})
+	// 邮件发送失败不影响注册，用户可以重新发送
+	err = u.verifier.Send(c, userId, req.Username, req.Email)
+	if err != nil {
+		zap.L().Error("发送验证邮件失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	success(c, msgSignedUp, nil)
 }
 
 func (u *UserHandler) Login(ctx *gin.Context) {
 	type LoginRequest struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username string `json:"username" binding:"required,max=64"`
+		Password string `json:"password" binding:"required,max=72"`
 	}
 
 	var req LoginRequest
 	err := ctx.ShouldBindJSON(&req)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "参数错误",
-		})
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
 		zap.L().Error("用户登录绑定参数失败", zap.Error(err))
 		return
 	}
+	ip := ctx.ClientIP()
+	if u.throttled(ctx, req.Username, ip) {
+		return
+	}
+
 	user, err := u.dao.FindByUsername(ctx, req.Username)
-	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "用户不存在",
-		})
-		zap.L().Info("用户不存在", zap.Error(err))
+	if err != nil && !errors.Is(err, errs.ErrNotFound) {
+		fail(ctx, err)
+		zap.L().Error("登录查询用户失败", zap.Error(err))
 		return
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	hash := dummyPassword()
+	if err == nil {
+		hash = []byte(user.Password)
+	}
+	pwdErr := bcrypt.CompareHashAndPassword(hash, []byte(req.Password))
+	// 失败次数在 throttled 中已经记下
+	if err != nil || pwdErr != nil {
+		// 不区分用户不存在和密码错误，避免枚举用户名
+		fail(ctx, errs.InvalidCredential)
+		zap.L().Info("用户登录失败", zap.String("username", req.Username), zap.String("ip", ip), zap.Bool("user_exists", err == nil))
+		return
+	}
+	// 开启了两步验证时，等验证码通过后再清除失败记录，否则可以用密码反复重置猜验证码的次数
+	if user.TOTPEnabled {
+		if err := u.guard.Release(ctx, req.Username, ip); err != nil {
+			zap.L().Error("撤销登录尝试记录失败", zap.Error(err))
+		}
+		success(ctx, msgMFARequired, u.mfa.pending(user))
+		return
+	}
+	if err := u.guard.Succeed(ctx, req.Username, ip); err != nil {
+		zap.L().Error("清除登录失败记录失败", zap.Error(err))
+	}
+
+	err = u.tokens.Issue(ctx, user)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 400,
-			Msg:  "密码错误",
-		})
-		zap.L().Info("用户密码错误", zap.Error(err))
+		fail(ctx, err)
+		zap.L().Error("用户登录生成token失败", zap.Error(err))
 		return
 	}
 
-	// 生成 JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":       user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	success(ctx, msgLoggedIn, nil)
+}
 
-	tokenString, err := token.SignedString([]byte("Qk1Qb2p6b3h1b1l6b2p6b3h1b1l6b2p6b3h1b1l6b2p6b3h1b1l6b2o="))
+// throttled 登录失败次数过多时拒绝请求并返回 true，否则先把这次尝试记为失败，成功后需要调用 guard.Succeed 或 guard.Release
+func (u *UserHandler) throttled(ctx *gin.Context, username string, ip string) bool {
+	wait, err := u.guard.Check(ctx, username, ip)
 	if err != nil {
-		ctx.JSON(http.StatusOK, domain.Result{
-			Code: 500,
-			Msg:  "登录失败",
-		})
-		zap.L().Error("用户登录生成token失败", zap.Error(err))
+		zap.L().Error("检查登录失败记录失败", zap.Error(err))
+	}
+	if wait <= 0 {
+		return false
+	}
+	seconds := int64(math.Ceil(wait.Seconds()))
+	ctx.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	fail(ctx, errs.LoginThrottled.WithArgs(seconds))
+	zap.L().Info("登录尝试过于频繁", zap.String("username", username), zap.String("ip", ip))
+	return true
+}
+
+// Logout cookie 模式下删除 cookie，header 模式下 token 由客户端自己丢弃
+func (u *UserHandler) Logout(ctx *gin.Context) {
+	u.tokens.Clear(ctx)
+	success(ctx, msgLoggedOut, nil)
+}
+
+// UpdateLocale 设置偏好的界面语言，为空表示跟随 Accept-Language
+func (u *UserHandler) UpdateLocale(ctx *gin.Context) {
+	type LocaleReq struct {
+		Locale string `json:"locale" binding:"max=16"`
+	}
+	var req LocaleReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, errs.ErrInvalidArgument.WithData(validate.Errors(err)))
+		zap.L().Error("设置语言参数绑定错误", zap.Error(err))
+		return
+	}
+	if req.Locale != "" && !i18n.Supported(req.Locale) {
+		fail(ctx, errs.LocaleUnsupported.WithArgs(req.Locale))
 		return
 	}
-	ctx.Header("Authorization", "Bearer "+tokenString)
 
-	ctx.JSON(http.StatusOK, domain.Result{
-		Code: 200,
-		Msg:  "登录成功",
-	})
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	if err = u.dao.UpdateLocale(ctx, userId, req.Locale); err != nil {
+		fail(ctx, err)
+		zap.L().Error("设置语言失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+
+	// 语言偏好保存在 token 中，换发新 token 后才生效
+	usr, err := u.dao.FindById(ctx, userId)
+	if err == nil {
+		err = u.tokens.Issue(ctx, usr)
+	}
+	if err != nil {
+		zap.L().Error("设置语言后换发token失败", zap.Error(err), zap.Int64("user_id", userId))
+	}
+	ctx.Set(i18n.ContextKey, req.Locale)
+	success(ctx, msgLocaleUpdated, nil)
 }
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"blog/dao"
+	"blog/errs"
+	"blog/mailer"
+	"blog/sign"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const verifyEmailPurpose = "verify_email"
+
+// EmailVerifier 发送和校验邮箱验证链接，链接是签名 token，不需要存库
+type EmailVerifier struct {
+	mailer  mailer.Mailer
+	signer  *sign.Signer
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewEmailVerifier baseURL 为验证链接的站点地址，如 https://blog.example.com
+func NewEmailVerifier(m mailer.Mailer, signer *sign.Signer, baseURL string, ttl time.Duration) *EmailVerifier {
+	return &EmailVerifier{mailer: m, signer: signer, baseURL: strings.TrimSuffix(baseURL, "/"), ttl: ttl}
+}
+
+func (v *EmailVerifier) Send(ctx context.Context, userId int64, username string, email string) error {
+	token := v.signer.Sign(verifyEmailPurpose, strconv.FormatInt(userId, 10)+":"+email, v.ttl)
+	link := v.baseURL + "/user/verify?token=" + url.QueryEscape(token)
+	return v.mailer.Send(ctx, mailer.Message{
+		To:      []string{email},
+		Subject: "请验证你的邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %d 小时内点击下面的链接完成邮箱验证：\n\n%s\n\n如果不是你本人注册，请忽略这封邮件。\n",
+			username, int(v.ttl.Hours()), link),
+	})
+}
+
+// Verify 返回 token 中的用户ID和邮箱
+func (v *EmailVerifier) Verify(token string) (int64, string, error) {
+	subject, err := v.signer.Verify(verifyEmailPurpose, token)
+	if err != nil {
+		return 0, "", err
+	}
+	idstr, email, ok := strings.Cut(subject, ":")
+	if !ok {
+		return 0, "", sign.ErrInvalid
+	}
+	id, err := strconv.ParseInt(idstr, 10, 64)
+	if err != nil {
+		return 0, "", sign.ErrInvalid
+	}
+	return id, email, nil
+}
+
+// VerifyEmail 邮件中的验证链接
+func (u *UserHandler) VerifyEmail(ctx *gin.Context) {
+	userId, email, err := u.verifier.Verify(ctx.Query("token"))
+	if err != nil {
+		if errors.Is(err, sign.ErrExpired) {
+			fail(ctx, errs.VerifyLinkExpired.With(err))
+		} else {
+			fail(ctx, errs.VerifyLinkInvalid.With(err))
+		}
+		zap.L().Info("邮箱验证链接无效", zap.Error(err))
+		return
+	}
+	err = u.dao.MarkEmailVerified(ctx, userId, email)
+	if err != nil {
+		fail(ctx, notFound(err, errs.VerifyLinkInvalid))
+		zap.L().Error("标记邮箱已验证失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgEmailVerifiedOK, nil)
+}
+
+// ResendVerification 重新发送验证邮件
+func (u *UserHandler) ResendVerification(ctx *gin.Context) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+
+	usr, err := u.dao.FindById(ctx, userId)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	if usr.EmailVerified {
+		fail(ctx, errs.EmailVerified)
+		return
+	}
+	err = u.verifier.Send(ctx, userId, usr.Username, usr.Email)
+	if err != nil {
+		fail(ctx, err)
+		zap.L().Error("发送验证邮件失败", zap.Error(err), zap.Int64("user_id", userId))
+		return
+	}
+	success(ctx, msgVerificationSent, nil)
+}
+
+// requireVerifiedEmail 未验证邮箱的用户不能发文章和评论
+func requireVerifiedEmail(userDAO dao.UserDAO) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId := viewerId(ctx)
+		if userId == 0 {
+			fail(ctx, errs.ErrUnauthenticated)
+			return
+		}
+		usr, err := userDAO.FindById(ctx, userId)
+		if err != nil {
+			fail(ctx, err)
+			zap.L().Error("查询用户失败", zap.Error(err), zap.Int64("user_id", userId))
+			return
+		}
+		if !usr.EmailVerified {
+			fail(ctx, errs.EmailUnverified)
+			return
+		}
+	}
+}
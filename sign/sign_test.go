@@ -0,0 +1,74 @@
+package sign
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	s := New([]byte("secret"))
+	testCases := []struct {
+		name    string
+		token   func() string
+		purpose string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "正常验证",
+			token:   func() string { return s.Sign("verify", "1|a@example.com", time.Minute) },
+			purpose: "verify",
+			want:    "1|a@example.com",
+		},
+		{
+			name:    "已过期",
+			token:   func() string { return s.Sign("verify", "1", -time.Minute) },
+			purpose: "verify",
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "用途不同",
+			token:   func() string { return s.Sign("verify", "1", time.Minute) },
+			purpose: "2fa",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "密钥不同",
+			token:   func() string { return New([]byte("other")).Sign("verify", "1", time.Minute) },
+			purpose: "verify",
+			wantErr: ErrInvalid,
+		},
+		{
+			name: "篡改内容",
+			token: func() string {
+				token := s.Sign("verify", "1", time.Minute)
+				_, sig, _ := strings.Cut(token, ".")
+				forged := s.Sign("verify", "2", time.Minute)
+				payload, _, _ := strings.Cut(forged, ".")
+				return payload + "." + sig
+			},
+			purpose: "verify",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "格式错误",
+			token:   func() string { return "no-dot" },
+			purpose: "verify",
+			wantErr: ErrInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.Verify(tc.purpose, tc.token())
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
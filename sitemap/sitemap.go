@@ -0,0 +1,92 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// MaxURLs 单个 sitemap 文件最多包含的 URL 数，超过后需要拆分并用索引文件引用
+const MaxURLs = 50000
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type URL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []entry  `xml:"url"`
+}
+
+type index struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Sitemaps []entry  `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func toEntries(urls []URL) []entry {
+	res := make([]entry, 0, len(urls))
+	for _, u := range urls {
+		e := entry{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			e.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// WriteURLSet 输出包含页面地址的 sitemap
+func WriteURLSet(w io.Writer, urls []URL) error {
+	return write(w, urlSet{Xmlns: namespace, URLs: toEntries(urls)})
+}
+
+// WriteIndex 输出引用多个 sitemap 的索引文件，URL.LastMod 为对应 sitemap 中最新的修改时间
+func WriteIndex(w io.Writer, sitemaps []URL) error {
+	return write(w, index{Xmlns: namespace, Sitemaps: toEntries(sitemaps)})
+}
+
+func write(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Split 按每个文件最多 size 个 URL 拆分，没有 URL 时也返回一个空的分组
+func Split(urls []URL, size int) [][]URL {
+	if size <= 0 {
+		size = MaxURLs
+	}
+	res := make([][]URL, 0, len(urls)/size+1)
+	for len(urls) > size {
+		res = append(res, urls[:size])
+		urls = urls[size:]
+	}
+	return append(res, urls)
+}
+
+// LastMod 一组 URL 中最新的修改时间
+func LastMod(urls []URL) time.Time {
+	var res time.Time
+	for _, u := range urls {
+		if u.LastMod.After(res) {
+			res = u.LastMod
+		}
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteURLSet(t *testing.T) {
+	mod := time.Date(2024, 5, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	var buf bytes.Buffer
+	require.NoError(t, WriteURLSet(&buf, []URL{
+		{Loc: "https://blog.example.com/"},
+		{Loc: "https://blog.example.com/posts/1?a=1&b=2", LastMod: mod},
+	}))
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Len(t, doc.URLs, 2)
+	assert.Equal(t, "", doc.URLs[0].LastMod)
+	assert.Equal(t, "https://blog.example.com/posts/1?a=1&b=2", doc.URLs[1].Loc)
+	assert.Equal(t, "2024-05-01T00:00:00Z", doc.URLs[1].LastMod)
+	assert.Contains(t, buf.String(), "a=1&amp;b=2")
+}
+
+func TestWriteIndex(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteIndex(&buf, []URL{{Loc: "https://blog.example.com/sitemaps/1.xml"}}))
+	var doc struct {
+		XMLName  xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Len(t, doc.Sitemaps, 1)
+	assert.Equal(t, "https://blog.example.com/sitemaps/1.xml", doc.Sitemaps[0].Loc)
+}
+
+func TestSplit(t *testing.T) {
+	urls := make([]URL, 0, 7)
+	for i := 0; i < 7; i++ {
+		urls = append(urls, URL{Loc: strconv.Itoa(i)})
+	}
+	testCases := []struct {
+		name string
+		urls []URL
+		size int
+		want []int
+	}{
+		{name: "没有 URL", urls: nil, size: 3, want: []int{0}},
+		{name: "正好一个文件", urls: urls[:3], size: 3, want: []int{3}},
+		{name: "拆分", urls: urls, size: 3, want: []int{3, 3, 1}},
+		{name: "默认大小", urls: urls, size: 0, want: []int{7}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []int
+			for _, group := range Split(tc.urls, tc.size) {
+				got = append(got, len(group))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLastMod(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	assert.Equal(t, t2, LastMod([]URL{{LastMod: t1}, {LastMod: t2}, {}}))
+	assert.True(t, LastMod(nil).IsZero())
+}
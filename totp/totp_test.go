@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 附录 B 中 SHA1 的测试向量
+func TestCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+	for _, tc := range testCases {
+		got := code(key, uint64(Step(time.Unix(tc.unix, 0))), 8)
+		assert.Equal(t, tc.want, got, tc.unix)
+	}
+
+	secret := base32.StdEncoding.EncodeToString(key)
+	got, err := Code(secret, time.Unix(59, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", got)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	current, err := Code(secret, now)
+	require.NoError(t, err)
+	previous, err := Code(secret, now.Add(-Period))
+	require.NoError(t, err)
+	stale, err := Code(secret, now.Add(-3*Period))
+	require.NoError(t, err)
+
+	step, ok := Validate(secret, current, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// 上一个周期的验证码仍然有效，但序号不同，调用方据此防止重放
+	step, ok = Validate(secret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	_, ok = Validate(secret, stale, now)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", current, now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("my blog", "alice", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/my blog:alice", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "my blog", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+}
@@ -0,0 +1,175 @@
+package validate
+
+import (
+	"blog/i18n"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	key  string
+	args []any
+}
+
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_-]{3,32}$`)
+
+// Register 在 gin 使用的校验器上注册自定义规则，并用 json 字段名报告错误
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("gin 的校验器不是 go-playground/validator")
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	rules := map[string]validator.Func{
+		"password": password,
+		"username": username,
+		"notblank": notBlank,
+	}
+	for tag, fn := range rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// password 至少 8 位，同时包含字母和数字
+func password(fl validator.FieldLevel) bool {
+	s := fl.Field().String()
+	if len([]rune(s)) < 8 || len(s) > 72 {
+		// bcrypt 只使用前 72 个字节
+		return false
+	}
+	var letter, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
+
+// username 字母、数字、下划线和连字符，和 @提及 能识别的字符一致
+func username(fl validator.FieldLevel) bool {
+	return usernamePattern.MatchString(fl.Field().String())
+}
+
+func notBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// 校验错误提示的文案键
+var (
+	msgRequired  = i18n.Key("validate.required")
+	msgNotBlank  = i18n.Key("validate.notblank")
+	msgEmail     = i18n.Key("validate.email")
+	msgPassword  = i18n.Key("validate.password")
+	msgUsername  = i18n.Key("validate.username")
+	msgMax       = i18n.Key("validate.max")
+	msgMaxLen    = i18n.Key("validate.max_len")
+	msgMin       = i18n.Key("validate.min")
+	msgMinLen    = i18n.Key("validate.min_len")
+	msgGt        = i18n.Key("validate.gt")
+	msgOneOf     = i18n.Key("validate.oneof")
+	msgHTTPURL   = i18n.Key("validate.http_url")
+	msgInvalid   = i18n.Key("validate.invalid")
+	msgType      = i18n.Key("validate.type")
+	msgMalformed = i18n.Key("validate.malformed")
+)
+
+// FieldErrors 实现 i18n.Localizer，渲染响应时按请求的语言翻译
+type FieldErrors []FieldError
+
+func (fes FieldErrors) Localize(locale string) any {
+	res := make(FieldErrors, 0, len(fes))
+	for _, fe := range fes {
+		fe.Message = i18n.T(locale, fe.key, fe.args...)
+		res = append(res, fe)
+	}
+	return res
+}
+
+// Errors 把绑定错误转换为逐字段的错误列表，提示文案默认使用中文
+func Errors(err error) FieldErrors {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		res := make(FieldErrors, 0, len(verrs))
+		for _, fe := range verrs {
+			key, args := message(fe)
+			res = append(res, newFieldError(fe.Field(), fe.Tag(), key, args...))
+		}
+		return res
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return FieldErrors{newFieldError(typeErr.Field, "type", msgType)}
+	}
+	return FieldErrors{newFieldError("", "malformed", msgMalformed)}
+}
+
+func newFieldError(field, code, key string, args ...any) FieldError {
+	return FieldError{
+		Field:   field,
+		Code:    code,
+		Message: i18n.T(i18n.Default, key, args...),
+		key:     key,
+		args:    args,
+	}
+}
+
+// message 返回提示文案的键和参数
+func message(fe validator.FieldError) (string, []any) {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return msgRequired, nil
+	case "notblank":
+		return msgNotBlank, nil
+	case "email":
+		return msgEmail, nil
+	case "password":
+		return msgPassword, nil
+	case "username":
+		return msgUsername, nil
+	case "max":
+		if isString {
+			return msgMaxLen, []any{fe.Param()}
+		}
+		return msgMax, []any{fe.Param()}
+	case "min":
+		if isString {
+			return msgMinLen, []any{fe.Param()}
+		}
+		return msgMin, []any{fe.Param()}
+	case "gt":
+		return msgGt, []any{fe.Param()}
+	case "oneof":
+		return msgOneOf, []any{fe.Param()}
+	case "http_url":
+		return msgHTTPURL, nil
+	}
+	return msgInvalid, nil
+}
@@ -0,0 +1,68 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	require.NoError(t, Register())
+	type Req struct {
+		Username string `json:"username" binding:"required,username"`
+		Password string `json:"password" binding:"required,password"`
+		Email    string `json:"email" binding:"required,email"`
+		Title    string `json:"title" binding:"notblank,max=5"`
+	}
+	testCases := []struct {
+		name string
+		req  Req
+		want []string
+	}{
+		{
+			name: "全部合法",
+			req:  Req{Username: "xiang_cun", Password: "abc12345", Email: "a@b.com", Title: "标题"},
+		},
+		{
+			name: "每个字段都不合法",
+			req:  Req{Username: "a b", Password: "12345678", Email: "nope", Title: "   "},
+			want: []string{"username:username", "password:password", "email:email", "title:notblank"},
+		},
+		{
+			name: "超长",
+			req:  Req{Username: "小明同学", Password: "abc12345", Email: "a@b.com", Title: "一二三四五六"},
+			want: []string{"title:max"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := binding.Validator.ValidateStruct(tc.req)
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, fe := range Errors(err) {
+				assert.NotEmpty(t, fe.Message)
+				got = append(got, fe.Field+":"+fe.Code)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestErrorsLocalize(t *testing.T) {
+	require.NoError(t, Register())
+	type Req struct {
+		Title string `json:"title" binding:"max=5"`
+	}
+	fes := Errors(binding.Validator.ValidateStruct(Req{Title: "一二三四五六"}))
+	assert.Equal(t, "长度不能超过 5", fes[0].Message)
+	localized := fes.Localize("en").(FieldErrors)
+	assert.Equal(t, "must be at most 5 characters", localized[0].Message)
+	assert.Equal(t, "title", localized[0].Field)
+	// 不修改原来的错误
+	assert.Equal(t, "长度不能超过 5", fes[0].Message)
+}